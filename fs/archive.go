@@ -0,0 +1,719 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//ArchiveTar is an uncompressed tar archive
+	ArchiveTar = "tar"
+
+	//ArchiveTarGz is a gzip compressed tar archive
+	ArchiveTarGz = "tar.gz"
+
+	//ArchiveTarBz2 is a bzip2 compressed tar archive
+	ArchiveTarBz2 = "tar.bz2"
+
+	//ArchiveTarXz is a xz compressed tar archive
+	ArchiveTarXz = "tar.xz"
+
+	//ArchiveTarZst is a zstd compressed tar archive
+	ArchiveTarZst = "tar.zst"
+
+	//ArchiveZip is a zip archive
+	ArchiveZip = "zip"
+
+	//padding read after the tar end marker before the decompressor is stopped
+	decompressDrainBytes = 1024 * 1024
+
+	//symlinks followed while checking a link target, like the kernel's limit
+	linkMaxHops = 40
+)
+
+var (
+	//ErrUnsupportedArchive the archive format is not supported
+	ErrUnsupportedArchive = errors.New("Unsupported archive format")
+
+	//ErrDecompressorNotFound the xz or zstd command is not installed
+	ErrDecompressorNotFound = errors.New("Decompressor is not installed")
+
+	//ErrUnsafeArchivePath the archive entry would be written outside the destination
+	ErrUnsafeArchivePath = errors.New("Archive entry escapes the destination directory")
+
+	//ErrArchiveTooLarge the archive exceeds a configured size limit
+	ErrArchiveTooLarge = errors.New("Archive exceeds the size limit")
+
+	archiveMagic = []struct {
+		format string
+		magic  []byte
+	}{
+		{ArchiveTarGz, []byte{0x1f, 0x8b}},
+		{ArchiveTarBz2, []byte("BZh")},
+		{ArchiveTarXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+		{ArchiveTarZst, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{ArchiveZip, []byte("PK\x03\x04")},
+		{ArchiveZip, []byte("PK\x05\x06")},
+	}
+)
+
+//ExtractOptions configures ExtractArchive
+type ExtractOptions struct {
+	//Format is one of the Archive constants. Empty detects it from the
+	//file's contents.
+	Format string
+
+	//StripComponents removes this many leading path components from every
+	//entry, like tar --strip-components. Entries with fewer are skipped.
+	StripComponents int
+
+	//Include, when set, only extracts entries matching one of the globs.
+	//Globs are matched against the path after stripping and its base name.
+	Include []string
+
+	//PreserveOwner applies the owner and group stored in a tar archive.
+	//Otherwise the extracting user owns everything.
+	PreserveOwner bool
+
+	//PreserveSpecialBits keeps the setuid, setgid and sticky bits. They are
+	//cleared by default.
+	PreserveSpecialBits bool
+
+	//MaxBytes limits the total uncompressed size. 0 is unlimited.
+	MaxBytes int64
+
+	//MaxFileBytes limits the size of a single file. 0 is unlimited.
+	MaxFileBytes int64
+
+	//MaxEntries limits the number of entries. 0 is unlimited.
+	MaxEntries int
+}
+
+//ExtractStats summarizes an ExtractArchive run
+type ExtractStats struct {
+	Files     int
+	Dirs      int
+	Symlinks  int
+	HardLinks int
+	Skipped   int
+	Bytes     int64
+}
+
+//archiveEntry is a tar or zip entry
+type archiveEntry struct {
+	name     string
+	linkname string
+	typ      byte
+	mode     os.FileMode
+	uid      int
+	gid      int
+	modTime  time.Time
+	open     func() (io.ReadCloser, error)
+}
+
+type extractor struct {
+	root     string
+	opts     *ExtractOptions
+	stats    *ExtractStats
+	entries  int
+	dirs     []*archiveEntry
+	dirPaths []string
+	symlinks []string
+}
+
+//detectArchive returns the format from the magic bytes at the start of the
+//file. Anything else is assumed to be a plain tar.
+func detectArchive(file *os.File) (string, error) {
+	header := make([]byte, 8)
+	n, err := file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	for _, m := range archiveMagic {
+		if bytes.HasPrefix(header[:n], m.magic) {
+			return m.format, nil
+		}
+	}
+	return ArchiveTar, nil
+}
+
+//decompressCommand streams r through an external decompressor. Go has no
+//xz or zstd support in the standard library so they are handed to the xz
+//and zstd commands, which are run directly and never through a shell. The
+//returned function waits for the command, killing it first if the
+//extraction failed.
+func decompressCommand(name string, r io.Reader) (io.ReadCloser, func(bool) error, error) {
+	exe, err := exec.LookPath(name)
+	if err != nil {
+		return nil, nil, ErrDecompressorNotFound
+	}
+	cmd := exec.Command(exe, "-d", "-c")
+	cmd.Stdin = r
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	finish := func(kill bool) error {
+		if kill {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil
+		}
+		//tar stops reading at its end marker so drain the padding after it.
+		//Anything beyond that is not part of the archive and the command
+		//is stopped rather than left blocked writing it.
+		n, _ := io.Copy(ioutil.Discard, io.LimitReader(out, decompressDrainBytes+1))
+		if n > decompressDrainBytes {
+			log.Warnln("Ignoring data after the end of the archive")
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil
+		}
+		if errWait := cmd.Wait(); errWait != nil {
+			log.Errorln(name, "failed:", strings.TrimSpace(stderr.String()))
+			return errWait
+		}
+		return nil
+	}
+	return out, finish, nil
+}
+
+//cleanEntryName splits the entry name into its components and rejects
+//absolute names and names containing ..
+func cleanEntryName(name string) ([]string, error) {
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) {
+		return nil, ErrUnsafeArchivePath
+	}
+	parts := []string{}
+	for _, part := range strings.Split(name, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return nil, ErrUnsafeArchivePath
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+//relPath returns the entry path below the destination after stripping.
+//An empty result means the entry is skipped.
+func (x *extractor) relPath(name string) (string, error) {
+	parts, err := cleanEntryName(name)
+	if err != nil {
+		log.Warnln("Unsafe archive entry:", name)
+		return "", err
+	}
+	if len(parts) <= x.opts.StripComponents {
+		return "", nil
+	}
+	return path.Join(parts[x.opts.StripComponents:]...), nil
+}
+
+func (x *extractor) included(rel string) bool {
+	if len(x.opts.Include) == 0 {
+		return true
+	}
+	return matchesAny(x.opts.Include, filepath.FromSlash(rel))
+}
+
+//resolveLink follows a symlink target from the directory dir one component
+//at a time, expanding the links already on disk, and fails if it ever goes
+//above the root
+func (x *extractor) resolveLink(dir string, linkname string) error {
+	resolved := []string{}
+	if dir != "." {
+		resolved = strings.Split(dir, "/")
+	}
+	pending := strings.Split(linkname, "/")
+	hops := 0
+	for len(pending) > 0 {
+		part := pending[0]
+		pending = pending[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return ErrUnsafeArchivePath
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		resolved = append(resolved, part)
+		current := filepath.Join(x.root, filepath.FromSlash(path.Join(resolved...)))
+		fi, err := os.Lstat(current)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		hops++
+		if hops > linkMaxHops {
+			return ErrUnsafeArchivePath
+		}
+		target, err := os.Readlink(current)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+			return ErrUnsafeArchivePath
+		}
+		resolved = resolved[:len(resolved)-1]
+		pending = append(strings.Split(target, "/"), pending...)
+	}
+	return nil
+}
+
+//mkdirAll creates the directories of rel below the root one at a time and
+//refuses to go through a symlink so nothing is ever written outside it
+func (x *extractor) mkdirAll(rel string) error {
+	current := x.root
+	if rel == "." || len(rel) == 0 {
+		return nil
+	}
+	for _, part := range strings.Split(rel, "/") {
+		current = filepath.Join(current, part)
+		fi, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			if err = journalSnapshot(current); err != nil {
+				return err
+			}
+			if err = os.Mkdir(current, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			log.Warnln("Refusing to extract through symlink:", current)
+			return ErrUnsafeArchivePath
+		}
+		if !fi.IsDir() {
+			return ErrDstTypeMismatch
+		}
+	}
+	return nil
+}
+
+func (x *extractor) mode(entry *archiveEntry) os.FileMode {
+	mask := os.ModePerm
+	if x.opts.PreserveSpecialBits {
+		mask |= os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	}
+	return entry.mode & mask
+}
+
+func (x *extractor) chown(target string, entry *archiveEntry) error {
+	if !x.opts.PreserveOwner || entry.uid < 0 {
+		return nil
+	}
+	return os.Lchown(target, entry.uid, entry.gid)
+}
+
+//removeExisting clears a file or symlink in the way of a new entry. A
+//directory is never replaced.
+func removeExisting(target string) error {
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return ErrDstTypeMismatch
+	}
+	return os.Remove(target)
+}
+
+func (x *extractor) writeFile(target string, entry *archiveEntry) error {
+	r, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	limit := int64(-1)
+	if x.opts.MaxFileBytes > 0 {
+		limit = x.opts.MaxFileBytes
+	}
+	if x.opts.MaxBytes > 0 && (limit == -1 || x.opts.MaxBytes-x.stats.Bytes < limit) {
+		limit = x.opts.MaxBytes - x.stats.Bytes
+	}
+
+	//written to a temp file and renamed so an existing symlink is replaced
+	//rather than written through
+	tmp, err := ioutil.TempFile(filepath.Dir(target), ".extract.")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	var written int64
+	if limit >= 0 {
+		written, err = io.CopyN(tmp, r, limit+1)
+		if err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = ErrArchiveTooLarge
+		}
+	} else {
+		written, err = io.Copy(tmp, r)
+	}
+	if err == nil {
+		err = tmp.Chmod(x.mode(entry))
+	}
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmpName, target)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	x.stats.Bytes += written
+	x.stats.Files++
+	if err = x.chown(target, entry); err != nil {
+		return err
+	}
+	return os.Chtimes(target, entry.modTime, entry.modTime)
+}
+
+func (x *extractor) add(entry *archiveEntry) error {
+	x.entries++
+	if x.opts.MaxEntries > 0 && x.entries > x.opts.MaxEntries {
+		return ErrArchiveTooLarge
+	}
+
+	rel, err := x.relPath(entry.name)
+	if err != nil {
+		return err
+	}
+	if len(rel) == 0 || !x.included(rel) {
+		x.stats.Skipped++
+		return nil
+	}
+	target := filepath.Join(x.root, filepath.FromSlash(rel))
+
+	if entry.typ == tar.TypeDir {
+		if err = x.mkdirAll(rel); err != nil {
+			return err
+		}
+		if err = journalSnapshot(target); err != nil {
+			return err
+		}
+		x.dirs = append(x.dirs, entry)
+		x.dirPaths = append(x.dirPaths, target)
+		x.stats.Dirs++
+		return nil
+	}
+
+	if err = x.mkdirAll(path.Dir(rel)); err != nil {
+		return err
+	}
+	if err = journalSnapshot(target); err != nil {
+		return err
+	}
+	if err = removeExisting(target); err != nil {
+		return err
+	}
+
+	switch entry.typ {
+	case tar.TypeReg:
+		return x.writeFile(target, entry)
+
+	case tar.TypeSymlink:
+		if filepath.IsAbs(entry.linkname) || strings.HasPrefix(entry.linkname, "/") {
+			log.Warnln("Absolute symlink target:", entry.name, "->", entry.linkname)
+			return ErrUnsafeArchivePath
+		}
+		if err = x.resolveLink(path.Dir(rel), entry.linkname); err != nil {
+			log.Warnln("Symlink escapes destination:", entry.name, "->", entry.linkname)
+			return err
+		}
+		if err = os.Symlink(entry.linkname, target); err != nil {
+			return err
+		}
+		x.symlinks = append(x.symlinks, target)
+		x.stats.Symlinks++
+		return x.chown(target, entry)
+
+	case tar.TypeLink:
+		linkRel, errLink := x.relPath(entry.linkname)
+		if errLink != nil {
+			return errLink
+		}
+		if len(linkRel) == 0 {
+			return ErrUnsafeArchivePath
+		}
+		if err = x.mkdirAll(path.Dir(linkRel)); err != nil {
+			return err
+		}
+		linkTarget := filepath.Join(x.root, filepath.FromSlash(linkRel))
+		fi, errStat := os.Lstat(linkTarget)
+		if errStat != nil || !fi.Mode().IsRegular() {
+			log.Warnln("Hard link target is not an extracted file:", entry.linkname)
+			return ErrUnsafeArchivePath
+		}
+		if err = os.Link(linkTarget, target); err != nil {
+			return err
+		}
+		x.stats.HardLinks++
+		return nil
+	}
+
+	log.Warnln("Skipping special archive entry:", entry.name)
+	x.stats.Skipped++
+	return nil
+}
+
+//finish applies directory modes and times, which extracting into them
+//changes, and checks that no symlink chain resolves outside the root
+func (x *extractor) finish() error {
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		target := x.dirPaths[i]
+		if err := x.chown(target, x.dirs[i]); err != nil {
+			return err
+		}
+		if err := os.Chmod(target, x.mode(x.dirs[i])|0700); err != nil {
+			return err
+		}
+		os.Chtimes(target, x.dirs[i].modTime, x.dirs[i].modTime)
+	}
+
+	//a link that does not resolve may point outside once something is
+	//created there, so it is removed as well
+	var err error
+	for _, link := range x.symlinks {
+		real, errEval := filepath.EvalSymlinks(link)
+		if errEval == nil && (real == x.root || strings.HasPrefix(real, x.root+string(filepath.Separator))) {
+			continue
+		}
+		log.Warnln("Symlink resolves outside destination:", link)
+		os.Remove(link)
+		err = ErrUnsafeArchivePath
+	}
+	return err
+}
+
+func (x *extractor) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		typ := hdr.Typeflag
+		//old tar writers mark regular files with a NUL type
+		if typ == '\x00' {
+			typ = tar.TypeReg
+		}
+		entry := &archiveEntry{
+			name:     hdr.Name,
+			linkname: hdr.Linkname,
+			typ:      typ,
+			mode:     hdr.FileInfo().Mode(),
+			uid:      hdr.Uid,
+			gid:      hdr.Gid,
+			modTime:  hdr.ModTime,
+			open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(tr), nil
+			},
+		}
+		switch typ {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			entry.typ = tar.TypeChar
+		}
+		if err = x.add(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extractor) extractZip(file *os.File) error {
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(file, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, zf := range zr.File {
+		zf := zf
+		mode := zf.Mode()
+		entry := &archiveEntry{
+			name:    strings.Replace(zf.Name, "\\", "/", -1),
+			typ:     tar.TypeReg,
+			mode:    mode,
+			uid:     -1,
+			gid:     -1,
+			modTime: zf.Modified,
+			open:    zf.Open,
+		}
+		if zf.Modified.IsZero() {
+			entry.modTime = zf.ModTime()
+		}
+		switch {
+		case mode.IsDir() || strings.HasSuffix(zf.Name, "/"):
+			entry.typ = tar.TypeDir
+		case mode&os.ModeSymlink != 0:
+			//the link target is the content of the entry
+			rc, errOpen := zf.Open()
+			if errOpen != nil {
+				return errOpen
+			}
+			target, errRead := ioutil.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if errRead != nil {
+				return errRead
+			}
+			entry.typ = tar.TypeSymlink
+			entry.linkname = string(target)
+		case !mode.IsRegular():
+			entry.typ = tar.TypeChar
+		}
+		if err = x.add(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//ExtractArchive extracts a tar (optionally gzip, bzip2, xz or zstd
+//compressed) or zip archive into dst. Entries with absolute paths, ..
+//components or symlinks leading outside dst are rejected. xz and zstd
+//archives need the xz or zstd command.
+func (fs *Fs) ExtractArchive(archive string, dst string, opts *ExtractOptions) (*ExtractStats, error) {
+	log.Debugln("ExtractArchive ENTER")
+	log.Debugln("archive:", archive)
+	log.Debugln("dst:", dst)
+
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+
+	err := journalSnapshot(dst)
+	if err != nil {
+		log.Debugln("journalSnapshot Failed:", err)
+		log.Debugln("ExtractArchive LEAVE")
+		return nil, err
+	}
+	err = os.MkdirAll(dst, 0755)
+	if err != nil {
+		log.Debugln("MkdirAll Failed:", err)
+		log.Debugln("ExtractArchive LEAVE")
+		return nil, err
+	}
+	root, err := filepath.Abs(dst)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		log.Debugln("Resolve dst Failed:", err)
+		log.Debugln("ExtractArchive LEAVE")
+		return nil, err
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		log.Debugln("Open Failed:", err)
+		log.Debugln("ExtractArchive LEAVE")
+		return nil, err
+	}
+	defer file.Close()
+
+	format := opts.Format
+	if len(format) == 0 {
+		format, err = detectArchive(file)
+		if err != nil {
+			log.Debugln("detectArchive Failed:", err)
+			log.Debugln("ExtractArchive LEAVE")
+			return nil, err
+		}
+	}
+	log.Debugln("format:", format)
+
+	x := &extractor{
+		root:  root,
+		opts:  opts,
+		stats: &ExtractStats{},
+	}
+
+	switch format {
+	case ArchiveZip:
+		err = x.extractZip(file)
+	case ArchiveTar:
+		err = x.extractTar(bufio.NewReader(file))
+	case ArchiveTarGz:
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(bufio.NewReader(file))
+		if err == nil {
+			err = x.extractTar(gz)
+			gz.Close()
+		}
+	case ArchiveTarBz2:
+		err = x.extractTar(bzip2.NewReader(bufio.NewReader(file)))
+	case ArchiveTarXz, ArchiveTarZst:
+		name := "xz"
+		if format == ArchiveTarZst {
+			name = "zstd"
+		}
+		out, finish, errCmd := decompressCommand(name, file)
+		err = errCmd
+		if err == nil {
+			err = x.extractTar(out)
+			if errFinish := finish(err != nil); err == nil {
+				err = errFinish
+			}
+		}
+	default:
+		err = ErrUnsupportedArchive
+	}
+	if err == nil {
+		err = x.finish()
+	}
+	if err != nil {
+		log.Debugln("Extract Failed:", err)
+		log.Debugln("ExtractArchive LEAVE")
+		return x.stats, err
+	}
+
+	log.Debugln("ExtractArchive Files:", x.stats.Files, "Dirs:", x.stats.Dirs, "Bytes:", x.stats.Bytes)
+	log.Debugln("ExtractArchive LEAVE")
+	return x.stats, nil
+}
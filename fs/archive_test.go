@@ -0,0 +1,198 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+type testTarEntry struct {
+	name     string
+	typ      byte
+	linkname string
+	body     string
+	mode     int64
+}
+
+func writeTestTarGz(t *testing.T, path string, entries []testTarEntry) {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typ,
+			Linkname: e.linkname,
+			Mode:     e.mode,
+			Size:     int64(len(e.body)),
+			ModTime:  time.Unix(1500000000, 0),
+		}
+		assert.Equal(t, nil, tw.WriteHeader(hdr))
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+	gz.Close()
+	ioutil.WriteFile(path, buffer.Bytes(), 0644)
+}
+
+func TestExtractTarGz(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "app.tgz")
+	writeTestTarGz(t, archive, []testTarEntry{
+		{name: "app-1.0/", typ: tar.TypeDir, mode: 0750},
+		{name: "app-1.0/bin/app", typ: tar.TypeReg, body: "#!/bin/sh\n", mode: 04755},
+		{name: "app-1.0/conf/app.conf", typ: tar.TypeReg, body: "port=80\n", mode: 0644},
+		{name: "app-1.0/conf/default.conf", typ: tar.TypeLink, linkname: "app-1.0/conf/app.conf"},
+		{name: "app-1.0/current", typ: tar.TypeSymlink, linkname: "bin/app"},
+		{name: "app-1.0/README", typ: tar.TypeReg, body: "docs\n", mode: 0644},
+	})
+
+	dst := filepath.Join(dir, "out")
+	stats, err := fs.ExtractArchive(archive, dst, &ExtractOptions{
+		StripComponents: 1,
+		Include:         []string{"bin/*", "conf/*", "current"},
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, stats.Files)
+	assert.Equal(t, 1, stats.HardLinks)
+	assert.Equal(t, 1, stats.Symlinks)
+	assert.Equal(t, 2, stats.Skipped)
+
+	info, _ := os.Stat(filepath.Join(dst, "bin", "app"))
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	assert.Equal(t, os.FileMode(0), info.Mode()&os.ModeSetuid)
+	assert.Equal(t, int64(1500000000), info.ModTime().Unix())
+	linkInfo, _ := os.Stat(filepath.Join(dst, "conf", "default.conf"))
+	appInfo, _ := os.Stat(filepath.Join(dst, "conf", "app.conf"))
+	assert.True(t, os.SameFile(appInfo, linkInfo))
+	target, _ := os.Readlink(filepath.Join(dst, "current"))
+	assert.Equal(t, "bin/app", target)
+	_, err = os.Stat(filepath.Join(dst, "README"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = fs.ExtractArchive(archive, filepath.Join(dir, "small"), &ExtractOptions{MaxBytes: 12})
+	assert.Equal(t, ErrArchiveTooLarge, err)
+}
+
+func TestExtractUnsafeTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	unsafe := [][]testTarEntry{
+		{{name: "../evil", typ: tar.TypeReg, body: "x", mode: 0644}},
+		{{name: "/etc/evil", typ: tar.TypeReg, body: "x", mode: 0644}},
+		{{name: "link", typ: tar.TypeSymlink, linkname: "../../etc"}},
+		{{name: "link", typ: tar.TypeSymlink, linkname: "/etc"}},
+		{{name: "hard", typ: tar.TypeLink, linkname: "/etc/passwd"}},
+		{{name: "y", typ: tar.TypeSymlink, linkname: "."}, {name: "z", typ: tar.TypeSymlink, linkname: "y/.."}},
+		{{name: "s1", typ: tar.TypeSymlink, linkname: "."}, {name: "s2", typ: tar.TypeSymlink, linkname: "s1/../victim"}},
+	}
+	for i, entries := range unsafe {
+		archive := filepath.Join(dir, "bad.tgz")
+		writeTestTarGz(t, archive, entries)
+		dst := filepath.Join(dir, "out", string(rune('a'+i)))
+		_, err = fs.ExtractArchive(archive, dst, nil)
+		assert.Equal(t, ErrUnsafeArchivePath, err, entries[len(entries)-1].name)
+	}
+	_, err = os.Stat(filepath.Join(dir, "out", "evil"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(dir, "out", "g", "s2"))
+	assert.True(t, os.IsNotExist(err))
+
+	//the link is checked before the one it goes through exists
+	archive := filepath.Join(dir, "late.tgz")
+	writeTestTarGz(t, archive, []testTarEntry{
+		{name: "s2", typ: tar.TypeSymlink, linkname: "s1/../victim"},
+		{name: "s3", typ: tar.TypeSymlink, linkname: "s1/../other"},
+		{name: "s1", typ: tar.TypeSymlink, linkname: "."},
+	})
+	lateDst := filepath.Join(dir, "out", "late")
+	_, err = fs.ExtractArchive(archive, lateDst, nil)
+	assert.Equal(t, ErrUnsafeArchivePath, err)
+	_, err = os.Lstat(filepath.Join(lateDst, "s2"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(lateDst, "s3"))
+	assert.True(t, os.IsNotExist(err))
+
+	dst := filepath.Join(dir, "preexisting")
+	os.MkdirAll(dst, 0755)
+	os.Symlink(dir, filepath.Join(dst, "escape"))
+	archive = filepath.Join(dir, "through.tgz")
+	writeTestTarGz(t, archive, []testTarEntry{{name: "escape/owned", typ: tar.TypeReg, body: "x", mode: 0644}})
+	_, err = fs.ExtractArchive(archive, dst, nil)
+	assert.Equal(t, ErrUnsafeArchivePath, err)
+	_, err = os.Stat(filepath.Join(dir, "owned"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractZip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	var buffer bytes.Buffer
+	zw := zip.NewWriter(&buffer)
+	w, _ := zw.Create("plugin/plugin.so")
+	w.Write([]byte("elf"))
+	zw.Close()
+	archive := filepath.Join(dir, "plugin.zip")
+	ioutil.WriteFile(archive, buffer.Bytes(), 0644)
+
+	dst := filepath.Join(dir, "out")
+	stats, err := fs.ExtractArchive(archive, dst, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, stats.Files)
+	data, _ := ioutil.ReadFile(filepath.Join(dst, "plugin", "plugin.so"))
+	assert.Equal(t, "elf", string(data))
+
+	buffer.Reset()
+	zw = zip.NewWriter(&buffer)
+	w, _ = zw.Create("..\\..\\evil.so")
+	w.Write([]byte("elf"))
+	zw.Close()
+	ioutil.WriteFile(archive, buffer.Bytes(), 0644)
+	_, err = fs.ExtractArchive(archive, dst, nil)
+	assert.Equal(t, ErrUnsafeArchivePath, err)
+}
+
+func TestDecompressTrailingData(t *testing.T) {
+	if _, err := exec.LookPath("xz"); err != nil {
+		t.Skip("xz is not installed")
+	}
+
+	//more output than is drained after the archive must not block forever
+	cmd := exec.Command("xz", "-z", "-c")
+	cmd.Stdin = bytes.NewReader(make([]byte, 4*decompressDrainBytes))
+	compressed, err := cmd.Output()
+	assert.Equal(t, nil, err)
+
+	out, finish, err := decompressCommand("xz", bytes.NewReader(compressed))
+	assert.Equal(t, nil, err)
+	_, err = io.ReadFull(out, make([]byte, 512))
+	assert.Equal(t, nil, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- finish(false)
+	}()
+	select {
+	case err = <-done:
+		assert.Equal(t, nil, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("finish did not return")
+	}
+}
@@ -0,0 +1,193 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//writeFileAtomic writes the contents of r to a temp file next to path, syncs
+//it, applies the mode and owner and renames it over path so readers see
+//either the old or the new file but never a partial one. A mode of 0 keeps
+//the mode of the existing file (0644 for a new one) and a uid or gid of -1
+//keeps the existing owner. Symlinks are followed so the link itself is kept.
+func writeFileAtomic(path string, r io.Reader, mode os.FileMode, uid int, gid int) error {
+	target := path
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		target = real
+	}
+	if err := journalSnapshot(target); err != nil {
+		return err
+	}
+	return replaceFile(target, r, mode, uid, gid)
+}
+
+//replaceFile is writeFileAtomic for a target that is not a symlink and
+//without recording it in the journal
+func replaceFile(target string, r io.Reader, mode os.FileMode, uid int, gid int) error {
+	fi, err := os.Stat(target)
+	if err == nil {
+		if !fi.Mode().IsRegular() {
+			return ErrDstNotRegularFile
+		}
+		if mode == 0 {
+			mode = fi.Mode().Perm()
+		}
+		if curUID, curGID, ok := fileOwner(fi); ok {
+			if uid == -1 {
+				uid = curUID
+			}
+			if gid == -1 {
+				gid = curGID
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+
+	dir := filepath.Dir(target)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(target)+".")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil && (uid != -1 || gid != -1) {
+		if tfi, errStat := tmp.Stat(); errStat == nil {
+			tmpUID, tmpGID, _ := fileOwner(tfi)
+			if uid != tmpUID || gid != tmpGID {
+				err = tmp.Chown(uid, gid)
+			}
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmpName, target)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	//the rename is only durable once the directory entry is on disk
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if errClose := d.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+//WriteFileAtomic atomically replaces the file with data. Like
+//ioutil.WriteFile, perm is only used when the file does not exist yet and an
+//existing file keeps its mode and owner.
+func (fs *Fs) WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	log.Debugln("WriteFileAtomic ENTER")
+	log.Debugln("path:", path)
+
+	mode := perm
+	if _, err := os.Stat(path); err == nil {
+		mode = 0
+	}
+
+	err := writeFileAtomic(path, bytes.NewReader(data), mode, -1, -1)
+	if err != nil {
+		log.Debugln("writeFileAtomic Failed:", err)
+		log.Debugln("WriteFileAtomic LEAVE")
+		return err
+	}
+
+	log.Debugln("WriteFileAtomic succeeded")
+	log.Debugln("WriteFileAtomic LEAVE")
+	return nil
+}
+
+//WriteFileAtomicEx atomically replaces the file with the contents of r and
+//sets its mode and owner. A mode of 0 keeps the existing mode (0644 for a new
+//file) and a uid or gid of -1 keeps the existing owner.
+func (fs *Fs) WriteFileAtomicEx(path string, r io.Reader, mode os.FileMode, uid int, gid int) error {
+	log.Debugln("WriteFileAtomicEx ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("mode:", mode)
+	log.Debugln("uid:", uid)
+	log.Debugln("gid:", gid)
+
+	err := writeFileAtomic(path, r, mode, uid, gid)
+	if err != nil {
+		log.Debugln("writeFileAtomic Failed:", err)
+		log.Debugln("WriteFileAtomicEx LEAVE")
+		return err
+	}
+
+	log.Debugln("WriteFileAtomicEx succeeded")
+	log.Debugln("WriteFileAtomicEx LEAVE")
+	return nil
+}
+
+//CopyFileAtomic copies the src file over the dst file atomically. A mode of 0
+//keeps the mode of an existing dst file or uses the mode of src for a new
+//one. An existing dst file keeps its owner.
+func (fs *Fs) CopyFileAtomic(src string, dst string, mode os.FileMode) error {
+	log.Debugln("CopyFileAtomic ENTER")
+	log.Debugln("SRC:", src)
+	log.Debugln("DST:", dst)
+
+	sfi, err := os.Stat(src)
+	if err != nil {
+		log.Debugln("Src Stat Failed:", err)
+		log.Debugln("CopyFileAtomic LEAVE")
+		return ErrSrcNotExist
+	}
+	if !sfi.Mode().IsRegular() {
+		log.Debugln("Src file is not regular")
+		log.Debugln("CopyFileAtomic LEAVE")
+		return ErrSrcNotRegularFile
+	}
+	if dfi, errStat := os.Stat(dst); errStat == nil {
+		if os.SameFile(sfi, dfi) {
+			log.Debugln("Src and Dst files are the same")
+			log.Debugln("CopyFileAtomic LEAVE")
+			return nil
+		}
+	} else if mode == 0 {
+		mode = sfi.Mode().Perm()
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		log.Debugln("Failed to open SRC file:", err)
+		log.Debugln("CopyFileAtomic LEAVE")
+		return err
+	}
+	defer in.Close()
+
+	err = writeFileAtomic(dst, in, mode, -1, -1)
+	if err != nil {
+		log.Debugln("writeFileAtomic Failed:", err)
+		log.Debugln("CopyFileAtomic LEAVE")
+		return err
+	}
+
+	log.Debugln("CopyFileAtomic succeeded")
+	log.Debugln("CopyFileAtomic LEAVE")
+	return nil
+}
@@ -0,0 +1,72 @@
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "service")
+	err = fs.WriteFileAtomic(path, []byte("#!/bin/sh\n"), 0755)
+	assert.Equal(t, nil, err)
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	err = fs.WriteFileAtomic(path, []byte("#!/bin/bash\n"), 0600)
+	assert.Equal(t, nil, err)
+	info, _ = os.Stat(path)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	link := filepath.Join(dir, "link")
+	os.Symlink(path, link)
+	err = fs.WriteFileAtomicEx(link, bytes.NewReader([]byte("exit 0\n")), 0700, -1, -1)
+	assert.Equal(t, nil, err)
+	linkInfo, _ := os.Lstat(link)
+	assert.True(t, linkInfo.Mode()&os.ModeSymlink != 0)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "exit 0\n", string(data))
+	info, _ = os.Stat(path)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	err = fs.WriteFileAtomic(dir, []byte("x"), 0644)
+	assert.Equal(t, ErrDstNotRegularFile, err)
+
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 2, len(entries))
+}
+
+func TestCopyFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	ioutil.WriteFile(src, []byte("new\n"), 0600)
+
+	err = fs.CopyFileAtomic(src, dst, 0)
+	assert.Equal(t, nil, err)
+	info, _ := os.Stat(dst)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	os.Chmod(dst, 0755)
+	ioutil.WriteFile(src, []byte("newer\n"), 0600)
+	err = fs.CopyFileAtomic(src, dst, 0)
+	assert.Equal(t, nil, err)
+	info, _ = os.Stat(dst)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	data, _ := ioutil.ReadFile(dst)
+	assert.Equal(t, "newer\n", string(data))
+
+	err = fs.CopyFileAtomic(filepath.Join(dir, "missing"), dst, 0)
+	assert.Equal(t, ErrSrcNotExist, err)
+}
@@ -0,0 +1,365 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//DigestSHA256 is the SHA-256 digest
+	DigestSHA256 = "sha256"
+
+	//DigestSHA512 is the SHA-512 digest
+	DigestSHA512 = "sha512"
+
+	//DigestMD5 is the MD5 digest. It only detects corruption and must not be
+	//relied on against tampering.
+	DigestMD5 = "md5"
+)
+
+var (
+	//ErrUnsupportedDigest the digest algorithm is not supported
+	ErrUnsupportedDigest = errors.New("Unsupported digest algorithm")
+
+	//ErrChecksumMismatch the file does not match the expected digest
+	ErrChecksumMismatch = errors.New("Checksum does not match")
+
+	//ErrInvalidManifest the checksum manifest could not be parsed
+	ErrInvalidManifest = errors.New("Invalid checksum manifest")
+
+	//ErrNotInManifest the file is not listed in the checksum manifest
+	ErrNotInManifest = errors.New("File is not listed in the checksum manifest")
+
+	//ErrAmbiguousManifest more than one manifest entry has the file's name
+	//and none has its path
+	ErrAmbiguousManifest = errors.New("File name matches more than one manifest entry")
+
+	//GNU coreutils: "<hex>  <file>" or "<hex> *<file>"
+	gnuSumRegex = regexp.MustCompile("^\\\\?([0-9a-fA-F]+) [ *](.+)$")
+
+	//BSD and "sha256sum --tag": "SHA256 (<file>) = <hex>"
+	bsdSumRegex = regexp.MustCompile("^([A-Za-z0-9\\-]+) \\((.+)\\) = ([0-9a-fA-F]+)$")
+)
+
+//ManifestEntry is a line in a SHA256SUMS style manifest
+type ManifestEntry struct {
+	Algorithm string
+	Digest    string
+	File      string
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(strings.Replace(algorithm, "-", "", -1)) {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	case DigestMD5:
+		return md5.New(), nil
+	}
+	return nil, ErrUnsupportedDigest
+}
+
+//digestForLength guesses the algorithm from the length of a hex digest
+func digestForLength(digest string) string {
+	switch len(digest) {
+	case md5.Size * 2:
+		return DigestMD5
+	case sha256.Size * 2:
+		return DigestSHA256
+	case sha512.Size * 2:
+		return DigestSHA512
+	}
+	return ""
+}
+
+func checksumReader(r io.Reader, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func checksumFile(path string, algorithm string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return checksumReader(file, algorithm)
+}
+
+//unescapeName decodes the \n and \\ escapes of a GNU manifest name in one
+//pass so an escaped backslash followed by n stays a backslash and an n
+func unescapeName(name string) string {
+	var buffer bytes.Buffer
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+1 < len(name) {
+			switch name[i+1] {
+			case 'n':
+				buffer.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				buffer.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		buffer.WriteByte(name[i])
+	}
+	return buffer.String()
+}
+
+func parseManifest(r io.Reader) ([]*ManifestEntry, error) {
+	list := []*ManifestEntry{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if m := bsdSumRegex.FindStringSubmatch(line); m != nil {
+			list = append(list, &ManifestEntry{
+				Algorithm: strings.ToLower(strings.Replace(m[1], "-", "", -1)),
+				Digest:    strings.ToLower(m[3]),
+				File:      m[2],
+			})
+			continue
+		}
+		if m := gnuSumRegex.FindStringSubmatch(line); m != nil {
+			file := m[2]
+			//a leading backslash means the name has escaped newlines or backslashes
+			if strings.HasPrefix(line, "\\") {
+				file = unescapeName(file)
+			}
+			list = append(list, &ManifestEntry{
+				Algorithm: digestForLength(m[1]),
+				Digest:    strings.ToLower(m[1]),
+				File:      file,
+			})
+			continue
+		}
+		return nil, ErrInvalidManifest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//ChecksumReader returns the hex digest of everything read from r
+func (fs *Fs) ChecksumReader(r io.Reader, algorithm string) (string, error) {
+	log.Debugln("ChecksumReader ENTER")
+	log.Debugln("algorithm:", algorithm)
+
+	digest, err := checksumReader(r, algorithm)
+	if err != nil {
+		log.Debugln("checksumReader Failed:", err)
+		log.Debugln("ChecksumReader LEAVE")
+		return "", err
+	}
+
+	log.Debugln("ChecksumReader =", digest)
+	log.Debugln("ChecksumReader LEAVE")
+	return digest, nil
+}
+
+//ChecksumFile returns the hex digest of the file using sha256, sha512 or md5
+func (fs *Fs) ChecksumFile(path string, algorithm string) (string, error) {
+	log.Debugln("ChecksumFile ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("algorithm:", algorithm)
+
+	digest, err := checksumFile(path, algorithm)
+	if err != nil {
+		log.Debugln("checksumFile Failed:", err)
+		log.Debugln("ChecksumFile LEAVE")
+		return "", err
+	}
+
+	log.Debugln("ChecksumFile =", digest)
+	log.Debugln("ChecksumFile LEAVE")
+	return digest, nil
+}
+
+//VerifyFile returns ErrChecksumMismatch if the file does not match the
+//expected hex digest. An empty algorithm is guessed from the digest length.
+func (fs *Fs) VerifyFile(path string, algorithm string, expected string) error {
+	log.Debugln("VerifyFile ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("algorithm:", algorithm)
+	log.Debugln("expected:", expected)
+
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if len(algorithm) == 0 {
+		algorithm = digestForLength(expected)
+	}
+
+	digest, err := checksumFile(path, algorithm)
+	if err != nil {
+		log.Debugln("checksumFile Failed:", err)
+		log.Debugln("VerifyFile LEAVE")
+		return err
+	}
+	if digest != expected {
+		log.Debugln("Checksum mismatch:", digest)
+		log.Debugln("VerifyFile LEAVE")
+		return ErrChecksumMismatch
+	}
+
+	log.Debugln("VerifyFile succeeded")
+	log.Debugln("VerifyFile LEAVE")
+	return nil
+}
+
+//ReadManifest parses a SHA256SUMS style manifest in either the GNU
+//("<digest>  <file>") or the BSD ("SHA256 (<file>) = <digest>") format
+func (fs *Fs) ReadManifest(manifest string) ([]*ManifestEntry, error) {
+	log.Debugln("ReadManifest ENTER")
+	log.Debugln("manifest:", manifest)
+
+	file, err := os.Open(manifest)
+	if err != nil {
+		log.Debugln("Open Failed:", err)
+		log.Debugln("ReadManifest LEAVE")
+		return nil, err
+	}
+	defer file.Close()
+
+	list, err := parseManifest(file)
+	if err != nil {
+		log.Debugln("parseManifest Failed:", err)
+		log.Debugln("ReadManifest LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("ReadManifest Count:", len(list))
+	log.Debugln("ReadManifest LEAVE")
+	return list, nil
+}
+
+//VerifyFileWithManifest verifies the file against its entry in the
+//manifest. The entry whose path, relative to the manifest's directory, is
+//the file is used. Failing that, an entry with the same base name is used
+//if there is exactly one.
+func (fs *Fs) VerifyFileWithManifest(path string, manifest string) error {
+	log.Debugln("VerifyFileWithManifest ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("manifest:", manifest)
+
+	entries, err := fs.ReadManifest(manifest)
+	if err != nil {
+		log.Debugln("ReadManifest Failed:", err)
+		log.Debugln("VerifyFileWithManifest LEAVE")
+		return err
+	}
+
+	target, err := filepath.Abs(path)
+	if err != nil {
+		log.Debugln("Abs Failed:", err)
+		log.Debugln("VerifyFileWithManifest LEAVE")
+		return err
+	}
+	dir, err := filepath.Abs(filepath.Dir(manifest))
+	if err != nil {
+		log.Debugln("Abs Failed:", err)
+		log.Debugln("VerifyFileWithManifest LEAVE")
+		return err
+	}
+
+	var found *ManifestEntry
+	sameName := []*ManifestEntry{}
+	for _, entry := range entries {
+		entryPath := entry.File
+		if !filepath.IsAbs(entryPath) {
+			entryPath = filepath.Join(dir, entryPath)
+		}
+		if filepath.Clean(entryPath) == target {
+			found = entry
+			break
+		}
+		if filepath.Base(entry.File) == filepath.Base(target) {
+			sameName = append(sameName, entry)
+		}
+	}
+	if found == nil && len(sameName) > 1 {
+		log.Debugln("File name is ambiguous in manifest")
+		log.Debugln("VerifyFileWithManifest LEAVE")
+		return ErrAmbiguousManifest
+	}
+	if found == nil && len(sameName) == 1 {
+		found = sameName[0]
+	}
+	if found == nil {
+		log.Debugln("File not in manifest")
+		log.Debugln("VerifyFileWithManifest LEAVE")
+		return ErrNotInManifest
+	}
+
+	err = fs.VerifyFile(path, found.Algorithm, found.Digest)
+	log.Debugln("VerifyFileWithManifest LEAVE")
+	return err
+}
+
+//VerifyManifest verifies every file listed in the manifest. Relative paths
+//are resolved from the manifest's directory. Returns the files that are
+//missing or do not match; the error is ErrChecksumMismatch if there are any.
+func (fs *Fs) VerifyManifest(manifest string) ([]string, error) {
+	log.Debugln("VerifyManifest ENTER")
+	log.Debugln("manifest:", manifest)
+
+	entries, err := fs.ReadManifest(manifest)
+	if err != nil {
+		log.Debugln("ReadManifest Failed:", err)
+		log.Debugln("VerifyManifest LEAVE")
+		return nil, err
+	}
+
+	failed := []string{}
+	dir := filepath.Dir(manifest)
+	for _, entry := range entries {
+		path := entry.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		errVerify := fs.VerifyFile(path, entry.Algorithm, entry.Digest)
+		if errVerify == ErrUnsupportedDigest {
+			log.Debugln("Unsupported digest for", entry.File)
+			log.Debugln("VerifyManifest LEAVE")
+			return nil, errVerify
+		}
+		if errVerify != nil {
+			log.Warnln("Verify failed:", entry.File, "Err:", errVerify)
+			failed = append(failed, entry.File)
+		}
+	}
+
+	if len(failed) > 0 {
+		log.Debugln("VerifyManifest Failed:", len(failed))
+		log.Debugln("VerifyManifest LEAVE")
+		return failed, ErrChecksumMismatch
+	}
+
+	log.Debugln("VerifyManifest succeeded")
+	log.Debugln("VerifyManifest LEAVE")
+	return failed, nil
+}
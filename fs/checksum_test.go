@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+const helloSHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+func TestChecksum(t *testing.T) {
+	digest, err := fs.ChecksumReader(strings.NewReader("hello\n"), DigestSHA256)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, helloSHA256, digest)
+
+	digest, err = fs.ChecksumReader(strings.NewReader("hello\n"), "MD5")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "b1946ac92492d2347c6235b4d2611184", digest)
+
+	_, err = fs.ChecksumReader(strings.NewReader("hello\n"), "crc32")
+	assert.Equal(t, ErrUnsupportedDigest, err)
+}
+
+func TestVerifyManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksum")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "pkg.deb"), []byte("hello\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "pkg.rpm"), []byte("tampered\n"), 0644)
+	manifest := filepath.Join(dir, "SHA256SUMS")
+	ioutil.WriteFile(manifest, []byte(helloSHA256+"  pkg.deb\n"+
+		"SHA256 (pkg.rpm) = "+strings.ToUpper(helloSHA256)+"\n"), 0644)
+
+	assert.Equal(t, nil, fs.VerifyFile(filepath.Join(dir, "pkg.deb"), "", strings.ToUpper(helloSHA256)))
+	assert.Equal(t, nil, fs.VerifyFileWithManifest(filepath.Join(dir, "pkg.deb"), manifest))
+	assert.Equal(t, ErrChecksumMismatch, fs.VerifyFileWithManifest(filepath.Join(dir, "pkg.rpm"), manifest))
+	assert.Equal(t, ErrNotInManifest, fs.VerifyFileWithManifest(filepath.Join(dir, "pkg.tgz"), manifest))
+
+	failed, err := fs.VerifyManifest(manifest)
+	assert.Equal(t, ErrChecksumMismatch, err)
+	assert.Equal(t, []string{"pkg.rpm"}, failed)
+
+	//the entry with the file's path wins over others with the same name
+	os.MkdirAll(filepath.Join(dir, "a"), 0755)
+	os.MkdirAll(filepath.Join(dir, "b"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "a", "pkg.deb"), []byte("hello\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b", "pkg.deb"), []byte("tampered\n"), 0644)
+	nested := filepath.Join(dir, "NESTEDSUMS")
+	ioutil.WriteFile(nested, []byte(helloSHA256+"  a/pkg.deb\n"+helloSHA256+"  b/pkg.deb\n"), 0644)
+	assert.Equal(t, nil, fs.VerifyFileWithManifest(filepath.Join(dir, "a", "pkg.deb"), nested))
+	assert.Equal(t, ErrChecksumMismatch, fs.VerifyFileWithManifest(filepath.Join(dir, "b", "pkg.deb"), nested))
+	assert.Equal(t, ErrAmbiguousManifest, fs.VerifyFileWithManifest(filepath.Join(dir, "pkg.deb"), nested))
+
+	entries, err := parseManifest(strings.NewReader("\\" + helloSHA256 + "  a\\\\n\\nb\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a\\n\nb", entries[0].File)
+
+	ioutil.WriteFile(manifest, []byte("not a manifest\n"), 0644)
+	_, err = fs.VerifyManifest(manifest)
+	assert.Equal(t, ErrInvalidManifest, err)
+}
+
+func TestCopyFileExVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checksum")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	ioutil.WriteFile(src, []byte("hello\n"), 0644)
+
+	err = fs.CopyFileEx(src, dst, 0644, &CopyFileOptions{Verify: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, fs.VerifyFile(dst, DigestSHA256, helloSHA256))
+
+	err = fs.CopyFileEx(src, dst, 0644, &CopyFileOptions{Verify: true, Algorithm: "sha1"})
+	assert.Equal(t, ErrUnsupportedDigest, err)
+}
@@ -0,0 +1,451 @@
+package fs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//CopyActionCopy the file, directory or symlink was copied
+	CopyActionCopy = "copy"
+
+	//CopyActionLink the file was hard linked to an earlier copy
+	CopyActionLink = "link"
+
+	//CopyActionSkip the destination was already up to date
+	CopyActionSkip = "skip"
+
+	//CopyActionDelete the destination entry does not exist in the source
+	CopyActionDelete = "delete"
+)
+
+var (
+	//ErrCopyIntoSelf the destination is inside the source directory
+	ErrCopyIntoSelf = errors.New("Destination is inside the source directory")
+
+	//ErrDstTypeMismatch the destination exists with a different file type
+	ErrDstTypeMismatch = errors.New("Destination exists with a different file type")
+)
+
+//CopyTreeOptions configures CopyTree. Permissions are always copied.
+type CopyTreeOptions struct {
+	//FollowSymlinks copies what symlinks point to instead of the links
+	FollowSymlinks bool
+
+	//PreserveHardLinks links files that are hard links of each other in the
+	//source to a single copy
+	PreserveHardLinks bool
+
+	//PreserveOwner copies the owner and group. This usually requires root.
+	PreserveOwner bool
+
+	//PreserveTimes copies access and modification times
+	PreserveTimes bool
+
+	//PreserveXattrs copies extended attributes, which include POSIX ACLs.
+	//Only supported on Linux.
+	PreserveXattrs bool
+
+	//Include, when set, only copies files matching one of the globs.
+	//Directories are always traversed.
+	Include []string
+
+	//Exclude skips files and directories matching one of the globs. Globs
+	//are matched against the path relative to the source and its base name.
+	Exclude []string
+
+	//Sync skips files whose size and modification time match the
+	//destination. Times are preserved so later syncs can compare them.
+	Sync bool
+
+	//Delete removes destination entries that do not exist in the source.
+	//Excluded entries are left alone.
+	Delete bool
+
+	//Progress is called for every entry copied, linked, skipped or deleted
+	Progress func(event *CopyEvent)
+}
+
+//CopyEvent describes an entry handled by CopyTree
+type CopyEvent struct {
+	//Path is relative to the source (or destination for deletes)
+	Path   string
+	Action string
+	Bytes  int64
+}
+
+//CopyTreeStats summarizes a CopyTree run
+type CopyTreeStats struct {
+	Copied  int
+	Linked  int
+	Skipped int
+	Deleted int
+	Bytes   int64
+}
+
+//fileKey identifies a file for hard link detection
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+type treeCopier struct {
+	opts      *CopyTreeOptions
+	stats     *CopyTreeStats
+	links     map[fileKey]string
+	ancestors map[string]bool
+}
+
+func matchesAny(globs []string, rel string) bool {
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//filtered returns true if the entry is left out of the copy
+func (c *treeCopier) filtered(rel string, isDir bool) bool {
+	if matchesAny(c.opts.Exclude, rel) {
+		return true
+	}
+	return !isDir && len(c.opts.Include) > 0 && !matchesAny(c.opts.Include, rel)
+}
+
+func (c *treeCopier) event(rel string, action string, bytes int64) {
+	log.Debugln("CopyTree", action, rel)
+	if c.opts.Progress != nil {
+		c.opts.Progress(&CopyEvent{Path: rel, Action: action, Bytes: bytes})
+	}
+}
+
+//prepareDst removes a destination of a different type when deleting is
+//allowed. Returns the destination info if it still exists.
+func (c *treeCopier) prepareDst(dst string, sameType func(os.FileInfo) bool) (os.FileInfo, error) {
+	dfi, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sameType(dfi) {
+		return dfi, nil
+	}
+	if !c.opts.Delete {
+		return nil, ErrDstTypeMismatch
+	}
+	if err = journalSnapshotTree(dst); err != nil {
+		return nil, err
+	}
+	return nil, os.RemoveAll(dst)
+}
+
+//applyMetadata copies owner, mode, xattrs and times from the source
+func (c *treeCopier) applyMetadata(src string, dst string, fi os.FileInfo) error {
+	if c.opts.PreserveOwner {
+		if uid, gid, ok := fileOwner(fi); ok {
+			if err := os.Lchown(dst, uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	mode := fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if err := os.Chmod(dst, mode); err != nil {
+		return err
+	}
+	if c.opts.PreserveXattrs {
+		if err := copyXattrs(src, dst); err != nil {
+			return err
+		}
+	}
+	if c.opts.PreserveTimes || c.opts.Sync {
+		if err := os.Chtimes(dst, fileAtime(fi), fi.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *treeCopier) copyEntry(rel string, src string, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if !c.opts.FollowSymlinks {
+			return c.copySymlink(rel, src, dst, fi)
+		}
+		fi, err = os.Stat(src)
+		if err != nil {
+			log.Warnln("Skipping dangling symlink:", src)
+			return nil
+		}
+	}
+
+	switch {
+	case fi.IsDir():
+		return c.copyDir(rel, src, dst, fi)
+	case fi.Mode().IsRegular():
+		return c.copyFile(rel, src, dst, fi)
+	}
+
+	log.Warnln("Skipping special file:", src)
+	return nil
+}
+
+func (c *treeCopier) copySymlink(rel string, src string, dst string, fi os.FileInfo) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+
+	dfi, err := c.prepareDst(dst, func(dfi os.FileInfo) bool { return !dfi.IsDir() })
+	if err != nil {
+		return err
+	}
+	if dfi != nil {
+		if current, errLink := os.Readlink(dst); errLink == nil && current == target {
+			c.stats.Skipped++
+			c.event(rel, CopyActionSkip, 0)
+			return nil
+		}
+	}
+
+	if err = journalSnapshot(dst); err != nil {
+		return err
+	}
+	if dfi != nil {
+		if err = os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err = os.Symlink(target, dst); err != nil {
+		return err
+	}
+	if err = c.applyMetadata(src, dst, fi); err != nil {
+		return err
+	}
+	c.stats.Copied++
+	c.event(rel, CopyActionCopy, 0)
+	return nil
+}
+
+func (c *treeCopier) copyFile(rel string, src string, dst string, fi os.FileInfo) error {
+	dfi, err := c.prepareDst(dst, func(dfi os.FileInfo) bool { return dfi.Mode().IsRegular() })
+	if err != nil {
+		return err
+	}
+
+	var key fileKey
+	linked := false
+	if c.opts.PreserveHardLinks {
+		var nlink uint64
+		key, nlink, linked = fileLinkKey(fi)
+		linked = linked && nlink > 1
+		if first, ok := c.links[key]; linked && ok {
+			if dfi != nil {
+				if ffi, errStat := os.Stat(first); errStat == nil && os.SameFile(ffi, dfi) {
+					c.stats.Skipped++
+					c.event(rel, CopyActionSkip, 0)
+					return nil
+				}
+				if err = journalSnapshot(dst); err != nil {
+					return err
+				}
+				if err = os.Remove(dst); err != nil {
+					return err
+				}
+			}
+			if err = journalSnapshot(dst); err != nil {
+				return err
+			}
+			if err = os.Link(first, dst); err != nil {
+				return err
+			}
+			c.stats.Linked++
+			c.event(rel, CopyActionLink, 0)
+			return nil
+		}
+	}
+
+	if c.opts.Sync && dfi != nil && dfi.Size() == fi.Size() && dfi.ModTime().Unix() == fi.ModTime().Unix() {
+		if err = journalSnapshot(dst); err != nil {
+			return err
+		}
+		if err = c.applyMetadata(src, dst, fi); err != nil {
+			return err
+		}
+		if linked {
+			c.links[key] = dst
+		}
+		c.stats.Skipped++
+		c.event(rel, CopyActionSkip, 0)
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	//the mode passed is never 0 so an existing file's mode is not kept. The
+	//real mode is applied with the rest of the metadata.
+	err = writeFileAtomic(dst, in, fi.Mode().Perm()|0200, -1, -1)
+	in.Close()
+	if err != nil {
+		return err
+	}
+	if err = c.applyMetadata(src, dst, fi); err != nil {
+		return err
+	}
+
+	if linked {
+		c.links[key] = dst
+	}
+	c.stats.Copied++
+	c.stats.Bytes += fi.Size()
+	c.event(rel, CopyActionCopy, fi.Size())
+	return nil
+}
+
+func (c *treeCopier) copyDir(rel string, src string, dst string, fi os.FileInfo) error {
+	if c.opts.FollowSymlinks {
+		real, err := filepath.EvalSymlinks(src)
+		if err != nil {
+			return err
+		}
+		if c.ancestors[real] {
+			log.Warnln("Skipping symlink loop:", src)
+			return nil
+		}
+		c.ancestors[real] = true
+		defer delete(c.ancestors, real)
+	}
+
+	dfi, err := c.prepareDst(dst, func(dfi os.FileInfo) bool { return dfi.IsDir() })
+	if err != nil {
+		return err
+	}
+	if err = journalSnapshot(dst); err != nil {
+		return err
+	}
+	if dfi == nil {
+		if err = os.Mkdir(dst, 0700); err != nil {
+			return err
+		}
+		c.stats.Copied++
+		c.event(rel, CopyActionCopy, 0)
+	} else if err = os.Chmod(dst, dfi.Mode().Perm()|0700); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		childRel := filepath.Join(rel, entry.Name())
+		if c.filtered(childRel, entry.IsDir()) {
+			continue
+		}
+		seen[entry.Name()] = true
+		err = c.copyEntry(childRel, filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.opts.Delete {
+		existing, errRead := ioutil.ReadDir(dst)
+		if errRead != nil {
+			return errRead
+		}
+		for _, entry := range existing {
+			childRel := filepath.Join(rel, entry.Name())
+			if seen[entry.Name()] || c.filtered(childRel, entry.IsDir()) {
+				continue
+			}
+			if err = journalSnapshotTree(filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+			if err = os.RemoveAll(filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+			c.stats.Deleted++
+			c.event(childRel, CopyActionDelete, 0)
+		}
+	}
+
+	//the mode and times are applied last since copying the entries changes
+	//them and a read-only directory would block the copy
+	return c.applyMetadata(src, dst, fi)
+}
+
+//CopyTree recursively copies the src directory (or file) to dst
+func (fs *Fs) CopyTree(src string, dst string, opts *CopyTreeOptions) (*CopyTreeStats, error) {
+	log.Debugln("CopyTree ENTER")
+	log.Debugln("SRC:", src)
+	log.Debugln("DST:", dst)
+
+	if opts == nil {
+		opts = &CopyTreeOptions{}
+	}
+
+	srcAbs, err := filepath.Abs(src)
+	if err == nil {
+		src = srcAbs
+		if real, errEval := filepath.EvalSymlinks(src); errEval == nil {
+			srcAbs = real
+		}
+	}
+	dstAbs, err := filepath.Abs(dst)
+	if err == nil {
+		if real, errEval := filepath.EvalSymlinks(filepath.Dir(dstAbs)); errEval == nil {
+			dstAbs = filepath.Join(real, filepath.Base(dstAbs))
+		}
+		if dstAbs == srcAbs || strings.HasPrefix(dstAbs, srcAbs+string(filepath.Separator)) {
+			log.Debugln("Dst is inside Src")
+			log.Debugln("CopyTree LEAVE")
+			return nil, ErrCopyIntoSelf
+		}
+	}
+
+	if _, err = os.Lstat(src); err != nil {
+		log.Debugln("Src Stat Failed:", err)
+		log.Debugln("CopyTree LEAVE")
+		return nil, ErrSrcNotExist
+	}
+
+	c := &treeCopier{
+		opts:      opts,
+		stats:     &CopyTreeStats{},
+		links:     make(map[fileKey]string),
+		ancestors: make(map[string]bool),
+	}
+	err = c.copyEntry(".", src, dst)
+	if err != nil {
+		log.Debugln("CopyTree Failed:", err)
+		log.Debugln("CopyTree LEAVE")
+		return c.stats, err
+	}
+
+	log.Debugln("CopyTree Copied:", c.stats.Copied, "Linked:", c.stats.Linked,
+		"Skipped:", c.stats.Skipped, "Deleted:", c.stats.Deleted)
+	log.Debugln("CopyTree LEAVE")
+	return c.stats, nil
+}
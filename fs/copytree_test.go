@@ -0,0 +1,105 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestCopyTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copytree")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	os.MkdirAll(filepath.Join(src, "conf.d"), 0750)
+	ioutil.WriteFile(filepath.Join(src, "app.conf"), []byte("port=80\n"), 0640)
+	ioutil.WriteFile(filepath.Join(src, "conf.d", "a.conf"), []byte("a\n"), 0600)
+	ioutil.WriteFile(filepath.Join(src, "conf.d", "a.conf.bak"), []byte("old\n"), 0600)
+	os.Link(filepath.Join(src, "app.conf"), filepath.Join(src, "app.link"))
+	os.Symlink("app.conf", filepath.Join(src, "current"))
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(filepath.Join(src, "app.conf"), old, old)
+
+	events := []*CopyEvent{}
+	stats, err := fs.CopyTree(src, dst, &CopyTreeOptions{
+		PreserveHardLinks: true,
+		PreserveTimes:     true,
+		Exclude:           []string{"*.bak"},
+		Progress: func(event *CopyEvent) {
+			events = append(events, event)
+		},
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, stats.Linked)
+	assert.Equal(t, 5, stats.Copied)
+	assert.Equal(t, 5+1, len(events))
+
+	info, _ := os.Stat(filepath.Join(dst, "conf.d"))
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	info, _ = os.Stat(filepath.Join(dst, "app.conf"))
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.Equal(t, old.Unix(), info.ModTime().Unix())
+	linkInfo, _ := os.Stat(filepath.Join(dst, "app.link"))
+	assert.True(t, os.SameFile(info, linkInfo))
+	target, _ := os.Readlink(filepath.Join(dst, "current"))
+	assert.Equal(t, "app.conf", target)
+	_, err = os.Stat(filepath.Join(dst, "conf.d", "a.conf.bak"))
+	assert.True(t, os.IsNotExist(err))
+
+	ioutil.WriteFile(filepath.Join(src, "conf.d", "a.conf"), []byte("changed\n"), 0600)
+	os.Remove(filepath.Join(src, "current"))
+	ioutil.WriteFile(filepath.Join(dst, "extra"), []byte("x"), 0644)
+	ioutil.WriteFile(filepath.Join(dst, "keep.bak"), []byte("x"), 0644)
+
+	stats, err = fs.CopyTree(src, dst, &CopyTreeOptions{
+		PreserveHardLinks: true,
+		Exclude:           []string{"*.bak"},
+		Sync:              true,
+		Delete:            true,
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, stats.Copied)
+	assert.Equal(t, 2, stats.Deleted)
+	assert.Equal(t, int64(len("changed\n")), stats.Bytes)
+	data, _ := ioutil.ReadFile(filepath.Join(dst, "conf.d", "a.conf"))
+	assert.Equal(t, "changed\n", string(data))
+	_, err = os.Stat(filepath.Join(dst, "keep.bak"))
+	assert.Equal(t, nil, err)
+
+	_, err = fs.CopyTree(src, filepath.Join(src, "conf.d", "copy"), nil)
+	assert.Equal(t, ErrCopyIntoSelf, err)
+}
+
+func TestCopyTreeFollowSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copytree")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "plugins"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "plugins", "p.so"), []byte("elf"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "README"), []byte("doc"), 0644)
+	os.Symlink("plugins/p.so", filepath.Join(src, "p.so"))
+	os.Symlink("..", filepath.Join(src, "plugins", "loop"))
+
+	dst := filepath.Join(dir, "dst")
+	_, err = fs.CopyTree(src, dst, &CopyTreeOptions{
+		FollowSymlinks: true,
+		Include:        []string{"*.so"},
+	})
+	assert.Equal(t, nil, err)
+
+	info, _ := os.Lstat(filepath.Join(dst, "p.so"))
+	assert.True(t, info.Mode().IsRegular())
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	_, err = os.Stat(filepath.Join(dst, "README"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dst, "plugins", "loop", "plugins"))
+	assert.True(t, os.IsNotExist(err))
+}
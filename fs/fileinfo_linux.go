@@ -0,0 +1,72 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func fileOwner(fi os.FileInfo) (int, int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+//fileLinkKey returns the device and inode identifying the file and its hard
+//link count
+func fileLinkKey(fi os.FileInfo) (fileKey, uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, 0, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, uint64(st.Nlink), true
+}
+
+func fileAtime(fi os.FileInfo) time.Time {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.ModTime()
+	}
+	return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+}
+
+//copyXattrs copies the extended attributes, which include POSIX ACLs, of
+//src to dst
+func copyXattrs(src string, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err == syscall.ENOTSUP || size == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	names := make([]byte, size)
+	size, err = syscall.Listxattr(src, names)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range strings.Split(string(names[:size]), "\x00") {
+		if len(name) == 0 {
+			continue
+		}
+		valueSize, err := syscall.Getxattr(src, name, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, valueSize)
+		valueSize, err = syscall.Getxattr(src, name, value)
+		if err != nil {
+			return err
+		}
+		err = syscall.Setxattr(dst, name, value[:valueSize], 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"os"
+	"time"
+
+	common "github.com/dvonthenen/goxplatform/common"
+)
+
+func fileOwner(fi os.FileInfo) (int, int, bool) {
+	return -1, -1, false
+}
+
+func fileLinkKey(fi os.FileInfo) (fileKey, uint64, bool) {
+	return fileKey{}, 0, false
+}
+
+func fileAtime(fi os.FileInfo) time.Time {
+	return fi.ModTime()
+}
+
+func copyXattrs(src string, dst string) error {
+	return common.ErrNotImplemented
+}
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"encoding/hex"
 	"errors"
 	"io"
 	"os"
@@ -19,10 +20,26 @@ var (
 
 	//ErrDstNotRegularFile dst file is not a regular file
 	ErrDstNotRegularFile = errors.New("Destination file is not a regular file")
+
+	//ErrNotMounted the path or device is not mounted
+	ErrNotMounted = errors.New("Path or device is not mounted")
+
+	//ErrReadOnlyFilesystem the filesystem is mounted read-only
+	ErrReadOnlyFilesystem = errors.New("Filesystem is read-only")
+
+	//ErrInsecureTempDir the temp directory is writable by others without the sticky bit
+	ErrInsecureTempDir = errors.New("Temporary directory is writable by others and not sticky")
+
+	//ErrInvalidTempPattern the temp file pattern contains a path separator
+	ErrInvalidTempPattern = errors.New("Invalid temporary file pattern")
 )
 
 //Fs is a static class that provides Filesystem type functions
-type Fs struct{}
+type Fs struct {
+	tempDir    string
+	lockDir    string
+	journalDir string
+}
 
 //NewFs generates a Fs object
 func NewFs() *Fs {
@@ -134,12 +151,37 @@ func (fs *Fs) CopyFile(src string, dst string) error {
 	return fs.CopyFileEx(src, dst, 0666)
 }
 
+//CopyFileOptions are optional settings for CopyFileEx
+type CopyFileOptions struct {
+	//Verify reads the dst file back after the copy and returns
+	//ErrChecksumMismatch if it does not match what was read from src
+	Verify bool
+
+	//Algorithm is the digest used to verify. Defaults to sha256.
+	Algorithm string
+}
+
 //CopyFileEx copies the contents of the src file to the dst file
-func (fs *Fs) CopyFileEx(src string, dst string, mode os.FileMode) error {
+func (fs *Fs) CopyFileEx(src string, dst string, mode os.FileMode, opts ...*CopyFileOptions) error {
 	log.Debugln("CopyFile ENTER")
 	log.Debugln("SRC:", src)
 	log.Debugln("DST:", dst)
 
+	options := &CopyFileOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		options = opts[0]
+	}
+	algorithm := options.Algorithm
+	if len(algorithm) == 0 {
+		algorithm = DigestSHA256
+	}
+	h, err := newHash(algorithm)
+	if err != nil {
+		log.Debugln("newHash Failed:", err)
+		log.Debugln("CopyFile LEAVE")
+		return err
+	}
+
 	sfi, err := os.Stat(src)
 	if err != nil {
 		log.Debugln("Src Stat Failed:", err)
@@ -174,6 +216,11 @@ func (fs *Fs) CopyFileEx(src string, dst string, mode os.FileMode) error {
 		return err
 	}
 	defer in.Close()
+	if err = journalSnapshot(dst); err != nil {
+		log.Debugln("journalSnapshot Failed:", err)
+		log.Debugln("CopyFile LEAVE")
+		return err
+	}
 	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_RDWR, mode)
 	if err != nil {
 		log.Debugln("Failed to open DST file:", err)
@@ -181,7 +228,12 @@ func (fs *Fs) CopyFileEx(src string, dst string, mode os.FileMode) error {
 		return err
 	}
 	defer out.Close()
-	if _, err = io.Copy(out, in); err != nil {
+
+	var reader io.Reader = in
+	if options.Verify {
+		reader = io.TeeReader(in, h)
+	}
+	if _, err = io.Copy(out, reader); err != nil {
 		log.Debugln("Failed to copy file:", err)
 		log.Debugln("CopyFile LEAVE")
 		return err
@@ -194,6 +246,20 @@ func (fs *Fs) CopyFileEx(src string, dst string, mode os.FileMode) error {
 		return err
 	}
 
+	if options.Verify {
+		digest, errVerify := checksumFile(dst, algorithm)
+		if errVerify != nil {
+			log.Debugln("Failed to checksum DST file:", errVerify)
+			log.Debugln("CopyFile LEAVE")
+			return errVerify
+		}
+		if digest != hex.EncodeToString(h.Sum(nil)) {
+			log.Debugln("DST checksum does not match SRC")
+			log.Debugln("CopyFile LEAVE")
+			return ErrChecksumMismatch
+		}
+	}
+
 	log.Debugln("CopyFile succeeded")
 	log.Debugln("CopyFile LEAVE")
 	return nil
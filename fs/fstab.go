@@ -0,0 +1,246 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultFstabFile = "/etc/fstab"
+)
+
+var (
+	//ErrInvalidFstabEntry the fstab entry is missing a required field
+	ErrInvalidFstabEntry = errors.New("Invalid fstab entry")
+)
+
+//FstabEntry is a line in /etc/fstab
+type FstabEntry struct {
+	Source     string
+	MountPoint string
+	FsType     string
+	Options    string
+	Dump       int
+	Pass       int
+}
+
+//escapeFstabField encodes the characters fstab uses as separators
+func escapeFstabField(field string) string {
+	field = strings.Replace(field, "\\", "\\134", -1)
+	field = strings.Replace(field, " ", "\\040", -1)
+	field = strings.Replace(field, "\t", "\\011", -1)
+	return strings.Replace(field, "\n", "\\012", -1)
+}
+
+//String returns the entry formatted as an fstab line
+func (fe *FstabEntry) String() string {
+	options := fe.Options
+	if len(options) == 0 {
+		options = "defaults"
+	}
+	return strings.Join([]string{
+		escapeFstabField(fe.Source),
+		escapeFstabField(fe.MountPoint),
+		fe.FsType,
+		options,
+		strconv.Itoa(fe.Dump),
+		strconv.Itoa(fe.Pass),
+	}, "\t")
+}
+
+//IsSwap returns true if the entry is a swap area
+func (fe *FstabEntry) IsSwap() bool {
+	return fe.FsType == "swap"
+}
+
+//matches returns true if both entries configure the same mount. Swap
+//entries are identified by their source, everything else by mount point.
+func (fe *FstabEntry) matches(other *FstabEntry) bool {
+	if fe.IsSwap() || other.IsSwap() {
+		return fe.IsSwap() && other.IsSwap() && fe.Source == other.Source
+	}
+	return fe.MountPoint == other.MountPoint
+}
+
+func (fe *FstabEntry) validate() error {
+	if len(fe.Source) == 0 || len(fe.MountPoint) == 0 || len(fe.FsType) == 0 {
+		return ErrInvalidFstabEntry
+	}
+	return nil
+}
+
+func parseFstabLine(line string) *FstabEntry {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] == '#' {
+		return nil
+	}
+
+	fields := strings.Fields(trimmed)
+	if len(fields) < 3 {
+		return nil
+	}
+
+	entry := &FstabEntry{
+		Source:     unescapeMountPath(fields[0]),
+		MountPoint: unescapeMountPath(fields[1]),
+		FsType:     fields[2],
+		Options:    "defaults",
+	}
+	if len(fields) > 3 {
+		entry.Options = fields[3]
+	}
+	if len(fields) > 4 {
+		entry.Dump, _ = strconv.Atoi(fields[4])
+	}
+	if len(fields) > 5 {
+		entry.Pass, _ = strconv.Atoi(fields[5])
+	}
+	return entry
+}
+
+func readFstab(path string) ([]*FstabEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []*FstabEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*FstabEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if entry := parseFstabLine(scanner.Text()); entry != nil {
+			list = append(list, entry)
+		}
+	}
+	return list, scanner.Err()
+}
+
+//mergeFstab replaces the first line that matches entry, drops any other
+//matching lines and appends entry if nothing matched. When remove is true
+//every matching line is dropped instead. Comments and unrelated lines are
+//kept as they are.
+func mergeFstab(path string, entry *FstabEntry, remove bool) (bool, error) {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	written := remove
+	var buffer bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(existing))
+	for scanner.Scan() {
+		line := scanner.Text()
+		current := parseFstabLine(line)
+		if current == nil || !current.matches(entry) {
+			buffer.WriteString(line + "\n")
+			continue
+		}
+		if written {
+			continue
+		}
+		if current.String() == entry.String() {
+			buffer.WriteString(line + "\n")
+		} else {
+			buffer.WriteString(entry.String() + "\n")
+		}
+		written = true
+	}
+	if !written {
+		buffer.WriteString(entry.String() + "\n")
+	}
+
+	if bytes.Equal(existing, buffer.Bytes()) {
+		return false, nil
+	}
+
+	err = writeFileAtomic(path, bytes.NewReader(buffer.Bytes()), 0, -1, -1)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+//GetFstabEntries returns the entries in /etc/fstab
+func (fs *Fs) GetFstabEntries() ([]*FstabEntry, error) {
+	log.Debugln("GetFstabEntries ENTER")
+
+	list, err := readFstab(defaultFstabFile)
+	if err != nil {
+		log.Debugln("readFstab Failed:", err)
+		log.Debugln("GetFstabEntries LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetFstabEntries Count:", len(list))
+	log.Debugln("GetFstabEntries LEAVE")
+	return list, nil
+}
+
+//EnsureFstabEntry adds the entry to /etc/fstab or updates the entry for the
+//same mount point (or the same source for swap). Returns true if the file
+//changed.
+func (fs *Fs) EnsureFstabEntry(entry *FstabEntry) (bool, error) {
+	log.Debugln("EnsureFstabEntry ENTER")
+	log.Debugln("entry:", entry.String())
+
+	if err := entry.validate(); err != nil {
+		log.Debugln("Invalid entry")
+		log.Debugln("EnsureFstabEntry LEAVE")
+		return false, err
+	}
+
+	lock, err := fs.Lock("fstab", DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("EnsureFstabEntry LEAVE")
+		return false, err
+	}
+	defer lock.Unlock()
+
+	changed, err := mergeFstab(defaultFstabFile, entry, false)
+	if err != nil {
+		log.Debugln("mergeFstab Failed:", err)
+		log.Debugln("EnsureFstabEntry LEAVE")
+		return false, err
+	}
+
+	log.Debugln("EnsureFstabEntry changed:", changed)
+	log.Debugln("EnsureFstabEntry LEAVE")
+	return changed, nil
+}
+
+//RemoveFstabEntry removes the entries for the same mount point (or the same
+//source for swap) from /etc/fstab. Returns true if the file changed.
+func (fs *Fs) RemoveFstabEntry(entry *FstabEntry) (bool, error) {
+	log.Debugln("RemoveFstabEntry ENTER")
+	log.Debugln("entry:", entry.String())
+
+	lock, err := fs.Lock("fstab", DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("RemoveFstabEntry LEAVE")
+		return false, err
+	}
+	defer lock.Unlock()
+
+	changed, err := mergeFstab(defaultFstabFile, entry, true)
+	if err != nil {
+		log.Debugln("mergeFstab Failed:", err)
+		log.Debugln("RemoveFstabEntry LEAVE")
+		return false, err
+	}
+
+	log.Debugln("RemoveFstabEntry changed:", changed)
+	log.Debugln("RemoveFstabEntry LEAVE")
+	return changed, nil
+}
@@ -0,0 +1,62 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+const testFstab = `# /etc/fstab: static file system information.
+UUID=0a1b2c3d-4e5f-6789-abcd-ef0123456789 / ext4 errors=remount-ro 0 1
+/dev/sdb1 /mnt/my\040data xfs defaults 0 2
+/swapfile none swap sw 0 0
+`
+
+func TestMergeFstab(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fstab")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "fstab")
+	ioutil.WriteFile(path, []byte(testFstab), 0644)
+
+	entries, err := readFstab(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "/mnt/my data", entries[1].MountPoint)
+	assert.True(t, entries[2].IsSwap())
+
+	same := &FstabEntry{Source: "/dev/sdb1", MountPoint: "/mnt/my data", FsType: "xfs", Pass: 2}
+	changed, err := mergeFstab(path, same, false)
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	same.Options = "noatime"
+	changed, err = mergeFstab(path, same, false)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	swap := &FstabEntry{Source: "/swapfile2", MountPoint: "none", FsType: "swap", Options: "sw"}
+	changed, err = mergeFstab(path, swap, false)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	entries, _ = readFstab(path)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, "noatime", entries[1].Options)
+	assert.Equal(t, "/swapfile2", entries[3].Source)
+
+	changed, err = mergeFstab(path, &FstabEntry{Source: "/swapfile", FsType: "swap"}, true)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, `# /etc/fstab: static file system information.
+UUID=0a1b2c3d-4e5f-6789-abcd-ef0123456789 / ext4 errors=remount-ro 0 1
+/dev/sdb1	/mnt/my\040data	xfs	noatime	0	2
+/swapfile2	none	swap	sw	0	0
+`, string(data))
+}
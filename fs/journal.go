@@ -0,0 +1,520 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	journalFile = "journal.json"
+
+	//journals have to survive a reboot so they are not kept in /tmp
+	defaultJournalDir = "/var/lib/goxplatform/journal"
+	journalPrefix     = "journal."
+
+	journalTypeFile    = "file"
+	journalTypeDir     = "dir"
+	journalTypeSymlink = "symlink"
+)
+
+var (
+	//ErrJournalActive another journal is already recording changes
+	ErrJournalActive = errors.New("A journal is already active")
+
+	//ErrJournalClosed the journal was already committed or rolled back
+	ErrJournalClosed = errors.New("Journal is already committed or rolled back")
+
+	journalMutex  sync.Mutex
+	activeJournal *Journal
+)
+
+//journalEntry is the state of a path before the first change to it. The
+//fields are exported for encoding/json.
+type journalEntry struct {
+	Path    string
+	Existed bool
+	Type    string
+	Backup  string
+	Target  string
+	Mode    os.FileMode
+	UID     int
+	GID     int
+	ModTime time.Time
+}
+
+//Journal records the state of every file before the library modifies,
+//replaces or deletes it and of every file it creates, so a multi-step change
+//can be rolled back to exactly the prior contents, modes, owners and times.
+//Only one journal records at a time. The backups live in Dir() until Commit
+//or Rollback so a journal left behind by a crash can be reopened with
+//OpenJournal and rolled back.
+type Journal struct {
+	mutex   sync.Mutex
+	dir     string
+	entries []*journalEntry
+	seen    map[string]bool
+	closed  bool
+}
+
+//SetJournalDir sets the directory journals are created in. An empty dir uses
+//the default /var/lib/goxplatform/journal.
+func (fs *Fs) SetJournalDir(dir string) {
+	fs.journalDir = dir
+}
+
+//GetJournalDir returns the directory journals are created in
+func (fs *Fs) GetJournalDir() string {
+	if len(fs.journalDir) > 0 {
+		return fs.journalDir
+	}
+	return defaultJournalDir
+}
+
+//journalSnapshot records path in the active journal, if there is one, before
+//the library changes it
+func journalSnapshot(path string) error {
+	journalMutex.Lock()
+	j := activeJournal
+	journalMutex.Unlock()
+	if j == nil {
+		return nil
+	}
+	return j.Snapshot(path)
+}
+
+//journalSnapshotTree records path and everything below it before a recursive
+//delete. Parents come before their children.
+func journalSnapshotTree(root string) error {
+	journalMutex.Lock()
+	j := activeJournal
+	journalMutex.Unlock()
+	if j == nil {
+		return nil
+	}
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return j.Snapshot(path)
+	})
+}
+
+//JournalSnapshot records path in the active journal, if there is one. Other
+//packages call it before they change a file without going through Fs.
+func (fs *Fs) JournalSnapshot(path string) error {
+	return journalSnapshot(path)
+}
+
+//BeginJournal starts recording changes made through the library until the
+//journal is committed or rolled back. The journal is kept in a new directory
+//below GetJournalDir(). Returns ErrJournalActive if another journal is
+//recording.
+func (fs *Fs) BeginJournal() (*Journal, error) {
+	log.Debugln("BeginJournal ENTER")
+
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	if activeJournal != nil {
+		log.Debugln("Journal already active:", activeJournal.dir)
+		log.Debugln("BeginJournal LEAVE")
+		return nil, ErrJournalActive
+	}
+
+	err := os.MkdirAll(fs.GetJournalDir(), 0700)
+	if err != nil {
+		log.Debugln("MkdirAll Failed:", err)
+		log.Debugln("BeginJournal LEAVE")
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(fs.GetJournalDir(), journalPrefix)
+	if err != nil {
+		log.Debugln("TempDir Failed:", err)
+		log.Debugln("BeginJournal LEAVE")
+		return nil, err
+	}
+
+	j := &Journal{
+		dir:     dir,
+		entries: []*journalEntry{},
+		seen:    make(map[string]bool),
+	}
+	if err = j.save(); err != nil {
+		os.RemoveAll(dir)
+		log.Debugln("save Failed:", err)
+		log.Debugln("BeginJournal LEAVE")
+		return nil, err
+	}
+	activeJournal = j
+
+	log.Debugln("BeginJournal =", dir)
+	log.Debugln("BeginJournal LEAVE")
+	return j, nil
+}
+
+//OpenJournal loads a journal left in dir by a process that did not finish
+//it. The journal does not record new changes but can be rolled back or
+//committed.
+func (fs *Fs) OpenJournal(dir string) (*Journal, error) {
+	log.Debugln("OpenJournal ENTER")
+	log.Debugln("dir:", dir)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		log.Debugln("ReadFile Failed:", err)
+		log.Debugln("OpenJournal LEAVE")
+		return nil, err
+	}
+
+	j := &Journal{
+		dir:  dir,
+		seen: make(map[string]bool),
+	}
+	if err = json.Unmarshal(data, &j.entries); err != nil {
+		log.Debugln("Unmarshal Failed:", err)
+		log.Debugln("OpenJournal LEAVE")
+		return nil, err
+	}
+	for _, entry := range j.entries {
+		j.seen[entry.Path] = true
+	}
+
+	log.Debugln("OpenJournal Entries:", len(j.entries))
+	log.Debugln("OpenJournal LEAVE")
+	return j, nil
+}
+
+//GetJournals returns the directories of the journals in GetJournalDir() that
+//were never committed or rolled back, such as ones left by a crash or a
+//reboot. Each can be passed to OpenJournal.
+func (fs *Fs) GetJournals() ([]string, error) {
+	log.Debugln("GetJournals ENTER")
+
+	list, err := filepath.Glob(filepath.Join(fs.GetJournalDir(), journalPrefix+"*"))
+	if err != nil {
+		log.Debugln("Glob Failed:", err)
+		log.Debugln("GetJournals LEAVE")
+		return nil, err
+	}
+
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+
+	dirs := []string{}
+	for _, dir := range list {
+		if activeJournal != nil && activeJournal.dir == dir {
+			continue
+		}
+		if _, errStat := os.Stat(filepath.Join(dir, journalFile)); errStat == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	log.Debugln("GetJournals Count:", len(dirs))
+	log.Debugln("GetJournals LEAVE")
+	return dirs, nil
+}
+
+//Dir returns the directory holding the journal and its backups
+func (j *Journal) Dir() string {
+	return j.dir
+}
+
+//Paths returns the recorded paths in the order they were first changed
+func (j *Journal) Paths() []string {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	paths := make([]string, 0, len(j.entries))
+	for _, entry := range j.entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+func (j *Journal) save() error {
+	data, err := json.Marshal(j.entries)
+	if err != nil {
+		return err
+	}
+	return replaceFile(filepath.Join(j.dir, journalFile), bytes.NewReader(data), 0600, -1, -1)
+}
+
+//backup copies the contents of path into the journal directory
+func (j *Journal) backup(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	name := strconv.Itoa(len(j.entries))
+	out, err := os.OpenFile(filepath.Join(j.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if errClose := out.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		//the entry is not recorded so the next backup reuses the name
+		os.Remove(filepath.Join(j.dir, name))
+		return "", err
+	}
+	return name, nil
+}
+
+//Snapshot records the current state of path, or that it does not exist yet,
+//unless it was already recorded. The library calls this itself before it
+//changes a file. Callers use it for files they change some other way.
+func (j *Journal) Snapshot(path string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.closed {
+		return ErrJournalClosed
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	//the journal's own files are not part of the change
+	if path == j.dir || strings.HasPrefix(path, j.dir+string(os.PathSeparator)) {
+		return nil
+	}
+	if j.seen[path] {
+		return nil
+	}
+
+	entry := &journalEntry{
+		Path: path,
+		UID:  -1,
+		GID:  -1,
+	}
+	fi, err := os.Lstat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		entry.Existed = true
+		entry.Mode = fi.Mode()
+		entry.ModTime = fi.ModTime()
+		if uid, gid, ok := fileOwner(fi); ok {
+			entry.UID = uid
+			entry.GID = gid
+		}
+		switch {
+		case fi.Mode().IsRegular():
+			entry.Type = journalTypeFile
+			if entry.Backup, err = j.backup(path); err != nil {
+				return err
+			}
+		case fi.IsDir():
+			entry.Type = journalTypeDir
+		case fi.Mode()&os.ModeSymlink != 0:
+			entry.Type = journalTypeSymlink
+			if entry.Target, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			log.Warnln("Journal cannot restore special file:", path)
+			return nil
+		}
+	}
+
+	j.entries = append(j.entries, entry)
+	j.seen[path] = true
+	log.Debugln("Journal recorded:", path, "Existed:", entry.Existed)
+	return j.save()
+}
+
+//restore puts a single path back the way it was recorded
+func (j *Journal) restore(entry *journalEntry) error {
+	fi, err := os.Lstat(entry.Path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if !entry.Existed {
+		if !exists {
+			return nil
+		}
+		//a created directory is only removed once it is empty again
+		return os.Remove(entry.Path)
+	}
+
+	if exists && entry.Type != journalTypeDir && fi.IsDir() {
+		if err = os.RemoveAll(entry.Path); err != nil {
+			return err
+		}
+	} else if exists && entry.Type == journalTypeDir && !fi.IsDir() {
+		if err = os.Remove(entry.Path); err != nil {
+			return err
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(entry.Path), 0700); err != nil {
+		return err
+	}
+
+	switch entry.Type {
+	case journalTypeFile:
+		if exists && !fi.Mode().IsRegular() && !fi.IsDir() {
+			if err = os.Remove(entry.Path); err != nil {
+				return err
+			}
+		}
+		in, errOpen := os.Open(filepath.Join(j.dir, entry.Backup))
+		if errOpen != nil {
+			return errOpen
+		}
+		err = replaceFile(entry.Path, in, entry.Mode.Perm()|0200, entry.UID, entry.GID)
+		in.Close()
+	case journalTypeDir:
+		err = os.MkdirAll(entry.Path, 0700)
+	case journalTypeSymlink:
+		if errRemove := os.Remove(entry.Path); errRemove != nil && !os.IsNotExist(errRemove) {
+			return errRemove
+		}
+		err = os.Symlink(entry.Target, entry.Path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.UID != -1 || entry.GID != -1 {
+		if err = os.Lchown(entry.Path, entry.UID, entry.GID); err != nil {
+			return err
+		}
+	}
+	if entry.Type == journalTypeSymlink {
+		return nil
+	}
+	if err = os.Chmod(entry.Path, entry.Mode); err != nil {
+		return err
+	}
+	return os.Chtimes(entry.Path, entry.ModTime, entry.ModTime)
+}
+
+//stop ends recording if this is the active journal
+func (j *Journal) stop() {
+	journalMutex.Lock()
+	if activeJournal == j {
+		activeJournal = nil
+	}
+	journalMutex.Unlock()
+}
+
+//Commit keeps the changes, stops recording and removes the backups
+func (j *Journal) Commit() error {
+	log.Debugln("Journal::Commit ENTER")
+	log.Debugln("dir:", j.dir)
+
+	j.stop()
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.closed {
+		log.Debugln("Journal already closed")
+		log.Debugln("Journal::Commit LEAVE")
+		return ErrJournalClosed
+	}
+	j.closed = true
+
+	err := os.RemoveAll(j.dir)
+	if err != nil {
+		log.Debugln("RemoveAll Failed:", err)
+		log.Debugln("Journal::Commit LEAVE")
+		return err
+	}
+
+	log.Debugln("Commit succeeded")
+	log.Debugln("Journal::Commit LEAVE")
+	return nil
+}
+
+//Rollback stops recording and restores every recorded path, newest first,
+//removing the files that were created. Every path is attempted and the
+//first error is returned. The backups are kept if anything failed so the
+//rollback can be retried with OpenJournal.
+func (j *Journal) Rollback() error {
+	log.Debugln("Journal::Rollback ENTER")
+	log.Debugln("dir:", j.dir)
+
+	j.stop()
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.closed {
+		log.Debugln("Journal already closed")
+		log.Debugln("Journal::Rollback LEAVE")
+		return ErrJournalClosed
+	}
+
+	var firstErr error
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if err := j.restore(j.entries[i]); err != nil {
+			log.Warnln("Failed to restore", j.entries[i].Path, "Err:", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		log.Debugln("Rollback Failed:", firstErr)
+		log.Debugln("Journal::Rollback LEAVE")
+		return firstErr
+	}
+
+	j.closed = true
+	err := os.RemoveAll(j.dir)
+	if err != nil {
+		log.Debugln("RemoveAll Failed:", err)
+		log.Debugln("Journal::Rollback LEAVE")
+		return err
+	}
+
+	log.Debugln("Rollback succeeded")
+	log.Debugln("Journal::Rollback LEAVE")
+	return nil
+}
+
+//RemoveFile removes a file, symlink or empty directory and records it in the
+//active journal first
+func (fs *Fs) RemoveFile(path string) error {
+	log.Debugln("RemoveFile ENTER")
+	log.Debugln("path:", path)
+
+	if err := journalSnapshot(path); err != nil {
+		log.Debugln("journalSnapshot Failed:", err)
+		log.Debugln("RemoveFile LEAVE")
+		return err
+	}
+
+	err := os.Remove(path)
+	if err != nil {
+		log.Debugln("Remove Failed:", err)
+		log.Debugln("RemoveFile LEAVE")
+		return err
+	}
+
+	log.Debugln("RemoveFile succeeded")
+	log.Debugln("RemoveFile LEAVE")
+	return nil
+}
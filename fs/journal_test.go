@@ -0,0 +1,139 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestJournalRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	unit := filepath.Join(dir, "app.service")
+	ioutil.WriteFile(unit, []byte("[Unit]\nAfter=network.target\n"), 0640)
+	mtime := time.Unix(1500000000, 0)
+	os.Chtimes(unit, mtime, mtime)
+	old := filepath.Join(dir, "old.conf")
+	ioutil.WriteFile(old, []byte("old\n"), 0600)
+	os.Symlink("app.service", filepath.Join(dir, "current"))
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(filepath.Join(src, "bin"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "bin", "app"), []byte("binary"), 0755)
+	tmpl := filepath.Join(dir, "app.conf")
+	ioutil.WriteFile(tmpl, []byte("port=80\n"), 0644)
+	os.Symlink("app.conf", filepath.Join(dir, "app.link"))
+
+	fs.SetJournalDir(filepath.Join(dir, "journal"))
+	defer fs.SetJournalDir("")
+
+	journal, err := fs.BeginJournal()
+	assert.Equal(t, nil, err)
+	_, err = fs.BeginJournal()
+	assert.Equal(t, ErrJournalActive, err)
+
+	_, err = fs.LineInFile(filepath.Join(dir, "current"), &LineInFileOptions{
+		Regexp: "^After=",
+		Line:   "After=network.target app-dep.service",
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, fs.WriteFileAtomicEx(unit, strings.NewReader("changed\n"), 0600, -1, -1))
+	assert.Equal(t, nil, fs.CopyFile(unit, filepath.Join(dir, "new.service")))
+	assert.Equal(t, nil, fs.RemoveFile(old))
+	_, err = fs.CopyTree(src, filepath.Join(dir, "opt"), nil)
+	assert.Equal(t, nil, err)
+	_, err = fs.RenderTemplate("port=80\n", filepath.Join(dir, "app.link"), nil, &RenderOptions{Mode: 0600, Facts: &HostFacts{}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 7, len(journal.Paths()))
+	assert.True(t, strings.HasPrefix(journal.Dir(), filepath.Join(dir, "journal")))
+
+	assert.Equal(t, nil, journal.Rollback())
+	assert.Equal(t, ErrJournalClosed, journal.Rollback())
+
+	data, _ := ioutil.ReadFile(unit)
+	assert.Equal(t, "[Unit]\nAfter=network.target\n", string(data))
+	info, _ := os.Stat(unit)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.Equal(t, mtime.Unix(), info.ModTime().Unix())
+	data, _ = ioutil.ReadFile(old)
+	assert.Equal(t, "old\n", string(data))
+	info, _ = os.Stat(tmpl)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	target, _ := os.Readlink(filepath.Join(dir, "current"))
+	assert.Equal(t, "app.service", target)
+	_, err = os.Lstat(filepath.Join(dir, "new.service"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(dir, "opt"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(journal.Dir())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalCommitAndRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "fstab")
+	ioutil.WriteFile(path, []byte("a\n"), 0644)
+
+	fs.SetJournalDir(filepath.Join(dir, "journal"))
+	defer fs.SetJournalDir("")
+
+	journal, err := fs.BeginJournal()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, fs.WriteFileAtomic(path, []byte("b\n"), 0644))
+	assert.Equal(t, nil, journal.Commit())
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "b\n", string(data))
+	_, err = os.Stat(journal.Dir())
+	assert.True(t, os.IsNotExist(err))
+
+	//a journal left behind by a crashed process can still be rolled back
+	journal, err = fs.BeginJournal()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, fs.WriteFileAtomic(path, []byte("c\n"), 0644))
+	journal.stop()
+
+	//after a reboot the leftover journal is found in the journal directory
+	leftover, err := fs.GetJournals()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{journal.Dir()}, leftover)
+
+	recovered, err := fs.OpenJournal(journal.Dir())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{path}, recovered.Paths())
+	assert.Equal(t, nil, recovered.Rollback())
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "b\n", string(data))
+}
+
+func TestJournalBackupFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	fs.SetJournalDir(filepath.Join(dir, "journal"))
+	defer fs.SetJournalDir("")
+
+	journal, err := fs.BeginJournal()
+	assert.Equal(t, nil, err)
+	defer journal.Rollback()
+
+	//reading a directory fails after the backup file was created
+	_, err = journal.backup(dir)
+	assert.NotEqual(t, nil, err)
+	_, err = os.Stat(filepath.Join(journal.Dir(), "0"))
+	assert.True(t, os.IsNotExist(err))
+
+	conf := filepath.Join(dir, "app.conf")
+	ioutil.WriteFile(conf, []byte("port=80\n"), 0644)
+	assert.Equal(t, nil, journal.Snapshot(conf))
+	assert.Equal(t, []string{conf}, journal.Paths())
+}
@@ -0,0 +1,385 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//LineStatePresent makes sure the line or block is in the file
+	LineStatePresent = "present"
+
+	//LineStateAbsent makes sure the line or block is not in the file
+	LineStateAbsent = "absent"
+
+	//InsertBOF inserts at the beginning of the file when used as InsertBefore
+	InsertBOF = "BOF"
+
+	//InsertEOF inserts at the end of the file when used as InsertAfter
+	InsertEOF = "EOF"
+
+	//DefaultBlockMarker is the marker used for blocks when none is given.
+	//{mark} is replaced by BEGIN and END.
+	DefaultBlockMarker = "# {mark} MANAGED BLOCK"
+)
+
+var (
+	//ErrInvalidLineEdit the line or regexp to edit is missing or invalid
+	ErrInvalidLineEdit = errors.New("Invalid line in file options")
+
+	//ErrInvalidBlockMarkers the block markers are unbalanced or out of order
+	ErrInvalidBlockMarkers = errors.New("Block markers are missing or out of order")
+)
+
+//LineInFileOptions describes how a single line in a file is managed.
+//
+//With State present and a Regexp, the last matching line is replaced by Line.
+//If nothing matches Line is inserted unless it is already in the file. With
+//Backrefs, Line may use $1 style references to the Regexp groups and the file
+//is left alone when nothing matches. With State absent every line matching
+//Regexp, or equal to Line when there is no Regexp, is removed.
+//
+//InsertAfter and InsertBefore are regexps placing a new line after or before
+//the last matching line. InsertEOF and InsertBOF are accepted as well and the
+//default is the end of the file.
+type LineInFileOptions struct {
+	Line         string
+	Regexp       string
+	State        string
+	Backrefs     bool
+	InsertAfter  string
+	InsertBefore string
+	Create       bool
+	Mode         os.FileMode
+	Backup       bool
+	DryRun       bool
+}
+
+//BlockInFileOptions describes how a block of lines between two marker lines
+//is managed. An empty Block with State present removes the block.
+type BlockInFileOptions struct {
+	Block        string
+	Marker       string
+	MarkerBegin  string
+	MarkerEnd    string
+	State        string
+	InsertAfter  string
+	InsertBefore string
+	Create       bool
+	Mode         os.FileMode
+	Backup       bool
+	DryRun       bool
+}
+
+//EditResult is the outcome of a file edit. Diff is a unified diff of the
+//change and Backup the copy of the original file if one was made.
+type EditResult struct {
+	Changed bool
+	Diff    string
+	Backup  string
+}
+
+//lastMatch returns the index of the last line matching re or -1
+func lastMatch(lines []string, re *regexp.Regexp) int {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if re.MatchString(lines[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+//insertIndex returns where new lines go given InsertBefore and InsertAfter
+func insertIndex(lines []string, before string, after string) (int, error) {
+	if before == InsertBOF {
+		return 0, nil
+	}
+	if len(before) > 0 {
+		re, err := regexp.Compile(before)
+		if err != nil {
+			return 0, err
+		}
+		if i := lastMatch(lines, re); i >= 0 {
+			return i, nil
+		}
+		return len(lines), nil
+	}
+	if len(after) > 0 && after != InsertEOF {
+		re, err := regexp.Compile(after)
+		if err != nil {
+			return 0, err
+		}
+		if i := lastMatch(lines, re); i >= 0 {
+			return i + 1, nil
+		}
+	}
+	return len(lines), nil
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//spliceLines replaces lines[start:end] with insert in a new slice
+func spliceLines(lines []string, start int, end int, insert []string) []string {
+	result := make([]string, 0, len(lines)-(end-start)+len(insert))
+	result = append(result, lines[:start]...)
+	result = append(result, insert...)
+	return append(result, lines[end:]...)
+}
+
+func editLine(lines []string, opts *LineInFileOptions) ([]string, error) {
+	var re *regexp.Regexp
+	if len(opts.Regexp) > 0 {
+		var err error
+		re, err = regexp.Compile(opts.Regexp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.State == LineStateAbsent {
+		result := []string{}
+		for _, line := range lines {
+			if (re != nil && re.MatchString(line)) || (re == nil && line == opts.Line) {
+				continue
+			}
+			result = append(result, line)
+		}
+		return result, nil
+	}
+
+	if re != nil {
+		if i := lastMatch(lines, re); i >= 0 {
+			line := opts.Line
+			if opts.Backrefs {
+				match := re.FindStringSubmatchIndex(lines[i])
+				line = string(re.ExpandString(nil, opts.Line, lines[i], match))
+			}
+			return spliceLines(lines, i, i+1, []string{line}), nil
+		}
+		if opts.Backrefs {
+			return lines, nil
+		}
+	}
+
+	for _, line := range lines {
+		if line == opts.Line {
+			return lines, nil
+		}
+	}
+
+	i, err := insertIndex(lines, opts.InsertBefore, opts.InsertAfter)
+	if err != nil {
+		return nil, err
+	}
+	return spliceLines(lines, i, i, []string{opts.Line}), nil
+}
+
+func editBlock(lines []string, opts *BlockInFileOptions) ([]string, error) {
+	marker := opts.Marker
+	if len(marker) == 0 {
+		marker = DefaultBlockMarker
+	}
+	markBegin := opts.MarkerBegin
+	if len(markBegin) == 0 {
+		markBegin = "BEGIN"
+	}
+	markEnd := opts.MarkerEnd
+	if len(markEnd) == 0 {
+		markEnd = "END"
+	}
+	begin := strings.Replace(marker, "{mark}", markBegin, -1)
+	end := strings.Replace(marker, "{mark}", markEnd, -1)
+	if begin == end {
+		return nil, ErrInvalidBlockMarkers
+	}
+
+	first, last := -1, -1
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == begin && first == -1 {
+			first = i
+		} else if line == end && first != -1 {
+			last = i
+			break
+		} else if line == end {
+			return nil, ErrInvalidBlockMarkers
+		}
+	}
+	if first != -1 && last == -1 {
+		return nil, ErrInvalidBlockMarkers
+	}
+
+	block := splitLines([]byte(opts.Block))
+	if opts.State == LineStateAbsent || len(block) == 0 {
+		if first == -1 {
+			return lines, nil
+		}
+		return spliceLines(lines, first, last+1, nil), nil
+	}
+
+	insert := append(append([]string{begin}, block...), end)
+	if first != -1 {
+		return spliceLines(lines, first, last+1, insert), nil
+	}
+	i, err := insertIndex(lines, opts.InsertBefore, opts.InsertAfter)
+	if err != nil {
+		return nil, err
+	}
+	return spliceLines(lines, i, i, insert), nil
+}
+
+//backupFile writes data, the current contents of path, to a timestamped copy
+//next to it with the same mode
+func backupFile(path string, data []byte) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	backup := path + "." + time.Now().Format("20060102150405") + "~"
+	err = writeFileAtomic(backup, bytes.NewReader(data), fi.Mode().Perm(), -1, -1)
+	if err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+//editFile reads the file, applies edit to its lines and atomically writes
+//it back if anything changed. A missing file is treated as empty if create
+//is set and new files get mode (0644 if 0).
+func editFile(path string, create bool, mode os.FileMode, backup bool, dryRun bool,
+	edit func([]string) ([]string, error)) (*EditResult, error) {
+	exists := true
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		exists = false
+	} else if err != nil {
+		return nil, err
+	}
+
+	before := splitLines(data)
+	after, err := edit(before)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EditResult{}
+	if equalLines(before, after) {
+		return result, nil
+	}
+	result.Changed = true
+	result.Diff = unifiedDiff(path, before, after)
+	if dryRun {
+		return result, nil
+	}
+
+	if exists && backup {
+		result.Backup, err = backupFile(path, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if exists {
+		mode = 0
+	} else if mode == 0 {
+		mode = 0644
+	}
+	err = writeFileAtomic(path, bytes.NewReader(joinLines(after)), mode, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//LineInFile makes sure a line is present in or absent from the file. The
+//file is only rewritten if it changes, and then atomically.
+func (fs *Fs) LineInFile(path string, opts *LineInFileOptions) (*EditResult, error) {
+	log.Debugln("LineInFile ENTER")
+	log.Debugln("path:", path)
+
+	if opts == nil || strings.Contains(opts.Line, "\n") ||
+		(opts.State != LineStateAbsent && len(opts.Line) == 0) ||
+		(opts.State == LineStateAbsent && len(opts.Line) == 0 && len(opts.Regexp) == 0) ||
+		(opts.Backrefs && len(opts.Regexp) == 0) {
+		log.Debugln("Invalid options")
+		log.Debugln("LineInFile LEAVE")
+		return nil, ErrInvalidLineEdit
+	}
+
+	log.Debugln("line:", opts.Line)
+	log.Debugln("regexp:", opts.Regexp)
+	log.Debugln("state:", opts.State)
+
+	edit := func(lines []string) ([]string, error) {
+		return editLine(lines, opts)
+	}
+	create := opts.Create && opts.State != LineStateAbsent
+	result, err := editFile(path, create, opts.Mode, opts.Backup, opts.DryRun, edit)
+	if os.IsNotExist(err) && opts.State == LineStateAbsent {
+		log.Debugln("File does not exist. Nothing to remove.")
+		log.Debugln("LineInFile LEAVE")
+		return &EditResult{}, nil
+	}
+	if err != nil {
+		log.Debugln("editFile Failed:", err)
+		log.Debugln("LineInFile LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("LineInFile Changed:", result.Changed)
+	log.Debugln("LineInFile LEAVE")
+	return result, nil
+}
+
+//BlockInFile makes sure a block of lines surrounded by marker lines is
+//present in or absent from the file. An existing block is replaced in place.
+func (fs *Fs) BlockInFile(path string, opts *BlockInFileOptions) (*EditResult, error) {
+	log.Debugln("BlockInFile ENTER")
+	log.Debugln("path:", path)
+
+	if opts == nil {
+		log.Debugln("Invalid options")
+		log.Debugln("BlockInFile LEAVE")
+		return nil, ErrInvalidLineEdit
+	}
+
+	log.Debugln("marker:", opts.Marker)
+	log.Debugln("state:", opts.State)
+
+	edit := func(lines []string) ([]string, error) {
+		return editBlock(lines, opts)
+	}
+	create := opts.Create && opts.State != LineStateAbsent
+	result, err := editFile(path, create, opts.Mode, opts.Backup, opts.DryRun, edit)
+	if os.IsNotExist(err) && (opts.State == LineStateAbsent || len(opts.Block) == 0) {
+		log.Debugln("File does not exist. Nothing to remove.")
+		log.Debugln("BlockInFile LEAVE")
+		return &EditResult{}, nil
+	}
+	if err != nil {
+		log.Debugln("editFile Failed:", err)
+		log.Debugln("BlockInFile LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("BlockInFile Changed:", result.Changed)
+	log.Debugln("BlockInFile LEAVE")
+	return result, nil
+}
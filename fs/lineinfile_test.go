@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+const testSshdConfig = `Port 22
+#PermitRootLogin yes
+PasswordAuthentication yes
+UsePAM yes
+`
+
+func TestLineInFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lineinfile")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sshd_config")
+	ioutil.WriteFile(path, []byte(testSshdConfig), 0600)
+
+	result, err := fs.LineInFile(path, &LineInFileOptions{
+		Regexp: "^#?PermitRootLogin",
+		Line:   "PermitRootLogin no",
+		Backup: true,
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+	assert.Equal(t, "--- "+path+"\n+++ "+path+"\n@@ -1,4 +1,4 @@\n Port 22\n-#PermitRootLogin yes\n+PermitRootLogin no\n PasswordAuthentication yes\n UsePAM yes\n", result.Diff)
+	backup, _ := ioutil.ReadFile(result.Backup)
+	assert.Equal(t, testSshdConfig, string(backup))
+	info, _ := os.Stat(path)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	result, err = fs.LineInFile(path, &LineInFileOptions{
+		Regexp: "^#?PermitRootLogin",
+		Line:   "PermitRootLogin no",
+	})
+	assert.Equal(t, nil, err)
+	assert.False(t, result.Changed)
+
+	result, err = fs.LineInFile(path, &LineInFileOptions{
+		Regexp:   "^Port (\\d+)$",
+		Line:     "Port ${1}22",
+		Backrefs: true,
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+
+	result, err = fs.LineInFile(path, &LineInFileOptions{
+		Regexp:   "^ListenAddress (.*)$",
+		Line:     "ListenAddress ${1}",
+		Backrefs: true,
+	})
+	assert.Equal(t, nil, err)
+	assert.False(t, result.Changed)
+
+	result, err = fs.LineInFile(path, &LineInFileOptions{
+		Line:        "AllowUsers admin",
+		InsertAfter: "^PermitRootLogin",
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+
+	result, err = fs.LineInFile(path, &LineInFileOptions{
+		Line:         "# managed",
+		InsertBefore: InsertBOF,
+	})
+	assert.Equal(t, nil, err)
+
+	result, err = fs.LineInFile(path, &LineInFileOptions{
+		Regexp: "^PasswordAuthentication",
+		State:  LineStateAbsent,
+		DryRun: true,
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+
+	result, err = fs.LineInFile(path, &LineInFileOptions{
+		Line:  "UsePAM yes",
+		State: LineStateAbsent,
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "# managed\nPort 2222\nPermitRootLogin no\nAllowUsers admin\nPasswordAuthentication yes\n", string(data))
+
+	_, err = fs.LineInFile(filepath.Join(dir, "missing"), &LineInFileOptions{Line: "x"})
+	assert.True(t, os.IsNotExist(err))
+	result, err = fs.LineInFile(filepath.Join(dir, "new"), &LineInFileOptions{Line: "x", Create: true})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+	_, err = fs.LineInFile(path, &LineInFileOptions{Line: "a\nb"})
+	assert.Equal(t, ErrInvalidLineEdit, err)
+}
+
+func TestBlockInFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockinfile")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hosts")
+	ioutil.WriteFile(path, []byte("127.0.0.1 localhost\n::1 localhost"), 0644)
+
+	result, err := fs.BlockInFile(path, &BlockInFileOptions{
+		Block: "10.0.0.1 node1\n10.0.0.2 node2\n",
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+
+	result, err = fs.BlockInFile(path, &BlockInFileOptions{
+		Block: "10.0.0.1 node1\n10.0.0.2 node2\n",
+	})
+	assert.Equal(t, nil, err)
+	assert.False(t, result.Changed)
+
+	result, err = fs.BlockInFile(path, &BlockInFileOptions{
+		Block: "10.0.0.3 node3",
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "127.0.0.1 localhost\n::1 localhost\n# BEGIN MANAGED BLOCK\n10.0.0.3 node3\n# END MANAGED BLOCK\n", string(data))
+
+	result, err = fs.BlockInFile(path, &BlockInFileOptions{State: LineStateAbsent})
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "127.0.0.1 localhost\n::1 localhost\n", string(data))
+
+	ioutil.WriteFile(path, []byte("# BEGIN MANAGED BLOCK\nhalf\n"), 0644)
+	_, err = fs.BlockInFile(path, &BlockInFileOptions{Block: "x"})
+	assert.Equal(t, ErrInvalidBlockMarkers, err)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+	b := []string{"1", "two", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13"}
+	assert.Equal(t, "--- f\n+++ f\n@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n", unifiedDiff("f", a, b))
+	assert.Equal(t, "", unifiedDiff("f", a, a))
+	assert.Equal(t, "--- f\n+++ f\n@@ -0,0 +1,1 @@\n+x\n", unifiedDiff("f", nil, []string{"x"}))
+
+	//changes too large for the LCS table are replaced as a whole
+	big := make([]string, 3000)
+	other := make([]string, 3000)
+	for i := range big {
+		big[i] = strconv.Itoa(i)
+		other[i] = "x" + strconv.Itoa(i)
+	}
+	ops := diffLines(append([]string{"same"}, big...), append([]string{"same"}, other...))
+	assert.Equal(t, 6001, len(ops))
+	assert.Equal(t, diffOp{' ', "same"}, ops[0])
+	assert.Equal(t, diffOp{'-', "0"}, ops[1])
+	assert.Equal(t, diffOp{'+', "x0"}, ops[3001])
+}
@@ -0,0 +1,325 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//DefaultLockTimeout is how long the library waits for its own named locks
+	DefaultLockTimeout = 5 * time.Minute
+
+	defaultLockDir = "/var/lock"
+
+	lockPollMin = 10 * time.Millisecond
+	lockPollMax = 250 * time.Millisecond
+)
+
+var (
+	//ErrLockHeld the lock is held by someone else
+	ErrLockHeld = errors.New("Lock is held by another process")
+
+	//ErrLockTimeout gave up waiting for the lock
+	ErrLockTimeout = errors.New("Timed out waiting for the lock")
+
+	//ErrInvalidLockName the lock name is empty or contains a path separator
+	ErrInvalidLockName = errors.New("Invalid lock name")
+)
+
+//FileLock is an advisory flock(2) lock on a file. The kernel drops it when
+//the process exits, so a crashed holder never leaves the file locked. An
+//exclusive holder records its PID in the file so waiters can see who holds
+//it and a leftover PID shows the previous holder did not unlock cleanly.
+type FileLock struct {
+	mutex     sync.Mutex
+	path      string
+	file      *os.File
+	exclusive bool
+	writable  bool
+}
+
+//LockHolder describes the last exclusive holder of a lock file. Held says
+//whether the file is locked right now. A PID that is not Alive while the
+//file is not Held is a stale record left by a holder that crashed.
+type LockHolder struct {
+	PID   int
+	Alive bool
+	Held  bool
+}
+
+//SetLockDir sets the directory named locks are created in. An empty dir uses
+//the default /var/lock.
+func (fs *Fs) SetLockDir(dir string) {
+	fs.lockDir = dir
+}
+
+//GetLockDir returns the directory named locks are created in
+func (fs *Fs) GetLockDir() string {
+	if len(fs.lockDir) > 0 {
+		return fs.lockDir
+	}
+	return defaultLockDir
+}
+
+func (fs *Fs) lockPath(name string) (string, error) {
+	if len(name) == 0 || strings.ContainsRune(name, os.PathSeparator) {
+		return "", ErrInvalidLockName
+	}
+	return filepath.Join(fs.GetLockDir(), "goxplatform."+name+".lock"), nil
+}
+
+func readLockPID(file *os.File) int {
+	buf := make([]byte, 32)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+//tryLock makes a single attempt at the lock and returns ErrLockHeld if
+//someone else has it
+func tryLock(path string, exclusive bool) (*FileLock, error) {
+	file, writable, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := tryFlock(file, exclusive)
+	if err != nil || !ok {
+		file.Close()
+		if err == nil {
+			err = ErrLockHeld
+		}
+		return nil, err
+	}
+
+	if exclusive && writable {
+		if pid := readLockPID(file); pid > 0 && pid != os.Getpid() {
+			log.Warnln("Lock", path, "was not released cleanly by pid", pid)
+		}
+		err = file.Truncate(0)
+		if err == nil {
+			_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+		}
+		if err != nil {
+			unlockFlock(file)
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return &FileLock{
+		path:      path,
+		file:      file,
+		exclusive: exclusive,
+		writable:  writable,
+	}, nil
+}
+
+//waitLock retries tryLock with backoff until it succeeds or ctx is done
+func waitLock(ctx context.Context, path string, exclusive bool) (*FileLock, error) {
+	wait := lockPollMin
+	for {
+		lock, err := tryLock(path, exclusive)
+		if err != ErrLockHeld {
+			return lock, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrLockTimeout
+			}
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		wait *= 2
+		if wait > lockPollMax {
+			wait = lockPollMax
+		}
+	}
+}
+
+//LockFile waits until it gets a shared or exclusive lock on path, creating
+//the file if needed. Returns ErrLockTimeout if the deadline of ctx passes.
+func (fs *Fs) LockFile(ctx context.Context, path string, exclusive bool) (*FileLock, error) {
+	log.Debugln("LockFile ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("exclusive:", exclusive)
+
+	lock, err := waitLock(ctx, path, exclusive)
+	if err != nil {
+		log.Debugln("waitLock Failed:", err)
+		log.Debugln("LockFile LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("LockFile succeeded")
+	log.Debugln("LockFile LEAVE")
+	return lock, nil
+}
+
+//TryLockFile gets a shared or exclusive lock on path without waiting.
+//Returns ErrLockHeld if someone else holds a conflicting lock.
+func (fs *Fs) TryLockFile(path string, exclusive bool) (*FileLock, error) {
+	log.Debugln("TryLockFile ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("exclusive:", exclusive)
+
+	lock, err := tryLock(path, exclusive)
+	if err != nil {
+		log.Debugln("tryLock Failed:", err)
+		log.Debugln("TryLockFile LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("TryLockFile succeeded")
+	log.Debugln("TryLockFile LEAVE")
+	return lock, nil
+}
+
+//Lock takes the exclusive named lock in the lock directory, waiting up to
+//timeout for it. A timeout of 0 waits forever. The library takes these
+//around its own edits of shared system files.
+func (fs *Fs) Lock(name string, timeout time.Duration) (*FileLock, error) {
+	log.Debugln("Lock ENTER")
+	log.Debugln("name:", name)
+	log.Debugln("timeout:", timeout)
+
+	path, err := fs.lockPath(name)
+	if err != nil {
+		log.Debugln("Invalid lock name")
+		log.Debugln("Lock LEAVE")
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	lock, err := waitLock(ctx, path, true)
+	if err != nil {
+		log.Debugln("waitLock Failed:", err)
+		log.Debugln("Lock LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("Lock succeeded")
+	log.Debugln("Lock LEAVE")
+	return lock, nil
+}
+
+//TryLock takes the exclusive named lock without waiting. Returns ErrLockHeld
+//if someone else holds it.
+func (fs *Fs) TryLock(name string) (*FileLock, error) {
+	log.Debugln("TryLock ENTER")
+	log.Debugln("name:", name)
+
+	path, err := fs.lockPath(name)
+	if err != nil {
+		log.Debugln("Invalid lock name")
+		log.Debugln("TryLock LEAVE")
+		return nil, err
+	}
+
+	lock, err := tryLock(path, true)
+	if err != nil {
+		log.Debugln("tryLock Failed:", err)
+		log.Debugln("TryLock LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("TryLock succeeded")
+	log.Debugln("TryLock LEAVE")
+	return lock, nil
+}
+
+//GetLockHolder reports the PID recorded in the lock file, whether that
+//process is still running and whether the file is locked right now
+func (fs *Fs) GetLockHolder(path string) (*LockHolder, error) {
+	log.Debugln("GetLockHolder ENTER")
+	log.Debugln("path:", path)
+
+	if _, err := os.Lstat(path); err != nil {
+		log.Debugln("Lstat Failed:", err)
+		log.Debugln("GetLockHolder LEAVE")
+		return nil, err
+	}
+	file, _, err := openLockFile(path)
+	if err != nil {
+		log.Debugln("openLockFile Failed:", err)
+		log.Debugln("GetLockHolder LEAVE")
+		return nil, err
+	}
+	defer file.Close()
+
+	holder := &LockHolder{
+		PID: readLockPID(file),
+	}
+	if holder.PID > 0 {
+		holder.Alive = processAlive(holder.PID)
+	}
+
+	//probing with an exclusive lock on our own descriptor conflicts with
+	//every other holder, including other descriptors in this process
+	ok, err := tryFlock(file, true)
+	if err != nil {
+		log.Debugln("tryFlock Failed:", err)
+		log.Debugln("GetLockHolder LEAVE")
+		return nil, err
+	}
+	if ok {
+		unlockFlock(file)
+	}
+	holder.Held = !ok
+
+	log.Debugln("PID:", holder.PID, "Alive:", holder.Alive, "Held:", holder.Held)
+	log.Debugln("GetLockHolder LEAVE")
+	return holder, nil
+}
+
+//Path returns the path of the lock file
+func (fl *FileLock) Path() string {
+	return fl.path
+}
+
+//Unlock releases the lock. Unlocking more than once is harmless.
+func (fl *FileLock) Unlock() error {
+	fl.mutex.Lock()
+	defer fl.mutex.Unlock()
+
+	if fl.file == nil {
+		return nil
+	}
+
+	//clear our PID first so it is not mistaken for a crashed holder
+	if fl.exclusive && fl.writable {
+		fl.file.Truncate(0)
+	}
+	err := unlockFlock(fl.file)
+	if errClose := fl.file.Close(); err == nil {
+		err = errClose
+	}
+	fl.file = nil
+	return err
+}
@@ -0,0 +1,54 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+//openLockFile opens or creates the lock file without following a symlink
+//planted in its place. Other users' lock files may only be readable, which
+//is enough for flock but not for recording our PID.
+func openLockFile(path string) (*os.File, bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0644)
+	if err == nil {
+		return file, true, nil
+	}
+	if !os.IsPermission(err) {
+		return nil, false, err
+	}
+	file, err = os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return file, false, nil
+}
+
+//tryFlock takes the lock without blocking. Returns false if someone else
+//holds a conflicting lock.
+func tryFlock(file *os.File, exclusive bool) (bool, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+		switch err {
+		case nil:
+			return true, nil
+		case syscall.EWOULDBLOCK:
+			return false, nil
+		case syscall.EINTR:
+			continue
+		}
+		return false, err
+	}
+}
+
+func unlockFlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	"os"
+
+	common "github.com/dvonthenen/goxplatform/common"
+)
+
+func openLockFile(path string) (*os.File, bool, error) {
+	return nil, false, common.ErrNotImplemented
+}
+
+func tryFlock(file *os.File, exclusive bool) (bool, error) {
+	return false, common.ErrNotImplemented
+}
+
+func unlockFlock(file *os.File) error {
+	return common.ErrNotImplemented
+}
+
+func processAlive(pid int) bool {
+	return false
+}
@@ -0,0 +1,95 @@
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.lock")
+	shared1, err := fs.TryLockFile(path, false)
+	assert.Equal(t, nil, err)
+	shared2, err := fs.TryLockFile(path, false)
+	assert.Equal(t, nil, err)
+	_, err = fs.TryLockFile(path, true)
+	assert.Equal(t, ErrLockHeld, err)
+	shared1.Unlock()
+	shared2.Unlock()
+
+	lock, err := fs.TryLockFile(path, true)
+	assert.Equal(t, nil, err)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+	holder, err := fs.GetLockHolder(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, os.Getpid(), holder.PID)
+	assert.True(t, holder.Alive)
+	assert.True(t, holder.Held)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = fs.LockFile(ctx, path, false)
+	assert.Equal(t, ErrLockTimeout, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lock.Unlock()
+	}()
+	waited, err := fs.LockFile(context.Background(), path, true)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, waited.Unlock())
+	assert.Equal(t, nil, waited.Unlock())
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "", string(data))
+}
+
+func TestStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command("true")
+	assert.Equal(t, nil, cmd.Run())
+	deadPID := cmd.Process.Pid
+
+	lockFs := NewFs()
+	lockFs.SetLockDir(dir)
+	path, err := lockFs.lockPath("init")
+	assert.Equal(t, nil, err)
+	ioutil.WriteFile(path, []byte(strconv.Itoa(deadPID)+"\n"), 0644)
+
+	holder, err := lockFs.GetLockHolder(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, deadPID, holder.PID)
+	assert.False(t, holder.Alive)
+	assert.False(t, holder.Held)
+
+	lock, err := lockFs.Lock("init", time.Second)
+	assert.Equal(t, nil, err)
+	_, err = lockFs.TryLock("init")
+	assert.Equal(t, ErrLockHeld, err)
+	_, err = lockFs.Lock("init", 20*time.Millisecond)
+	assert.Equal(t, ErrLockTimeout, err)
+	lock.Unlock()
+
+	_, err = lockFs.TryLock("../init")
+	assert.Equal(t, ErrInvalidLockName, err)
+
+	os.Symlink(filepath.Join(dir, "victim"), filepath.Join(dir, "goxplatform.evil.lock"))
+	_, err = lockFs.TryLock("evil")
+	assert.NotEqual(t, nil, err)
+	_, err = os.Stat(filepath.Join(dir, "victim"))
+	assert.True(t, os.IsNotExist(err))
+}
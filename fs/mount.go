@@ -0,0 +1,191 @@
+package fs
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultMountInfoFile = "/proc/self/mountinfo"
+)
+
+//MountInfo is an entry in /proc/self/mountinfo
+type MountInfo struct {
+	ID       int
+	ParentID int
+	Major    int
+	Minor    int
+
+	//Root is the path within the filesystem that is mounted
+	Root       string
+	MountPoint string
+	Options    string
+	FsType     string
+	Source     string
+
+	//SuperOptions are the per superblock options
+	SuperOptions string
+}
+
+//HasOption returns true if the mount or superblock options contain option
+func (mi *MountInfo) HasOption(option string) bool {
+	for _, opts := range []string{mi.Options, mi.SuperOptions} {
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == option {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//unescapeMountPath decodes the octal escapes (\040) the kernel uses for
+//spaces, tabs, newlines and backslashes in mount paths
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	out := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if val, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				out = append(out, byte(val))
+				i += 3
+				continue
+			}
+		}
+		out = append(out, path[i])
+	}
+	return string(out)
+}
+
+func parseMountInfo(reader io.Reader) ([]*MountInfo, error) {
+	list := []*MountInfo{}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep == -1 || len(fields) < sep+3 {
+			log.Debugln("Skipping invalid mountinfo line:", line)
+			continue
+		}
+
+		mi := &MountInfo{
+			Root:       unescapeMountPath(fields[3]),
+			MountPoint: unescapeMountPath(fields[4]),
+			Options:    fields[5],
+			FsType:     fields[sep+1],
+			Source:     unescapeMountPath(fields[sep+2]),
+		}
+		if len(fields) > sep+3 {
+			mi.SuperOptions = fields[sep+3]
+		}
+		mi.ID, _ = strconv.Atoi(fields[0])
+		mi.ParentID, _ = strconv.Atoi(fields[1])
+		devs := strings.Split(fields[2], ":")
+		if len(devs) == 2 {
+			mi.Major, _ = strconv.Atoi(devs[0])
+			mi.Minor, _ = strconv.Atoi(devs[1])
+		}
+
+		list = append(list, mi)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//findMountForPath returns the mount that contains path. When mounts are
+//stacked on the same mount point the last one wins.
+func findMountForPath(mounts []*MountInfo, path string) *MountInfo {
+	var found *MountInfo
+	for _, mi := range mounts {
+		mp := mi.MountPoint
+		if path != mp && mp != "/" && !strings.HasPrefix(path, mp+"/") {
+			continue
+		}
+		if found == nil || len(mp) >= len(found.MountPoint) {
+			found = mi
+		}
+	}
+	return found
+}
+
+//GetMounts returns the mounts visible to this process
+func (fs *Fs) GetMounts() ([]*MountInfo, error) {
+	log.Debugln("GetMounts ENTER")
+
+	file, err := os.Open(defaultMountInfoFile)
+	if err != nil {
+		log.Debugln("Open Failed:", err)
+		log.Debugln("GetMounts LEAVE")
+		return nil, err
+	}
+	defer file.Close()
+
+	list, err := parseMountInfo(file)
+	if err != nil {
+		log.Debugln("parseMountInfo Failed:", err)
+		log.Debugln("GetMounts LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetMounts Count:", len(list))
+	log.Debugln("GetMounts LEAVE")
+	return list, nil
+}
+
+//GetMountForPath returns the mount that contains path
+func (fs *Fs) GetMountForPath(path string) (*MountInfo, error) {
+	log.Debugln("GetMountForPath ENTER")
+	log.Debugln("path:", path)
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		log.Debugln("EvalSymlinks Failed:", err)
+		log.Debugln("GetMountForPath LEAVE")
+		return nil, err
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		log.Debugln("Abs Failed:", err)
+		log.Debugln("GetMountForPath LEAVE")
+		return nil, err
+	}
+
+	mounts, err := fs.GetMounts()
+	if err != nil {
+		log.Debugln("GetMounts Failed:", err)
+		log.Debugln("GetMountForPath LEAVE")
+		return nil, err
+	}
+
+	mi := findMountForPath(mounts, realPath)
+	if mi == nil {
+		log.Debugln("No mount found for", realPath)
+		log.Debugln("GetMountForPath LEAVE")
+		return nil, ErrNotMounted
+	}
+
+	log.Debugln("GetMountForPath =", mi.MountPoint)
+	log.Debugln("GetMountForPath LEAVE")
+	return mi, nil
+}
@@ -0,0 +1,157 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//FsStats describes the capacity of the filesystem containing a path
+type FsStats struct {
+	Path       string
+	MountPoint string
+	Source     string
+	FsType     string
+	BlockSize  int64
+
+	TotalBytes     uint64
+	FreeBytes      uint64
+	AvailableBytes uint64
+
+	TotalInodes uint64
+	FreeInodes  uint64
+
+	ReadOnly bool
+}
+
+//InsufficientSpaceError is returned when a path does not have the requested
+//amount of free space
+type InsufficientSpaceError struct {
+	Path      string
+	Required  uint64
+	Available uint64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("Insufficient space at %s: %d bytes required, %d bytes available",
+		e.Path, e.Required, e.Available)
+}
+
+//nearestExistingPath walks up path until it finds something that exists so
+//callers can ask about a destination that has not been created yet
+func nearestExistingPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", ErrSrcNotExist
+		}
+		path = parent
+	}
+}
+
+//GetFsStats returns the capacity, inode usage, type and read-only status of the
+//filesystem containing path. If path is a block device, the filesystem it is
+//mounted on is reported.
+func (fs *Fs) GetFsStats(path string) (*FsStats, error) {
+	log.Debugln("GetFsStats ENTER")
+	log.Debugln("path:", path)
+
+	target, err := nearestExistingPath(path)
+	if err != nil {
+		log.Debugln("nearestExistingPath Failed:", err)
+		log.Debugln("GetFsStats LEAVE")
+		return nil, err
+	}
+
+	var mi *MountInfo
+	if major, minor, ok := blockDeviceNumber(target); ok {
+		mounts, errMounts := fs.GetMounts()
+		if errMounts != nil {
+			log.Debugln("GetMounts Failed:", errMounts)
+			log.Debugln("GetFsStats LEAVE")
+			return nil, errMounts
+		}
+		for _, m := range mounts {
+			if m.Major == major && m.Minor == minor {
+				mi = m
+				break
+			}
+		}
+		if mi == nil {
+			log.Debugln("Device is not mounted:", target)
+			log.Debugln("GetFsStats LEAVE")
+			return nil, ErrNotMounted
+		}
+		target = mi.MountPoint
+	} else {
+		mi, err = fs.GetMountForPath(target)
+		if err != nil {
+			log.Debugln("GetMountForPath Failed:", err)
+			mi = nil
+		}
+	}
+
+	stats, err := statfs(target)
+	if err != nil {
+		log.Debugln("statfs Failed:", err)
+		log.Debugln("GetFsStats LEAVE")
+		return nil, err
+	}
+	stats.Path = path
+
+	if mi != nil {
+		stats.MountPoint = mi.MountPoint
+		stats.Source = mi.Source
+		stats.FsType = mi.FsType
+		stats.ReadOnly = stats.ReadOnly || mi.HasOption("ro")
+	}
+
+	log.Debugln("GetFsStats Type:", stats.FsType, "Available:", stats.AvailableBytes)
+	log.Debugln("GetFsStats LEAVE")
+	return stats, nil
+}
+
+//RequireFreeSpace returns an InsufficientSpaceError if the filesystem that
+//contains path, or would contain it once created, has less than required
+//bytes available to unprivileged users
+func (fs *Fs) RequireFreeSpace(path string, required uint64) error {
+	log.Debugln("RequireFreeSpace ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("required:", required)
+
+	stats, err := fs.GetFsStats(path)
+	if err != nil {
+		log.Debugln("GetFsStats Failed:", err)
+		log.Debugln("RequireFreeSpace LEAVE")
+		return err
+	}
+
+	if stats.ReadOnly {
+		log.Debugln("Filesystem is read-only")
+		log.Debugln("RequireFreeSpace LEAVE")
+		return ErrReadOnlyFilesystem
+	}
+
+	if stats.AvailableBytes < required {
+		log.Debugln("Not enough space. Available:", stats.AvailableBytes)
+		log.Debugln("RequireFreeSpace LEAVE")
+		return &InsufficientSpaceError{
+			Path:      path,
+			Required:  required,
+			Available: stats.AvailableBytes,
+		}
+	}
+
+	log.Debugln("RequireFreeSpace Succeeded")
+	log.Debugln("RequireFreeSpace LEAVE")
+	return nil
+}
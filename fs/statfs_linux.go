@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	stRdOnly = 0x1
+)
+
+var (
+	//the magic is a signed 32-bit value on 32-bit targets so it is looked up
+	//as unsigned
+	fsMagicTypes = map[uint32]string{
+		0xEF53:     "ext4",
+		0x58465342: "xfs",
+		0x9123683E: "btrfs",
+		0x01021994: "tmpfs",
+		0x858458F6: "ramfs",
+		0x6969:     "nfs",
+		0xFF534D42: "cifs",
+		0x794C7630: "overlay",
+		0x2FC12FC1: "zfs",
+		0x4D44:     "vfat",
+		0x5346544E: "ntfs",
+		0x73717368: "squashfs",
+		0x9660:     "iso9660",
+		0x65735546: "fuse",
+		0x9FA0:     "proc",
+		0x62656572: "sysfs",
+		0x63677270: "cgroup2",
+	}
+)
+
+func statfs(path string) (*FsStats, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return nil, err
+	}
+
+	bsize := uint64(st.Bsize)
+	if st.Frsize > 0 {
+		bsize = uint64(st.Frsize)
+	}
+
+	stats := &FsStats{
+		FsType:         fsMagicTypes[uint32(st.Type)],
+		BlockSize:      int64(bsize),
+		TotalBytes:     uint64(st.Blocks) * bsize,
+		FreeBytes:      uint64(st.Bfree) * bsize,
+		AvailableBytes: uint64(st.Bavail) * bsize,
+		TotalInodes:    uint64(st.Files),
+		FreeInodes:     uint64(st.Ffree),
+		ReadOnly:       st.Flags&stRdOnly != 0,
+	}
+	if len(stats.FsType) == 0 {
+		stats.FsType = "unknown"
+	}
+
+	return stats, nil
+}
+
+func blockDeviceNumber(path string) (int, int, bool) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 {
+		return 0, 0, false
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	rdev := uint64(st.Rdev)
+	major := int((rdev>>8)&0xfff | (rdev>>32)&0xfffff000)
+	minor := int(rdev&0xff | (rdev>>12)&0xffffff00)
+	return major, minor, true
+}
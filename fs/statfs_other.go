@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	common "github.com/dvonthenen/goxplatform/common"
+)
+
+func statfs(path string) (*FsStats, error) {
+	return nil, common.ErrNotImplemented
+}
+
+func blockDeviceNumber(path string) (int, int, bool) {
+	return 0, 0, false
+}
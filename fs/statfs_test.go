@@ -0,0 +1,53 @@
+package fs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+const testMountInfo = `17 23 0:16 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+23 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro,data=ordered
+40 23 8:17 / /mnt/my\040data rw,relatime shared:20 - xfs /dev/sdb1 rw,attr2,inode64,noquota
+41 40 0:45 / /mnt/my\040data/share ro,relatime shared:21 - nfs4 10.0.0.1:/export ro,vers=4.1
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(testMountInfo))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(mounts))
+	assert.Equal(t, "/mnt/my data", mounts[2].MountPoint)
+	assert.Equal(t, "xfs", mounts[2].FsType)
+	assert.Equal(t, 8, mounts[2].Major)
+	assert.Equal(t, 17, mounts[2].Minor)
+	assert.Equal(t, "10.0.0.1:/export", mounts[3].Source)
+	assert.True(t, mounts[3].HasOption("ro"))
+	assert.False(t, mounts[2].HasOption("ro"))
+}
+
+func TestFindMountForPath(t *testing.T) {
+	mounts, _ := parseMountInfo(strings.NewReader(testMountInfo))
+	assert.Equal(t, "/", findMountForPath(mounts, "/var/lib").MountPoint)
+	assert.Equal(t, "/mnt/my data", findMountForPath(mounts, "/mnt/my data/file").MountPoint)
+	assert.Equal(t, "/mnt/my data/share", findMountForPath(mounts, "/mnt/my data/share").MountPoint)
+	assert.Equal(t, "/", findMountForPath(mounts, "/mnt/my database").MountPoint)
+}
+
+func TestGetFsStats(t *testing.T) {
+	stats, err := fs.GetFsStats(os.TempDir())
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, "", stats.FsType)
+	assert.True(t, stats.TotalBytes > 0)
+	assert.True(t, stats.AvailableBytes <= stats.TotalBytes)
+}
+
+func TestRequireFreeSpace(t *testing.T) {
+	err := fs.RequireFreeSpace(os.TempDir()+"/does/not/exist/yet", 1)
+	assert.Equal(t, nil, err)
+
+	err = fs.RequireFreeSpace(os.TempDir(), 1<<62)
+	_, ok := err.(*InsufficientSpaceError)
+	assert.True(t, ok)
+}
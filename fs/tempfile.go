@@ -0,0 +1,171 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//SetTempDir sets the directory temporary files and directories are created
+//in. An empty dir uses the system default ($TMPDIR or /tmp).
+func (fs *Fs) SetTempDir(dir string) {
+	fs.tempDir = dir
+}
+
+//GetTempDir returns the directory temporary files and directories are
+//created in
+func (fs *Fs) GetTempDir() string {
+	if len(fs.tempDir) > 0 {
+		return fs.tempDir
+	}
+	return os.TempDir()
+}
+
+//checkTempDir makes sure nobody else can swap entries in dir. A directory
+//others can write to must be sticky so they cannot replace our files.
+func checkTempDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return ErrInsecureTempDir
+	}
+	if fi.Mode().Perm()&0002 != 0 && fi.Mode()&os.ModeSticky == 0 {
+		return ErrInsecureTempDir
+	}
+	return nil
+}
+
+func validateTempPattern(pattern string) error {
+	if strings.ContainsRune(pattern, os.PathSeparator) {
+		return ErrInvalidTempPattern
+	}
+	return nil
+}
+
+//TempFile creates a new file readable only by the current user with a
+//random name starting with pattern (a "*" in pattern is replaced by the
+//random part). The file is created exclusively so an existing file or
+//symlink is never reused. The caller removes the file when done.
+func (fs *Fs) TempFile(pattern string) (*os.File, error) {
+	log.Debugln("TempFile ENTER")
+	log.Debugln("pattern:", pattern)
+
+	dir := fs.GetTempDir()
+	err := validateTempPattern(pattern)
+	if err == nil {
+		err = checkTempDir(dir)
+	}
+	if err != nil {
+		log.Debugln("Invalid temp dir or pattern:", err)
+		log.Debugln("TempFile LEAVE")
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		log.Debugln("TempFile Failed:", err)
+		log.Debugln("TempFile LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("TempFile =", file.Name())
+	log.Debugln("TempFile LEAVE")
+	return file, nil
+}
+
+//TempDir creates a new directory accessible only by the current user with a
+//random name starting with pattern. The caller removes the directory when
+//done.
+func (fs *Fs) TempDir(pattern string) (string, error) {
+	log.Debugln("TempDir ENTER")
+	log.Debugln("pattern:", pattern)
+
+	dir := fs.GetTempDir()
+	err := validateTempPattern(pattern)
+	if err == nil {
+		err = checkTempDir(dir)
+	}
+	if err != nil {
+		log.Debugln("Invalid temp dir or pattern:", err)
+		log.Debugln("TempDir LEAVE")
+		return "", err
+	}
+
+	path, err := ioutil.TempDir(dir, pattern)
+	if err != nil {
+		log.Debugln("TempDir Failed:", err)
+		log.Debugln("TempDir LEAVE")
+		return "", err
+	}
+
+	log.Debugln("TempDir =", path)
+	log.Debugln("TempDir LEAVE")
+	return path, nil
+}
+
+//TempScope tracks the temporary files and directories created through it so
+//they can be removed with a single deferred Cleanup call
+type TempScope struct {
+	fs    *Fs
+	mutex sync.Mutex
+	paths []string
+}
+
+//NewTempScope generates a TempScope that creates temporary files through
+//this Fs
+func (fs *Fs) NewTempScope() *TempScope {
+	myTempScope := &TempScope{
+		fs: fs,
+	}
+	return myTempScope
+}
+
+func (ts *TempScope) add(path string) {
+	ts.mutex.Lock()
+	ts.paths = append(ts.paths, path)
+	ts.mutex.Unlock()
+}
+
+//TempFile creates a temporary file and registers it for removal
+func (ts *TempScope) TempFile(pattern string) (*os.File, error) {
+	file, err := ts.fs.TempFile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	ts.add(file.Name())
+	return file, nil
+}
+
+//TempDir creates a temporary directory and registers it for removal
+func (ts *TempScope) TempDir(pattern string) (string, error) {
+	path, err := ts.fs.TempDir(pattern)
+	if err != nil {
+		return "", err
+	}
+	ts.add(path)
+	return path, nil
+}
+
+//Cleanup removes the registered files and directories, newest first. Every
+//item is attempted and the first error is returned.
+func (ts *TempScope) Cleanup() error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	var first error
+	for i := len(ts.paths) - 1; i >= 0; i-- {
+		if err := os.RemoveAll(ts.paths[i]); err != nil {
+			log.Warnln("Remove failed:", ts.paths[i], "Err:", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	ts.paths = nil
+	return first
+}
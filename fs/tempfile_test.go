@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestTempFileAndDir(t *testing.T) {
+	base, err := ioutil.TempDir("", "tempbase")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(base)
+
+	myFs := NewFs()
+	myFs.SetTempDir(base)
+	assert.Equal(t, base, myFs.GetTempDir())
+
+	file, err := myFs.TempFile("service.")
+	assert.Equal(t, nil, err)
+	file.Close()
+	assert.True(t, strings.HasPrefix(file.Name(), filepath.Join(base, "service.")))
+	info, _ := os.Stat(file.Name())
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	dir, err := myFs.TempDir("scratch")
+	assert.Equal(t, nil, err)
+	info, _ = os.Stat(dir)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	_, err = myFs.TempFile("../escape")
+	assert.Equal(t, ErrInvalidTempPattern, err)
+
+	os.Chmod(base, 0777)
+	_, err = myFs.TempFile("service.")
+	assert.Equal(t, ErrInsecureTempDir, err)
+	os.Chmod(base, 0777|os.ModeSticky)
+	_, err = myFs.TempDir("scratch")
+	assert.Equal(t, nil, err)
+}
+
+func TestTempScopeCleanup(t *testing.T) {
+	base, err := ioutil.TempDir("", "tempbase")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(base)
+
+	myFs := NewFs()
+	myFs.SetTempDir(base)
+	scope := myFs.NewTempScope()
+
+	file, err := scope.TempFile("key")
+	assert.Equal(t, nil, err)
+	file.Close()
+	dir, err := scope.TempDir("work")
+	assert.Equal(t, nil, err)
+	ioutil.WriteFile(filepath.Join(dir, "data"), []byte("x"), 0600)
+
+	assert.Equal(t, nil, scope.Cleanup())
+	entries, _ := ioutil.ReadDir(base)
+	assert.Equal(t, 0, len(entries))
+}
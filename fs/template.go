@@ -0,0 +1,272 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	//ErrUnknownOwner the owner or group for the rendered file does not exist
+	ErrUnknownOwner = errors.New("Unknown owner or group")
+)
+
+//HostFacts are the details about this host available to templates as .Host
+type HostFacts struct {
+	Hostname  string
+	ShortName string
+	OS        string
+	Arch      string
+	CPUs      int
+	Addresses []string
+}
+
+//TemplateData is what a template is executed with. Host holds the host facts
+//and Data whatever the caller passed in.
+type TemplateData struct {
+	Host *HostFacts
+	Data interface{}
+}
+
+//RenderOptions controls how a template is written out. A Mode of 0 keeps the
+//mode of an existing file (0644 for a new one) and an empty Owner or Group
+//keeps the existing one. Owner and Group are names or numeric ids. Facts
+//replaces the gathered host facts, which is mostly useful for tests.
+type RenderOptions struct {
+	Mode   os.FileMode
+	Owner  string
+	Group  string
+	Funcs  template.FuncMap
+	Facts  *HostFacts
+	Backup bool
+	DryRun bool
+}
+
+//lookupID resolves a user or group name or a numeric id. An empty name is -1.
+func lookupID(name string, group bool) (int, error) {
+	if len(name) == 0 {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	var id string
+	if group {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return -1, ErrUnknownOwner
+		}
+		id = g.Gid
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return -1, ErrUnknownOwner
+		}
+		id = u.Uid
+	}
+	return strconv.Atoi(id)
+}
+
+//GetHostFacts gathers the host facts that are passed to templates
+func (fs *Fs) GetHostFacts() (*HostFacts, error) {
+	log.Debugln("GetHostFacts ENTER")
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Debugln("Hostname Failed:", err)
+		log.Debugln("GetHostFacts LEAVE")
+		return nil, err
+	}
+
+	facts := &HostFacts{
+		Hostname:  hostname,
+		ShortName: strings.SplitN(hostname, ".", 2)[0],
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		Addresses: []string{},
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Debugln("InterfaceAddrs Failed:", err)
+		log.Debugln("GetHostFacts LEAVE")
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		facts.Addresses = append(facts.Addresses, ipnet.IP.String())
+	}
+
+	log.Debugln("Hostname:", facts.Hostname)
+	log.Debugln("GetHostFacts LEAVE")
+	return facts, nil
+}
+
+//RenderTemplate executes the text/template with the host facts and data and
+//writes the result to dst, atomically and only if the content, mode or owner
+//differ. Keys missing from data are an error rather than "<no value>". The
+//result says whether dst changed and holds a unified diff of the content.
+func (fs *Fs) RenderTemplate(text string, dst string, data interface{}, opts *RenderOptions) (*EditResult, error) {
+	log.Debugln("RenderTemplate ENTER")
+	log.Debugln("dst:", dst)
+
+	if opts == nil {
+		opts = &RenderOptions{}
+	}
+
+	uid, err := lookupID(opts.Owner, false)
+	if err != nil {
+		log.Debugln("Unknown owner:", opts.Owner)
+		log.Debugln("RenderTemplate LEAVE")
+		return nil, err
+	}
+	gid, err := lookupID(opts.Group, true)
+	if err != nil {
+		log.Debugln("Unknown group:", opts.Group)
+		log.Debugln("RenderTemplate LEAVE")
+		return nil, err
+	}
+
+	facts := opts.Facts
+	if facts == nil {
+		facts, err = fs.GetHostFacts()
+		if err != nil {
+			log.Debugln("GetHostFacts Failed:", err)
+			log.Debugln("RenderTemplate LEAVE")
+			return nil, err
+		}
+	}
+
+	tmpl, err := template.New(dst).Option("missingkey=error").Funcs(opts.Funcs).Parse(text)
+	if err != nil {
+		log.Debugln("Parse Failed:", err)
+		log.Debugln("RenderTemplate LEAVE")
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, &TemplateData{Host: facts, Data: data})
+	if err != nil {
+		log.Debugln("Execute Failed:", err)
+		log.Debugln("RenderTemplate LEAVE")
+		return nil, err
+	}
+	rendered := buffer.Bytes()
+
+	result := &EditResult{}
+	current, err := ioutil.ReadFile(dst)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		log.Debugln("ReadFile Failed:", err)
+		log.Debugln("RenderTemplate LEAVE")
+		return nil, err
+	}
+
+	contentChanged := !exists || !bytes.Equal(current, rendered)
+	metaChanged := false
+	if fi, errStat := os.Stat(dst); errStat == nil {
+		if opts.Mode != 0 && fi.Mode().Perm() != opts.Mode.Perm() {
+			metaChanged = true
+		}
+		if curUID, curGID, ok := fileOwner(fi); ok {
+			if (uid != -1 && uid != curUID) || (gid != -1 && gid != curGID) {
+				metaChanged = true
+			}
+		}
+	}
+	if !contentChanged && !metaChanged {
+		log.Debugln("RenderTemplate unchanged")
+		log.Debugln("RenderTemplate LEAVE")
+		return result, nil
+	}
+
+	result.Changed = true
+	if contentChanged {
+		result.Diff = unifiedDiff(dst, splitLines(current), splitLines(rendered))
+	}
+	if opts.DryRun {
+		log.Debugln("RenderTemplate dry run")
+		log.Debugln("RenderTemplate LEAVE")
+		return result, nil
+	}
+
+	if !contentChanged {
+		//only the mode or owner is off so fix them in place. Chmod and Chown
+		//follow a symlink so the journal records its target.
+		target := dst
+		if real, errEval := filepath.EvalSymlinks(dst); errEval == nil {
+			target = real
+		}
+		err = journalSnapshot(target)
+		if err == nil && opts.Mode != 0 {
+			err = os.Chmod(target, opts.Mode)
+		}
+		if err == nil {
+			err = os.Chown(target, uid, gid)
+		}
+		if err != nil {
+			log.Debugln("Failed to set mode or owner:", err)
+			log.Debugln("RenderTemplate LEAVE")
+			return nil, err
+		}
+		log.Debugln("RenderTemplate updated mode or owner")
+		log.Debugln("RenderTemplate LEAVE")
+		return result, nil
+	}
+
+	if exists && opts.Backup {
+		result.Backup, err = backupFile(dst, current)
+		if err != nil {
+			log.Debugln("backupFile Failed:", err)
+			log.Debugln("RenderTemplate LEAVE")
+			return nil, err
+		}
+	}
+
+	err = writeFileAtomic(dst, bytes.NewReader(rendered), opts.Mode, uid, gid)
+	if err != nil {
+		log.Debugln("writeFileAtomic Failed:", err)
+		log.Debugln("RenderTemplate LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("RenderTemplate changed")
+	log.Debugln("RenderTemplate LEAVE")
+	return result, nil
+}
+
+//RenderTemplateFile is RenderTemplate with the template read from src
+func (fs *Fs) RenderTemplateFile(src string, dst string, data interface{}, opts *RenderOptions) (*EditResult, error) {
+	log.Debugln("RenderTemplateFile ENTER")
+	log.Debugln("src:", src)
+
+	text, err := ioutil.ReadFile(src)
+	if err != nil {
+		log.Debugln("ReadFile Failed:", err)
+		log.Debugln("RenderTemplateFile LEAVE")
+		return nil, err
+	}
+
+	result, err := fs.RenderTemplate(string(text), dst, data, opts)
+	if err != nil {
+		log.Debugln("RenderTemplate Failed:", err)
+		log.Debugln("RenderTemplateFile LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("RenderTemplateFile LEAVE")
+	return result, nil
+}
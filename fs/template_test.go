@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+const testNginxTemplate = `server {
+    listen {{.Data.Port}};
+    server_name {{.Host.Hostname}};
+    root {{.Data.Root | upper}};
+}
+`
+
+func TestRenderTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	dst := filepath.Join(dir, "site.conf")
+	opts := &RenderOptions{
+		Mode:  0640,
+		Funcs: template.FuncMap{"upper": strings.ToUpper},
+		Facts: &HostFacts{Hostname: "web01.example.com"},
+	}
+	data := map[string]interface{}{"Port": 8080, "Root": "/srv"}
+
+	result, err := fs.RenderTemplate(testNginxTemplate, dst, data, opts)
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+	content, _ := ioutil.ReadFile(dst)
+	assert.Equal(t, "server {\n    listen 8080;\n    server_name web01.example.com;\n    root /SRV;\n}\n", string(content))
+	info, _ := os.Stat(dst)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	result, err = fs.RenderTemplate(testNginxTemplate, dst, data, opts)
+	assert.Equal(t, nil, err)
+	assert.False(t, result.Changed)
+
+	data["Port"] = 9090
+	opts.Backup = true
+	result, err = fs.RenderTemplate(testNginxTemplate, dst, data, opts)
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+	assert.Equal(t, "--- "+dst+"\n+++ "+dst+"\n@@ -1,5 +1,5 @@\n server {\n-    listen 8080;\n+    listen 9090;\n     server_name web01.example.com;\n     root /SRV;\n }\n", result.Diff)
+	backup, _ := ioutil.ReadFile(result.Backup)
+	assert.Equal(t, string(content), string(backup))
+
+	opts.Mode = 0600
+	opts.Backup = false
+	result, err = fs.RenderTemplate(testNginxTemplate, dst, data, opts)
+	assert.Equal(t, nil, err)
+	assert.True(t, result.Changed)
+	assert.Equal(t, "", result.Diff)
+	info, _ = os.Stat(dst)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	_, err = fs.RenderTemplate("{{.Data.Missing}}", dst, data, opts)
+	assert.NotEqual(t, nil, err)
+	content, _ = ioutil.ReadFile(dst)
+	assert.True(t, strings.Contains(string(content), "listen 9090;"))
+
+	_, err = fs.RenderTemplate(testNginxTemplate, dst, data, &RenderOptions{Owner: "no-such-user-xyz"})
+	assert.Equal(t, ErrUnknownOwner, err)
+}
+
+func TestGetHostFacts(t *testing.T) {
+	facts, err := fs.GetHostFacts()
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, "", facts.Hostname)
+	assert.True(t, facts.CPUs > 0)
+}
@@ -0,0 +1,325 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//WatchOp is a bit mask of the kinds of changes a Watcher reports
+type WatchOp uint32
+
+const (
+	//WatchCreate a file or directory appeared, including by a rename into place
+	WatchCreate WatchOp = 1 << iota
+
+	//WatchWrite the contents of a file changed
+	WatchWrite
+
+	//WatchRemove a file or directory was deleted
+	WatchRemove
+
+	//WatchRename a file or directory was renamed away
+	WatchRename
+
+	//WatchChmod the mode, owner or times changed
+	WatchChmod
+
+	//WatchAll is every kind of change
+	WatchAll = WatchCreate | WatchWrite | WatchRemove | WatchRename | WatchChmod
+
+	watchEventBuffer = 64
+)
+
+var (
+	//ErrWatcherClosed the watcher was closed
+	ErrWatcherClosed = errors.New("Watcher is closed")
+
+	//ErrNotWatched the path was not added to the watcher
+	ErrNotWatched = errors.New("Path is not watched")
+
+	//ErrWatchOverflow the kernel dropped events because they were not read fast enough
+	ErrWatchOverflow = errors.New("Watch event queue overflowed")
+
+	watchOpNames = []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD"}
+)
+
+//String returns the names of the ops in the mask joined by |
+func (op WatchOp) String() string {
+	names := []string{}
+	for i, name := range watchOpNames {
+		if op&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+//WatchEvent is a change to Path
+type WatchEvent struct {
+	Path string
+	Op   WatchOp
+}
+
+//WatchOptions controls what a Watcher reports.
+//
+//Recursive also watches every directory below a watched directory,
+//including ones created later. Ops limits the kinds of changes reported (0
+//is WatchAll). Include and Exclude are globs matched against the full path
+//and the base name. With Debounce, changes to the same path are held until
+//it has been quiet for that long and then reported once with the ops
+//combined.
+type WatchOptions struct {
+	Recursive bool
+	Ops       WatchOp
+	Include   []string
+	Exclude   []string
+	Debounce  time.Duration
+}
+
+//watchDir is a directory watched by the kernel. A whole directory reports
+//all of its entries, otherwise only the names added as single files.
+type watchDir struct {
+	wd        int
+	path      string
+	whole     bool
+	recursive bool
+	names     map[string]bool
+}
+
+//Watcher delivers file system changes on a channel until it is closed
+type Watcher struct {
+	mutex  sync.Mutex
+	opts   WatchOptions
+	fd     int
+	file   *os.File
+	wds    map[int]*watchDir
+	dirs   map[string]*watchDir
+	raw    chan *WatchEvent
+	events chan *WatchEvent
+	errors chan error
+	done   chan struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+//Watch starts watching the paths. A directory reports changes to its
+//entries. A file, which may not exist yet, is watched through its parent
+//directory so it is still seen after being replaced by a rename.
+func (fs *Fs) Watch(paths []string, opts *WatchOptions) (*Watcher, error) {
+	log.Debugln("Watch ENTER")
+	log.Debugln("paths:", paths)
+
+	w := &Watcher{
+		wds:    make(map[int]*watchDir),
+		dirs:   make(map[string]*watchDir),
+		raw:    make(chan *WatchEvent, watchEventBuffer),
+		events: make(chan *WatchEvent, watchEventBuffer),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.Ops == 0 {
+		w.opts.Ops = WatchAll
+	}
+
+	err := w.start()
+	if err != nil {
+		log.Debugln("start Failed:", err)
+		log.Debugln("Watch LEAVE")
+		return nil, err
+	}
+	for _, path := range paths {
+		if err = w.Add(path); err != nil {
+			w.Close()
+			log.Debugln("Add Failed:", err)
+			log.Debugln("Watch LEAVE")
+			return nil, err
+		}
+	}
+
+	w.wg.Add(2)
+	go w.readEvents()
+	go w.dispatch()
+
+	log.Debugln("Watch succeeded")
+	log.Debugln("Watch LEAVE")
+	return w, nil
+}
+
+//Events returns the channel changes are delivered on. It is closed by Close.
+func (w *Watcher) Events() <-chan *WatchEvent {
+	return w.events
+}
+
+//Errors returns the channel errors such as ErrWatchOverflow are delivered
+//on. It is closed by Close.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+//Add starts watching another path
+func (w *Watcher) Add(path string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWatcherClosed
+	}
+	return w.add(path)
+}
+
+//Remove stops watching a path added before
+func (w *Watcher) Remove(path string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWatcherClosed
+	}
+	return w.remove(path)
+}
+
+//Close stops watching and closes the Events and Errors channels once
+//everything pending has been dropped. Closing more than once is harmless.
+func (w *Watcher) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	err := w.stop()
+	w.mutex.Unlock()
+
+	w.wg.Wait()
+	close(w.events)
+	close(w.errors)
+	return err
+}
+
+//wanted applies the op and glob filters
+func (w *Watcher) wanted(ev *WatchEvent) bool {
+	if ev.Op&w.opts.Ops == 0 {
+		return false
+	}
+	if len(w.opts.Include) > 0 && !matchesAny(w.opts.Include, ev.Path) {
+		return false
+	}
+	return !matchesAny(w.opts.Exclude, ev.Path)
+}
+
+//queue hands an event from the reader to the dispatcher
+func (w *Watcher) queue(ev *WatchEvent) bool {
+	ev.Op &= w.opts.Ops
+	if !w.wanted(ev) {
+		return true
+	}
+	select {
+	case w.raw <- ev:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+//sendError reports an error without blocking the reader on a slow consumer
+func (w *Watcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+		log.Warnln("Dropping watch error:", err)
+	}
+}
+
+func (w *Watcher) send(ev *WatchEvent) bool {
+	select {
+	case w.events <- ev:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+//dispatch delivers events, holding them back for the debounce interval
+func (w *Watcher) dispatch() {
+	defer w.wg.Done()
+
+	if w.opts.Debounce <= 0 {
+		for {
+			select {
+			case ev, ok := <-w.raw:
+				if !ok || !w.send(ev) {
+					return
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}
+
+	pending := make(map[string]*WatchEvent)
+	order := []string{}
+	due := make(map[string]time.Time)
+	timer := time.NewTimer(w.opts.Debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case ev, ok := <-w.raw:
+			if !ok {
+				return
+			}
+			if p, found := pending[ev.Path]; found {
+				p.Op |= ev.Op
+			} else {
+				pending[ev.Path] = ev
+				order = append(order, ev.Path)
+			}
+			due[ev.Path] = time.Now().Add(w.opts.Debounce)
+
+		case <-timer.C:
+			now := time.Now()
+			remaining := order[:0]
+			for _, path := range order {
+				if due[path].After(now) {
+					remaining = append(remaining, path)
+					continue
+				}
+				ev := pending[path]
+				delete(pending, path)
+				delete(due, path)
+				if !w.send(ev) {
+					return
+				}
+			}
+			order = remaining
+
+		case <-w.done:
+			return
+		}
+
+		if len(order) > 0 {
+			next := due[order[0]]
+			for _, path := range order[1:] {
+				if due[path].Before(next) {
+					next = due[path]
+				}
+			}
+			timer.Stop()
+			select {
+			case <-timer.C:
+			default:
+			}
+			timer.Reset(time.Until(next))
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	inotifyMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MODIFY |
+		syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVED_FROM |
+		syscall.IN_MOVE_SELF | syscall.IN_ATTRIB | syscall.IN_ONLYDIR
+
+	//room for a batch of events with the longest names
+	inotifyBufferSize = 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)
+)
+
+func (w *Watcher) start() error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	//a non-blocking descriptor goes through the runtime poller so closing
+	//the file wakes up a pending Read. The descriptor is kept since Fd()
+	//would switch it back to blocking.
+	w.fd = fd
+	w.file = os.NewFile(uintptr(fd), "inotify")
+	return nil
+}
+
+func (w *Watcher) stop() error {
+	return w.file.Close()
+}
+
+//watchDir adds a kernel watch for the directory or upgrades an existing one
+func (w *Watcher) watchDir(path string, whole bool, recursive bool) (*watchDir, error) {
+	wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+	if err != nil {
+		return nil, &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+
+	d := w.wds[wd]
+	if d == nil {
+		d = &watchDir{
+			wd:    wd,
+			path:  path,
+			names: make(map[string]bool),
+		}
+		w.wds[wd] = d
+	} else if d.path != path {
+		//the same directory was renamed into a watched tree
+		delete(w.dirs, d.path)
+		d.path = path
+	}
+	w.dirs[path] = d
+	d.whole = d.whole || whole
+	d.recursive = d.recursive || recursive
+	return d, nil
+}
+
+//watchTree watches root and every directory below it and returns the paths
+//found below root
+func (w *Watcher) watchTree(root string) ([]string, error) {
+	found := []string{}
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			//entries can disappear while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			if _, err = w.watchDir(path, true, true); err != nil {
+				return err
+			}
+		}
+		if path != root {
+			found = append(found, path)
+		}
+		return nil
+	})
+	return found, err
+}
+
+func (w *Watcher) rmWatch(d *watchDir) {
+	syscall.InotifyRmWatch(w.fd, uint32(d.wd))
+	delete(w.wds, d.wd)
+	if w.dirs[d.path] == d {
+		delete(w.dirs, d.path)
+	}
+}
+
+//rmWatchTree drops the watches of root and the recursive ones below it
+func (w *Watcher) rmWatchTree(root string) {
+	prefix := root + string(os.PathSeparator)
+	for path, d := range w.dirs {
+		if path == root || (d.recursive && strings.HasPrefix(path, prefix)) {
+			w.rmWatch(d)
+		}
+	}
+}
+
+func (w *Watcher) add(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err == nil && fi.IsDir() {
+		if w.opts.Recursive {
+			_, err = w.watchTree(path)
+			return err
+		}
+		_, err = w.watchDir(path, true, false)
+		return err
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	d, err := w.watchDir(filepath.Dir(path), false, false)
+	if err != nil {
+		return err
+	}
+	d.names[filepath.Base(path)] = true
+	return nil
+}
+
+func (w *Watcher) remove(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if d := w.dirs[path]; d != nil && d.whole {
+		w.rmWatchTree(path)
+		return nil
+	}
+	d := w.dirs[filepath.Dir(path)]
+	if d == nil || !d.names[filepath.Base(path)] {
+		return ErrNotWatched
+	}
+	delete(d.names, filepath.Base(path))
+	if !d.whole && len(d.names) == 0 {
+		w.rmWatch(d)
+	}
+	return nil
+}
+
+func inotifyOp(mask uint32) WatchOp {
+	var op WatchOp
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		op |= WatchCreate
+	}
+	if mask&syscall.IN_MODIFY != 0 {
+		op |= WatchWrite
+	}
+	if mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0 {
+		op |= WatchRemove
+	}
+	if mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0 {
+		op |= WatchRename
+	}
+	if mask&syscall.IN_ATTRIB != 0 {
+		op |= WatchChmod
+	}
+	return op
+}
+
+//handle turns one inotify event into watch events. Returns false once the
+//watcher is closed.
+func (w *Watcher) handle(wd int, mask uint32, name string) bool {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.sendError(ErrWatchOverflow)
+		return true
+	}
+
+	w.mutex.Lock()
+	d := w.wds[wd]
+	if d == nil {
+		w.mutex.Unlock()
+		return true
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.wds, wd)
+		if w.dirs[d.path] == d {
+			delete(w.dirs, d.path)
+		}
+		w.mutex.Unlock()
+		return true
+	}
+
+	path := d.path
+	if len(name) > 0 {
+		path = filepath.Join(d.path, name)
+		if !d.whole && !d.names[name] {
+			w.mutex.Unlock()
+			return true
+		}
+	} else if !d.whole {
+		w.mutex.Unlock()
+		return true
+	} else if parent := w.dirs[filepath.Dir(d.path)]; parent != nil && parent.whole && parent != d {
+		//the parent already reports this directory as one of its entries
+		w.mutex.Unlock()
+		return true
+	}
+
+	op := inotifyOp(mask)
+	created := []string{}
+	if d.recursive && mask&syscall.IN_ISDIR != 0 && len(name) > 0 {
+		if op&WatchCreate != 0 {
+			//entries made before the watch was in place are reported too
+			found, err := w.watchTree(path)
+			if err != nil {
+				w.sendError(err)
+			}
+			created = found
+		} else if op&WatchRename != 0 {
+			w.rmWatchTree(path)
+		}
+	}
+	w.mutex.Unlock()
+
+	if !w.queue(&WatchEvent{Path: path, Op: op}) {
+		return false
+	}
+	for _, p := range created {
+		if !w.queue(&WatchEvent{Path: p, Op: WatchCreate}) {
+			return false
+		}
+	}
+	return true
+}
+
+//readEvents reads from the inotify descriptor until the watcher is closed
+func (w *Watcher) readEvents() {
+	defer w.wg.Done()
+	defer close(w.raw)
+
+	buf := make([]byte, inotifyBufferSize)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			default:
+				w.sendError(err)
+			}
+			return
+		}
+
+		offset := 0
+		for offset+syscall.SizeofInotifyEvent <= n {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			end := start + int(raw.Len)
+			if end > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:end]), "\x00")
+			offset = end
+			if !w.handle(int(raw.Wd), raw.Mask, name) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+// +build !linux
+
+package fs
+
+import (
+	common "github.com/dvonthenen/goxplatform/common"
+)
+
+func (w *Watcher) start() error {
+	return common.ErrNotImplemented
+}
+
+func (w *Watcher) stop() error {
+	return nil
+}
+
+func (w *Watcher) add(path string) error {
+	return common.ErrNotImplemented
+}
+
+func (w *Watcher) remove(path string) error {
+	return common.ErrNotImplemented
+}
+
+func (w *Watcher) readEvents() {
+	defer w.wg.Done()
+	close(w.raw)
+}
@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+//nextWatchEvent waits for the next event or returns nil after a timeout
+func nextWatchEvent(w *Watcher, timeout time.Duration) *WatchEvent {
+	select {
+	case ev := <-w.Events():
+		return ev
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "os-release")
+	w, err := fs.Watch([]string{path}, &WatchOptions{Ops: WatchCreate | WatchWrite})
+	assert.Equal(t, nil, err)
+	defer w.Close()
+
+	ioutil.WriteFile(filepath.Join(dir, "other"), []byte("x"), 0644)
+	assert.Equal(t, nil, fs.WriteFileAtomic(path, []byte("ID=test\n"), 0644))
+
+	ev := nextWatchEvent(w, 2*time.Second)
+	if assert.NotNil(t, ev) {
+		assert.Equal(t, path, ev.Path)
+		assert.Equal(t, WatchCreate, ev.Op)
+	}
+	assert.Nil(t, nextWatchEvent(w, 100*time.Millisecond))
+
+	assert.Equal(t, nil, w.Remove(path))
+	assert.Equal(t, ErrNotWatched, w.Remove(path))
+}
+
+func TestWatchRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	w, err := fs.Watch([]string{dir}, &WatchOptions{
+		Recursive: true,
+		Include:   []string{"*.conf"},
+		Debounce:  50 * time.Millisecond,
+	})
+	assert.Equal(t, nil, err)
+
+	os.MkdirAll(filepath.Join(dir, "conf.d", "extra"), 0755)
+	path := filepath.Join(dir, "conf.d", "extra", "app.conf")
+	file, _ := os.Create(path)
+	for i := 0; i < 5; i++ {
+		file.WriteString("line\n")
+		file.Sync()
+	}
+	file.Close()
+	ioutil.WriteFile(filepath.Join(dir, "conf.d", "notes.txt"), []byte("x"), 0644)
+
+	ev := nextWatchEvent(w, 2*time.Second)
+	if assert.NotNil(t, ev) {
+		assert.Equal(t, path, ev.Path)
+		assert.Equal(t, WatchCreate, ev.Op&WatchCreate)
+	}
+	assert.Nil(t, nextWatchEvent(w, 200*time.Millisecond))
+
+	os.Remove(path)
+	ev = nextWatchEvent(w, 2*time.Second)
+	if assert.NotNil(t, ev) {
+		assert.Equal(t, WatchRemove, ev.Op)
+		assert.Equal(t, "REMOVE", ev.Op.String())
+	}
+
+	assert.Equal(t, nil, w.Close())
+	assert.Equal(t, nil, w.Close())
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+	assert.Equal(t, ErrWatcherClosed, w.Add(dir))
+}
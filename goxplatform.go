@@ -9,6 +9,7 @@ import (
 	inst "github.com/dvonthenen/goxplatform/inst"
 	nw "github.com/dvonthenen/goxplatform/nw"
 	run "github.com/dvonthenen/goxplatform/run"
+	storage "github.com/dvonthenen/goxplatform/storage"
 	str "github.com/dvonthenen/goxplatform/str"
 	sys "github.com/dvonthenen/goxplatform/sys"
 	sinit "github.com/dvonthenen/goxplatform/init"
@@ -31,6 +32,8 @@ type XPlatform struct {
 	Run  *run.Run
 	Inst *inst.Inst
 	Init *sinit.Init
+
+	Storage *storage.Storage
 }
 
 func new() *XPlatform {
@@ -41,6 +44,7 @@ func new() *XPlatform {
 	myRun := run.NewRun()
 	myInst := inst.NewInst()
 	myInit := sinit.NewInit()
+	myStorage := storage.NewStorage()
 
 	myXPlatform := &XPlatform{
 		Sys:  mySys,
@@ -50,6 +54,8 @@ func new() *XPlatform {
 		Run:  myRun,
 		Inst: myInst,
 		Init: myInit,
+
+		Storage: myStorage,
 	}
 
 	return myXPlatform
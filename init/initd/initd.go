@@ -173,7 +173,7 @@ func (id *InitD) Disable(serviceName string) error {
 	log.Debugln("serviceName:", serviceName)
 
 	fullPath := "/etc/init/" + serviceName + ".override"
-	err := os.Remove(fullPath)
+	err := id.fs.RemoveFile(fullPath)
 	if err != nil {
 		log.Debugln("Disable Failed:", err)
 		log.Debugln("InitD::Disable LEAVE")
@@ -201,7 +201,9 @@ func doesDependencyExist(serviceName string, depName string) (bool, error) {
 	}
 	defer file.Close()
 
-	r, err := regexp.Compile("Required-Start:.*" + depName)
+	//the same whitespace bounded match RemoveDependentService edits so a
+	//name like $network is literal and scini does not match scini-helper
+	r, err := regexp.Compile("Required-Start:.*\\s" + regexp.QuoteMeta(depName) + "(\\s.*)?$")
 	if err != nil {
 		log.Debugln("regexp is invalid")
 		log.Debugln("doesDependencyExist LEAVE")
@@ -230,97 +232,19 @@ func doesDependencyExist(serviceName string, depName string) (bool, error) {
 	return false, nil
 }
 
-func makeTmpFileWithNewDep(serviceName string, depName string) error {
-	log.Debugln("makeTmpFileWithNewDep ENTER")
+//AddDependentService to the service
+func (id *InitD) AddDependentService(serviceName string, depName string) error {
+	log.Debugln("InitD::AddDependentService ENTER")
 	log.Debugln("serviceName:", serviceName)
 	log.Debugln("depName:", depName)
 
-	fileName := "/etc/init.d/" + serviceName
-	log.Debugln("fileName:", fileName)
-
-	fileNameTmp := "/tmp/" + serviceName + ".tmp"
-	log.Debugln("fileNameTmp:", fileNameTmp)
-
-	sfi, err := os.Stat(fileName)
-	if err != nil {
-		log.Debugln("Src Stat Failed:", err)
-		log.Debugln("makeTmpFileWithNewDep LEAVE")
-		return ErrSrcNotExist
-	}
-	if !sfi.Mode().IsRegular() {
-		//cannot copy non-regular files (e.g., directories, symlinks, devices, etc.)
-		log.Debugln("Src file is not regular")
-		log.Debugln("makeTmpFileWithNewDep LEAVE")
-		return ErrSrcNotRegularFile
-	}
-	dfi, err := os.Stat(fileNameTmp)
-	if err == nil {
-		if !(dfi.Mode().IsRegular()) {
-			log.Debugln("Dst file is not regular")
-			log.Debugln("makeTmpFileWithNewDep LEAVE")
-			return ErrDstNotRegularFile
-		}
-	}
-
-	//Copy the file
-	in, err := os.OpenFile(fileName, os.O_RDONLY, 0666)
-	if err != nil {
-		log.Debugln("Failed to open SRC file:", err)
-		log.Debugln("makeTmpFileWithNewDep LEAVE")
-		return err
-	}
-	defer in.Close()
-	out, err := os.OpenFile(fileNameTmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
-	if err != nil {
-		log.Debugln("Failed to open DST file:", err)
-		log.Debugln("makeTmpFileWithNewDep LEAVE")
-		return err
-	}
-	defer out.Close()
-
-	r, err := regexp.Compile("Required-Start:")
-	if err != nil {
-		log.Debugln("regexp is invalid")
-		log.Debugln("makeTmpFileWithNewDep LEAVE")
-		return err
-	}
-
-	scanner := bufio.NewScanner(in)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		log.Debugln("Line:", line)
-		if len(line) == 0 {
-			continue
-		}
-
-		str := r.FindStringSubmatch(line)
-		if str != nil {
-			log.Debugln("Match found:", line)
-			newLine := line + " scini"
-			out.WriteString(newLine + "\n")
-		} else {
-			out.WriteString(line + "\n")
-		}
-	}
-
-	err = out.Sync()
+	lock, err := id.fs.Lock("init", fs.DefaultLockTimeout)
 	if err != nil {
-		log.Debugln("Failed to flush file:", err)
-		log.Debugln("makeTmpFileWithNewDep LEAVE")
+		log.Debugln("Lock Failed. Err:", err)
+		log.Debugln("InitD::AddDependentService LEAVE")
 		return err
 	}
-
-	log.Debugln("makeTmpFileWithNewDep Succeeded")
-	log.Debugln("makeTmpFileWithNewDep LEAVE")
-
-	return nil
-}
-
-//AddDependentService to the service
-func (id *InitD) AddDependentService(serviceName string, depName string) error {
-	log.Debugln("InitD::AddDependentService ENTER")
-	log.Debugln("serviceName:", serviceName)
-	log.Debugln("depName:", depName)
+	defer lock.Unlock()
 
 	found, err := doesDependencyExist(serviceName, depName)
 	if err != nil {
@@ -334,16 +258,13 @@ func (id *InitD) AddDependentService(serviceName string, depName string) error {
 		return nil
 	}
 
-	err = makeTmpFileWithNewDep(serviceName, depName)
-	if err != nil {
-		log.Debugln("makeTmpFileWithNewDep Failed. Err:", err)
-		log.Debugln("InitD::AddDependentService LEAVE")
-		return err
-	}
-
-	err = id.fs.CopyFile("/tmp/"+serviceName+".tmp", "/etc/init.d/"+serviceName)
+	_, err = id.fs.LineInFile("/etc/init.d/"+serviceName, &fs.LineInFileOptions{
+		Regexp:   "^(.*Required-Start:.*?)\\s*$",
+		Line:     "${1} " + strings.Replace(depName, "$", "$$", -1),
+		Backrefs: true,
+	})
 	if err != nil {
-		log.Debugln("CopyFile Failed. Err:", err)
+		log.Debugln("LineInFile Failed. Err:", err)
 		log.Debugln("InitD::AddDependentService LEAVE")
 		return err
 	}
@@ -353,99 +274,19 @@ func (id *InitD) AddDependentService(serviceName string, depName string) error {
 	return nil
 }
 
-func makeTmpFileWithoutNewDep(serviceName string, depName string) error {
-	log.Debugln("makeTmpFileWithoutNewDep ENTER")
+//RemoveDependentService to the service
+func (id *InitD) RemoveDependentService(serviceName string, depName string) error {
+	log.Debugln("InitD::RemoveDependentService ENTER")
 	log.Debugln("serviceName:", serviceName)
 	log.Debugln("depName:", depName)
 
-	fileName := "/etc/init.d/" + serviceName
-	log.Debugln("fileName:", fileName)
-
-	fileNameTmp := "/tmp/" + serviceName + ".tmp"
-	log.Debugln("fileNameTmp:", fileNameTmp)
-
-	sfi, err := os.Stat(fileName)
-	if err != nil {
-		log.Debugln("Src Stat Failed:", err)
-		log.Debugln("makeTmpFileWithoutNewDep LEAVE")
-		return ErrSrcNotExist
-	}
-	if !sfi.Mode().IsRegular() {
-		//cannot copy non-regular files (e.g., directories, symlinks, devices, etc.)
-		log.Debugln("Src file is not regular")
-		log.Debugln("makeTmpFileWithoutNewDep LEAVE")
-		return ErrSrcNotRegularFile
-	}
-	dfi, err := os.Stat(fileNameTmp)
-	if err == nil {
-		if !(dfi.Mode().IsRegular()) {
-			log.Debugln("Dst file is not regular")
-			log.Debugln("makeTmpFileWithoutNewDep LEAVE")
-			return ErrDstNotRegularFile
-		}
-	}
-
-	//Copy the file
-	in, err := os.OpenFile(fileName, os.O_RDONLY, 0666)
-	if err != nil {
-		log.Debugln("Failed to open SRC file:", err)
-		log.Debugln("makeTmpFileWithoutNewDep LEAVE")
-		return err
-	}
-	defer in.Close()
-	out, err := os.OpenFile(fileNameTmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
-	if err != nil {
-		log.Debugln("Failed to open DST file:", err)
-		log.Debugln("makeTmpFileWithoutNewDep LEAVE")
-		return err
-	}
-	defer out.Close()
-
-	r, err := regexp.Compile("Required-Start:")
-	if err != nil {
-		log.Debugln("regexp is invalid")
-		log.Debugln("makeTmpFileWithoutNewDep LEAVE")
-		return err
-	}
-
-	scanner := bufio.NewScanner(in)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		log.Debugln("Line:", line)
-		if len(line) == 0 {
-			continue
-		}
-
-		str := r.FindStringSubmatch(line)
-		if str != nil {
-			log.Debugln("Match found:", line)
-			newLine := strings.Replace(line, " scini", "", -1)
-			newLine = strings.Replace(newLine, "scini ", "", -1)
-			newLine = strings.Replace(newLine, "scini", "", -1)
-			out.WriteString(newLine + "\n")
-		} else {
-			out.WriteString(line + "\n")
-		}
-	}
-
-	err = out.Sync()
+	lock, err := id.fs.Lock("init", fs.DefaultLockTimeout)
 	if err != nil {
-		log.Debugln("Failed to flush file:", err)
-		log.Debugln("makeTmpFileWithoutNewDep LEAVE")
+		log.Debugln("Lock Failed. Err:", err)
+		log.Debugln("InitD::RemoveDependentService LEAVE")
 		return err
 	}
-
-	log.Debugln("makeTmpFileWithoutNewDep Succeeded")
-	log.Debugln("makeTmpFileWithoutNewDep LEAVE")
-
-	return nil
-}
-
-//RemoveDependentService to the service
-func (id *InitD) RemoveDependentService(serviceName string, depName string) error {
-	log.Debugln("InitD::RemoveDependentService ENTER")
-	log.Debugln("serviceName:", serviceName)
-	log.Debugln("depName:", depName)
+	defer lock.Unlock()
 
 	found, err := doesDependencyExist(serviceName, depName)
 	if err != nil {
@@ -459,16 +300,13 @@ func (id *InitD) RemoveDependentService(serviceName string, depName string) erro
 		return nil
 	}
 
-	err = makeTmpFileWithoutNewDep(serviceName, depName)
-	if err != nil {
-		log.Debugln("makeTmpFileWithoutNewDep Failed. Err:", err)
-		log.Debugln("InitD::RemoveDependentService LEAVE")
-		return err
-	}
-
-	err = id.fs.CopyFile("/tmp/"+serviceName+".tmp", "/etc/init.d/"+serviceName)
+	_, err = id.fs.LineInFile("/etc/init.d/"+serviceName, &fs.LineInFileOptions{
+		Regexp:   "^(.*Required-Start:.*?)\\s+" + regexp.QuoteMeta(depName) + "(\\s.*)?$",
+		Line:     "${1}${2}",
+		Backrefs: true,
+	})
 	if err != nil {
-		log.Debugln("CopyFile Failed. Err:", err)
+		log.Debugln("LineInFile Failed. Err:", err)
 		log.Debugln("InitD::RemoveDependentService LEAVE")
 		return err
 	}
@@ -1,12 +1,14 @@
 package systemd
 
 import (
+	"bytes"
 	"errors"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	ini "github.com/go-ini/ini"
 
+	fs "github.com/dvonthenen/goxplatform/fs"
 	run "github.com/dvonthenen/goxplatform/run"
 )
 
@@ -18,13 +20,16 @@ var (
 //SystemD implementation for SystemD
 type SystemD struct {
 	run *run.Run
+	fs  *fs.Fs
 }
 
 //NewSystemD generates a SystemD object
 func NewSystemD() *SystemD {
 	myRun := run.NewRun()
+	myFs := fs.NewFs()
 	mySystemD := &SystemD{
 		run: myRun,
+		fs:  myFs,
 	}
 	return mySystemD
 }
@@ -223,11 +228,31 @@ func doesAfterExist(run *run.Run, serviceName string) bool {
 	return false
 }
 
+//saveUnit atomically replaces the unit file so a crash never leaves a
+//truncated unit behind. ini's SaveTo removes the file before renaming and
+//loses its mode.
+func (sd *SystemD) saveUnit(cfg *ini.File, iniFile string) error {
+	var buffer bytes.Buffer
+	_, err := cfg.WriteTo(&buffer)
+	if err != nil {
+		return err
+	}
+	return sd.fs.WriteFileAtomic(iniFile, buffer.Bytes(), 0644)
+}
+
 //AddDependentService to the service
 func (sd *SystemD) AddDependentService(serviceName string, depName string) error {
 	log.Debugln("SystemD::AddDependentService ENTER")
 	log.Debugln("serviceName:", serviceName)
 
+	lock, err := sd.fs.Lock("init", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed. Err:", err)
+		log.Debugln("SystemD::AddDependentService LEAVE")
+		return err
+	}
+	defer lock.Unlock()
+
 	iniFile := "/etc/systemd/system/" + serviceName + ".service"
 	cfg, err := ini.Load(iniFile)
 	if err != nil {
@@ -246,9 +271,9 @@ func (sd *SystemD) AddDependentService(serviceName string, depName string) error
 			return err
 		}
 
-		err = cfg.SaveTo(iniFile)
+		err = sd.saveUnit(cfg, iniFile)
 		if err != nil {
-			log.Errorln("Failed to SaveTo File. Err:", err)
+			log.Errorln("Failed to save unit file. Err:", err)
 			log.Debugln("SystemD::AddDependentService LEAVE")
 			return err
 		}
@@ -268,9 +293,9 @@ func (sd *SystemD) AddDependentService(serviceName string, depName string) error
 	newValue := serviceName + " " + value
 	key.SetValue(newValue)
 
-	err = cfg.SaveTo(iniFile)
+	err = sd.saveUnit(cfg, iniFile)
 	if err != nil {
-		log.Errorln("Failed to SaveTo File. Err:", err)
+		log.Errorln("Failed to save unit file. Err:", err)
 		log.Debugln("SystemD::AddDependentService LEAVE")
 		return err
 	}
@@ -285,6 +310,14 @@ func (sd *SystemD) RemoveDependentService(serviceName string, depName string) er
 	log.Debugln("SystemD::RemoveDependentService ENTER")
 	log.Debugln("serviceName:", serviceName)
 
+	lock, err := sd.fs.Lock("init", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed. Err:", err)
+		log.Debugln("SystemD::RemoveDependentService LEAVE")
+		return err
+	}
+	defer lock.Unlock()
+
 	iniFile := "/etc/systemd/system/" + serviceName + ".service"
 	cfg, err := ini.Load(iniFile)
 	if err != nil {
@@ -312,9 +345,9 @@ func (sd *SystemD) RemoveDependentService(serviceName string, depName string) er
 	newValue = strings.Replace(newValue, serviceName, "", -1)
 	key.SetValue(newValue)
 
-	err = cfg.SaveTo(iniFile)
+	err = sd.saveUnit(cfg, iniFile)
 	if err != nil {
-		log.Errorln("Failed to SaveTo File. Err:", err)
+		log.Errorln("Failed to save unit file. Err:", err)
 		log.Debugln("SystemD::RemoveDependentService LEAVE")
 		return err
 	}
@@ -77,6 +77,14 @@ func (inst *Inst) DownloadPackage(installPackageURI string) (string, error) {
 	log.Infoln("downloadPackage ENTER")
 	log.Infoln("installPackageURI=", installPackageURI)
 
+	lock, err := inst.fs.Lock("inst", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Errorln("Lock Failed:", err)
+		log.Infoln("downloadPackage LEAVE")
+		return "", err
+	}
+	defer lock.Unlock()
+
 	path, err := inst.fs.GetFullPath()
 	if err != nil {
 		log.Errorln("GetFullPath Failed:", err)
@@ -90,6 +98,13 @@ func (inst *Inst) DownloadPackage(installPackageURI string) (string, error) {
 	fullpath := inst.fs.AppendSlash(path) + filename
 	log.Infoln("Fullpath:", fullpath)
 
+	err = inst.fs.JournalSnapshot(fullpath)
+	if err != nil {
+		log.Errorln("JournalSnapshot Failed:", err)
+		log.Infoln("downloadPackage LEAVE")
+		return "", err
+	}
+
 	//create a downloaded file
 	output, err := os.Create(fullpath)
 	if err != nil {
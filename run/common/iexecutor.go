@@ -0,0 +1,11 @@
+package common
+
+//IExecutor is the interface for running commands so callers can substitute
+//canned output in tests
+type IExecutor interface {
+	ExecExistsInPath(exe string) bool
+	Command(cmdLine string, successRegex string, failureRegex string) error
+	CommandEx(cmdLine string, successRegex string, failureRegex string, waitInSec int) error
+	CommandOutput(cmdLine string) (string, error)
+	CommandOutputStatus(cmdLine string) (string, int, error)
+}
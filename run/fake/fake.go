@@ -0,0 +1,178 @@
+package fake
+
+import (
+	"bufio"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+)
+
+var (
+	//ErrNoResponse no canned response matches the command line
+	ErrNoResponse = errors.New("No canned response for the command line")
+
+	//ErrExitStatus the canned response has a non-zero exit status
+	ErrExitStatus = errors.New("Command exited with a non-zero status")
+)
+
+var _ common.IExecutor = (*Executor)(nil)
+
+//Response is the canned result for a command line
+type Response struct {
+	Output     string
+	ExitStatus int
+	Err        error
+}
+
+type cannedResponse struct {
+	regex    *regexp.Regexp
+	response Response
+}
+
+//Executor implements the run IExecutor interface with canned responses
+type Executor struct {
+	mutex     sync.Mutex
+	responses []cannedResponse
+	paths     map[string]bool
+
+	//Execs records every command line that was run
+	Execs []string
+}
+
+//NewExecutor generates a fake Executor object
+func NewExecutor() *Executor {
+	myExecutor := &Executor{
+		paths: make(map[string]bool),
+	}
+	return myExecutor
+}
+
+//On registers the output and exit status returned for command lines matching
+//regex. Later registrations take precedence.
+func (e *Executor) On(regex string, output string, exitStatus int) *Executor {
+	return e.OnResponse(regex, Response{Output: output, ExitStatus: exitStatus})
+}
+
+//OnResponse registers the response returned for command lines matching regex
+func (e *Executor) OnResponse(regex string, response Response) *Executor {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.responses = append(e.responses, cannedResponse{
+		regex:    regexp.MustCompile(regex),
+		response: response,
+	})
+	return e
+}
+
+//SetInPath sets whether ExecExistsInPath reports exe as present
+func (e *Executor) SetInPath(exe string, present bool) *Executor {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.paths[exe] = present
+	return e
+}
+
+//Ran returns true if a command line matching regex was run
+func (e *Executor) Ran(regex string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	r := regexp.MustCompile(regex)
+	for _, cmdLine := range e.Execs {
+		if r.MatchString(cmdLine) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Executor) lookup(cmdLine string) Response {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	log.Debugln("Fake exec:", cmdLine)
+	e.Execs = append(e.Execs, cmdLine)
+
+	for i := len(e.responses) - 1; i >= 0; i-- {
+		if e.responses[i].regex.MatchString(cmdLine) {
+			return e.responses[i].response
+		}
+	}
+
+	log.Warnln("No canned response for:", cmdLine)
+	return Response{ExitStatus: -1, Err: ErrNoResponse}
+}
+
+//ExecExistsInPath returns true if exe was marked present with SetInPath
+func (e *Executor) ExecExistsInPath(exe string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return e.paths[exe]
+}
+
+//Command matches the canned output against the success and failure regex
+func (e *Executor) Command(cmdLine string, successRegex string, failureRegex string) error {
+	response := e.lookup(cmdLine)
+	if response.Err != nil {
+		return response.Err
+	}
+	if response.ExitStatus != 0 {
+		return ErrExitStatus
+	}
+
+	succeeded := false
+	scanner := bufio.NewScanner(strings.NewReader(response.Output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(failureRegex) > 0 {
+			if matched, _ := regexp.MatchString(failureRegex, line); matched {
+				return run.ErrExecuteFailed
+			}
+		}
+		if len(successRegex) > 0 {
+			if matched, _ := regexp.MatchString(successRegex, line); matched {
+				succeeded = true
+			}
+		}
+	}
+
+	if !succeeded {
+		return run.ErrExecuteFailed
+	}
+	return nil
+}
+
+//CommandEx matches the canned output against the success and failure regex
+func (e *Executor) CommandEx(cmdLine string, successRegex string, failureRegex string, waitInSec int) error {
+	return e.Command(cmdLine, successRegex, failureRegex)
+}
+
+//CommandOutput returns the canned output
+func (e *Executor) CommandOutput(cmdLine string) (string, error) {
+	response := e.lookup(cmdLine)
+	if response.Err != nil {
+		return "", response.Err
+	}
+	if response.ExitStatus != 0 {
+		return "", ErrExitStatus
+	}
+	return strings.TrimSpace(response.Output), nil
+}
+
+//CommandOutputStatus returns the canned output and exit status
+func (e *Executor) CommandOutputStatus(cmdLine string) (string, int, error) {
+	response := e.lookup(cmdLine)
+	if response.Err != nil {
+		return "", -1, response.Err
+	}
+	return strings.TrimSpace(response.Output), response.ExitStatus, nil
+}
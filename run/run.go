@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -340,3 +341,44 @@ func (run *Run) CommandOutput(cmdLine string) (string, error) {
 	log.Debugln("CommandOutput LEAVE")
 	return output, err
 }
+
+//CommandOutputStatus executes a command once and returns the output and the exit
+//status. A non-zero exit status is not treated as an error so callers can
+//interpret tool specific exit codes.
+func (run *Run) CommandOutputStatus(cmdLine string) (string, int, error) {
+	log.Debugln("CommandOutputStatus ENTER")
+	log.Debugln("Cmdline:", cmdLine)
+
+	cmd := exec.Command("bash", "-c", cmdLine)
+	if cmd == nil {
+		log.Errorln("Error creating cmd")
+		log.Debugln("CommandOutputStatus LEAVE")
+		return "", -1, ErrCommandCreateFailed
+	}
+
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			log.Errorln("Error running cmd:", err)
+			log.Debugln("CommandOutputStatus LEAVE")
+			return "", -1, err
+		}
+		status, ok := exitErr.Sys().(syscall.WaitStatus)
+		if !ok {
+			log.Errorln("Unable to get exit status:", err)
+			log.Debugln("CommandOutputStatus LEAVE")
+			return output, -1, err
+		}
+		log.Debugln(output)
+		log.Debugln("CommandOutputStatus Exit:", status.ExitStatus())
+		log.Debugln("CommandOutputStatus LEAVE")
+		return output, status.ExitStatus(), nil
+	}
+
+	log.Debugln(output)
+	log.Debugln("CommandOutputStatus Exit: 0")
+	log.Debugln("CommandOutputStatus LEAVE")
+	return output, 0, nil
+}
@@ -0,0 +1,404 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+)
+
+const (
+	//ByID is /dev/disk/by-id
+	ByID = "by-id"
+
+	//ByPath is /dev/disk/by-path
+	ByPath = "by-path"
+
+	//ByUUID is /dev/disk/by-uuid
+	ByUUID = "by-uuid"
+
+	//ByLabel is /dev/disk/by-label
+	ByLabel = "by-label"
+
+	defaultDevDir       = "/dev"
+	defaultPollInterval = 250 * time.Millisecond
+)
+
+var (
+	//ErrDeviceNotFound no device matches
+	ErrDeviceNotFound = errors.New("Device not found")
+
+	//ErrInvalidMatch the match does not contain any attribute
+	ErrInvalidMatch = errors.New("Device match is empty")
+
+	//ErrAmbiguousMatch the attributes of the match belong to different devices
+	ErrAmbiguousMatch = errors.New("Device match resolves to different devices")
+
+	//ErrWaitTimeout the device did not appear or disappear in time
+	ErrWaitTimeout = errors.New("Timed out waiting for the device")
+)
+
+//Match selects a device by any of its stable attributes. Every attribute that
+//is set must match.
+type Match struct {
+	Serial string
+	WWN    string
+	ID     string
+	Path   string
+	UUID   string
+	Label  string
+}
+
+//Links are the stable names udev created for a device
+type Links struct {
+	Device  string
+	ByID    []string
+	ByPath  []string
+	ByUUID  []string
+	ByLabel []string
+}
+
+//Device resolves stable device names
+type Device struct {
+	run          common.IExecutor
+	devDir       string
+	pollInterval time.Duration
+}
+
+//NewDevice generates a Device object
+func NewDevice() *Device {
+	return NewDeviceWithExecutor(run.NewRun())
+}
+
+//NewDeviceWithExecutor generates a Device object that runs udevadm through
+//the given executor
+func NewDeviceWithExecutor(executor common.IExecutor) *Device {
+	myDevice := &Device{
+		run:          executor,
+		devDir:       defaultDevDir,
+		pollInterval: defaultPollInterval,
+	}
+	return myDevice
+}
+
+func (dev *Device) diskDir(kind string) string {
+	return filepath.Join(dev.devDir, "disk", kind)
+}
+
+//escapeUdevName encodes a label the way udev names its by-label link. Only
+//0-9A-Za-z#+-.:=@_ and multi-byte UTF-8 characters are kept, every other
+//byte becomes \xNN, so a space is \x20 and a slash \x2f.
+func escapeUdevName(name string) string {
+	out := ""
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if size > 1 && r != utf8.RuneError {
+			out += name[i : i+size]
+			i += size
+			continue
+		}
+		c := name[i]
+		if isUdevSafe(c) {
+			out += string(c)
+		} else {
+			out += fmt.Sprintf("\\x%02x", c)
+		}
+		i++
+	}
+	return out
+}
+
+func isUdevSafe(c byte) bool {
+	switch {
+	case c >= '0' && c <= '9', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		return true
+	}
+	return strings.IndexByte("#+-.:=@_", c) != -1
+}
+
+func isPartitionLink(name string) bool {
+	idx := strings.LastIndex(name, "-part")
+	if idx == -1 {
+		return false
+	}
+	_, err := strconv.Atoi(name[idx+5:])
+	return err == nil
+}
+
+//Canonical returns the kernel device node for any device path or link
+func (dev *Device) Canonical(path string) (string, error) {
+	log.Debugln("Device::Canonical ENTER")
+	log.Debugln("path:", path)
+
+	node, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		log.Debugln("Device does not exist")
+		log.Debugln("Device::Canonical LEAVE")
+		return "", ErrDeviceNotFound
+	}
+	if err != nil {
+		log.Debugln("EvalSymlinks Failed:", err)
+		log.Debugln("Device::Canonical LEAVE")
+		return "", err
+	}
+
+	log.Debugln("Canonical =", node)
+	log.Debugln("Device::Canonical LEAVE")
+	return node, nil
+}
+
+//ResolveLink returns the kernel device node for a name in one of the
+//dev/disk/by-* directories
+func (dev *Device) ResolveLink(kind string, name string) (string, error) {
+	if len(name) == 0 || strings.Contains(name, "/") {
+		return "", ErrDeviceNotFound
+	}
+	return dev.Canonical(filepath.Join(dev.diskDir(kind), name))
+}
+
+func (dev *Device) findByIDSuffix(suffixes []string) (string, error) {
+	entries, err := ioutil.ReadDir(dev.diskDir(ByID))
+	if err != nil {
+		log.Debugln("ReadDir Failed:", err)
+		return "", ErrDeviceNotFound
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if isPartitionLink(name) {
+			continue
+		}
+		for _, suffix := range suffixes {
+			if name == suffix || strings.HasSuffix(name, "_"+suffix) || strings.HasSuffix(name, "-"+suffix) {
+				return dev.Canonical(filepath.Join(dev.diskDir(ByID), name))
+			}
+		}
+	}
+
+	return "", ErrDeviceNotFound
+}
+
+//ResolveBySerial returns the device node for the disk serial number
+func (dev *Device) ResolveBySerial(serial string) (string, error) {
+	log.Debugln("Device::ResolveBySerial serial:", serial)
+	if len(serial) == 0 {
+		return "", ErrInvalidMatch
+	}
+	return dev.findByIDSuffix([]string{serial})
+}
+
+//ResolveByWWN returns the device node for the World Wide Name
+func (dev *Device) ResolveByWWN(wwn string) (string, error) {
+	log.Debugln("Device::ResolveByWWN wwn:", wwn)
+	wwn = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(wwn, "wwn-"), "0x"))
+	if len(wwn) == 0 {
+		return "", ErrInvalidMatch
+	}
+	return dev.ResolveLink(ByID, "wwn-0x"+wwn)
+}
+
+//ResolveByID returns the device node for the /dev/disk/by-id name
+func (dev *Device) ResolveByID(id string) (string, error) {
+	return dev.ResolveLink(ByID, filepath.Base(id))
+}
+
+//ResolveByPath returns the device node for the /dev/disk/by-path name
+func (dev *Device) ResolveByPath(path string) (string, error) {
+	return dev.ResolveLink(ByPath, filepath.Base(path))
+}
+
+//ResolveByUUID returns the device node for the filesystem UUID
+func (dev *Device) ResolveByUUID(uuid string) (string, error) {
+	node, err := dev.ResolveLink(ByUUID, uuid)
+	if err == ErrDeviceNotFound {
+		//vfat and ntfs UUIDs are upper case
+		node, err = dev.ResolveLink(ByUUID, strings.ToUpper(uuid))
+	}
+	return node, err
+}
+
+//ResolveByLabel returns the device node for the filesystem label
+func (dev *Device) ResolveByLabel(label string) (string, error) {
+	return dev.ResolveLink(ByLabel, escapeUdevName(label))
+}
+
+//Resolve returns the device node that satisfies every attribute in match.
+//Returns ErrAmbiguousMatch if the attributes point to different devices.
+func (dev *Device) Resolve(match *Match) (string, error) {
+	log.Debugln("Device::Resolve ENTER")
+
+	if match == nil {
+		log.Debugln("No match")
+		log.Debugln("Device::Resolve LEAVE")
+		return "", ErrInvalidMatch
+	}
+
+	type resolver struct {
+		value   string
+		resolve func(string) (string, error)
+	}
+	resolvers := []resolver{
+		{match.Serial, dev.ResolveBySerial},
+		{match.WWN, dev.ResolveByWWN},
+		{match.ID, dev.ResolveByID},
+		{match.Path, dev.ResolveByPath},
+		{match.UUID, dev.ResolveByUUID},
+		{match.Label, dev.ResolveByLabel},
+	}
+
+	node := ""
+	for _, r := range resolvers {
+		if len(r.value) == 0 {
+			continue
+		}
+		found, err := r.resolve(r.value)
+		if err != nil {
+			log.Debugln("Resolve Failed for", r.value, "Err:", err)
+			log.Debugln("Device::Resolve LEAVE")
+			return "", err
+		}
+		if len(node) > 0 && node != found {
+			log.Debugln("Attributes resolve to different devices:", node, found)
+			log.Debugln("Device::Resolve LEAVE")
+			return "", ErrAmbiguousMatch
+		}
+		node = found
+	}
+
+	if len(node) == 0 {
+		log.Debugln("Empty match")
+		log.Debugln("Device::Resolve LEAVE")
+		return "", ErrInvalidMatch
+	}
+
+	log.Debugln("Resolve =", node)
+	log.Debugln("Device::Resolve LEAVE")
+	return node, nil
+}
+
+//GetLinks returns every /dev/disk/by-* name that points to the device
+func (dev *Device) GetLinks(device string) (*Links, error) {
+	log.Debugln("Device::GetLinks ENTER")
+	log.Debugln("device:", device)
+
+	node, err := dev.Canonical(device)
+	if err != nil {
+		log.Debugln("Canonical Failed:", err)
+		log.Debugln("Device::GetLinks LEAVE")
+		return nil, err
+	}
+
+	links := &Links{
+		Device: node,
+	}
+	kinds := map[string]*[]string{
+		ByID:    &links.ByID,
+		ByPath:  &links.ByPath,
+		ByUUID:  &links.ByUUID,
+		ByLabel: &links.ByLabel,
+	}
+	for kind, list := range kinds {
+		entries, errDir := ioutil.ReadDir(dev.diskDir(kind))
+		if errDir != nil {
+			continue
+		}
+		for _, entry := range entries {
+			link := filepath.Join(dev.diskDir(kind), entry.Name())
+			target, errEval := filepath.EvalSymlinks(link)
+			if errEval != nil || target != node {
+				continue
+			}
+			*list = append(*list, link)
+		}
+		sort.Strings(*list)
+	}
+
+	log.Debugln("Device::GetLinks LEAVE")
+	return links, nil
+}
+
+//Settle waits for the udev event queue to be empty
+func (dev *Device) Settle(timeout time.Duration) {
+	if !dev.run.ExecExistsInPath("udevadm") {
+		log.Debugln("udevadm not found")
+		return
+	}
+
+	seconds := int(timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	cmdLine := "udevadm settle --timeout=" + strconv.Itoa(seconds)
+	_, status, err := dev.run.CommandOutputStatus(cmdLine)
+	if err != nil || status != 0 {
+		log.Debugln("udevadm settle did not complete. Status:", status, "Err:", err)
+	}
+}
+
+func (dev *Device) wait(match *Match, timeout time.Duration, present bool) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		dev.Settle(deadline.Sub(time.Now()))
+
+		node, err := dev.Resolve(match)
+		if err == ErrInvalidMatch || err == ErrAmbiguousMatch {
+			return "", err
+		}
+		if present && err == nil {
+			return node, nil
+		}
+		if !present && err == ErrDeviceNotFound {
+			return "", nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", ErrWaitTimeout
+		}
+		time.Sleep(dev.pollInterval)
+	}
+}
+
+//WaitForDevice waits for a device matching every attribute to appear and
+//returns its device node
+func (dev *Device) WaitForDevice(match *Match, timeout time.Duration) (string, error) {
+	log.Debugln("Device::WaitForDevice ENTER")
+	log.Debugln("timeout:", timeout)
+
+	node, err := dev.wait(match, timeout, true)
+	if err != nil {
+		log.Debugln("WaitForDevice Failed:", err)
+		log.Debugln("Device::WaitForDevice LEAVE")
+		return "", err
+	}
+
+	log.Debugln("WaitForDevice =", node)
+	log.Debugln("Device::WaitForDevice LEAVE")
+	return node, nil
+}
+
+//WaitForDeviceGone waits for the device matching every attribute to disappear
+func (dev *Device) WaitForDeviceGone(match *Match, timeout time.Duration) error {
+	log.Debugln("Device::WaitForDeviceGone ENTER")
+	log.Debugln("timeout:", timeout)
+
+	_, err := dev.wait(match, timeout, false)
+	if err != nil {
+		log.Debugln("WaitForDeviceGone Failed:", err)
+		log.Debugln("Device::WaitForDeviceGone LEAVE")
+		return err
+	}
+
+	log.Debugln("Device::WaitForDeviceGone LEAVE")
+	return nil
+}
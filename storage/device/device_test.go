@@ -0,0 +1,150 @@
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+func newTestDevice(t *testing.T) (*Device, *fake.Executor, string) {
+	dir, err := ioutil.TempDir("", "dev")
+	assert.Equal(t, nil, err)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	for _, node := range []string{"sdb", "sdb1", "sdc"} {
+		ioutil.WriteFile(filepath.Join(dir, node), nil, 0644)
+	}
+	links := map[string]string{
+		"by-id/scsi-0QEMU_QEMU_HARDDISK_drive-scsi1":       "sdb",
+		"by-id/scsi-0QEMU_QEMU_HARDDISK_drive-scsi1-part1": "sdb1",
+		"by-id/wwn-0x5000c500a1b2c3d4":                     "sdb",
+		"by-id/nvme-Amazon_Elastic_Block_Store_vol0abc123": "sdc",
+		"by-path/pci-0000:00:05.0-scsi-0:0:1:0":            "sdb",
+		"by-uuid/0b1f3c2e-8a4d-4c7e-9f21-3e5d6a7b8c9d":     "sdb1",
+		"by-label/my\\x20data":                             "sdb1",
+	}
+	for link, node := range links {
+		path := filepath.Join(dir, "disk", link)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.Symlink(filepath.Join("..", "..", node), path)
+	}
+
+	executor := fake.NewExecutor()
+	device := NewDeviceWithExecutor(executor)
+	device.devDir = dir
+	device.pollInterval = 10 * time.Millisecond
+	return device, executor, dir
+}
+
+func TestResolve(t *testing.T) {
+	device, _, dir := newTestDevice(t)
+	defer os.RemoveAll(dir)
+
+	sdb := filepath.Join(dir, "sdb")
+	sdb1 := filepath.Join(dir, "sdb1")
+
+	node, err := device.ResolveBySerial("drive-scsi1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sdb, node)
+
+	node, err = device.ResolveBySerial("vol0abc123")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(dir, "sdc"), node)
+
+	node, err = device.ResolveByWWN("0x5000C500A1B2C3D4")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sdb, node)
+
+	node, err = device.ResolveByPath("/dev/disk/by-path/pci-0000:00:05.0-scsi-0:0:1:0")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sdb, node)
+
+	node, err = device.ResolveByUUID("0b1f3c2e-8a4d-4c7e-9f21-3e5d6a7b8c9d")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sdb1, node)
+
+	node, err = device.ResolveByLabel("my data")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sdb1, node)
+
+	node, err = device.Resolve(&Match{Serial: "drive-scsi1", WWN: "5000c500a1b2c3d4"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sdb, node)
+
+	_, err = device.Resolve(&Match{Serial: "drive-scsi1", UUID: "0b1f3c2e-8a4d-4c7e-9f21-3e5d6a7b8c9d"})
+	assert.Equal(t, ErrAmbiguousMatch, err)
+
+	_, err = device.Resolve(&Match{})
+	assert.Equal(t, ErrInvalidMatch, err)
+	_, err = device.Resolve(nil)
+	assert.Equal(t, ErrInvalidMatch, err)
+
+	_, err = device.ResolveBySerial("missing")
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func TestEscapeUdevName(t *testing.T) {
+	assert.Equal(t, "my\\x20data", escapeUdevName("my data"))
+	assert.Equal(t, "a\\x2fb\\x5cc", escapeUdevName("a/b\\c"))
+	assert.Equal(t, "\\x24HOME\\x27s\\x2a\\x3bx", escapeUdevName("$HOME's*;x"))
+	assert.Equal(t, "EFI-SYS_1.0#+:=@", escapeUdevName("EFI-SYS_1.0#+:=@"))
+	assert.Equal(t, "donn\u00e9es", escapeUdevName("donn\u00e9es"))
+	assert.Equal(t, "\\xff", escapeUdevName("\xff"))
+}
+
+func TestGetLinks(t *testing.T) {
+	device, _, dir := newTestDevice(t)
+	defer os.RemoveAll(dir)
+
+	links, err := device.GetLinks(filepath.Join(dir, "disk", "by-id", "wwn-0x5000c500a1b2c3d4"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(dir, "sdb"), links.Device)
+	assert.Equal(t, 2, len(links.ByID))
+	assert.Equal(t, 1, len(links.ByPath))
+	assert.Equal(t, 0, len(links.ByUUID))
+}
+
+func TestWaitForDevice(t *testing.T) {
+	device, executor, dir := newTestDevice(t)
+	defer os.RemoveAll(dir)
+
+	executor.SetInPath("udevadm", true)
+	executor.On("^udevadm settle", "", 0)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Symlink("../../sdc", filepath.Join(dir, "disk", "by-id", "virtio-late0001"))
+	}()
+
+	node, err := device.WaitForDevice(&Match{Serial: "late0001"}, 2*time.Second)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(dir, "sdc"), node)
+	assert.True(t, executor.Ran("udevadm settle --timeout=[12]"))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(filepath.Join(dir, "disk", "by-id", "virtio-late0001"))
+	}()
+
+	err = device.WaitForDeviceGone(&Match{Serial: "late0001"}, 2*time.Second)
+	assert.Equal(t, nil, err)
+
+	_, err = device.WaitForDevice(&Match{Serial: "never"}, 50*time.Millisecond)
+	assert.Equal(t, ErrWaitTimeout, err)
+
+	err = device.WaitForDeviceGone(&Match{Serial: "drive-scsi1", UUID: "0b1f3c2e-8a4d-4c7e-9f21-3e5d6a7b8c9d"}, 2*time.Second)
+	assert.Equal(t, ErrAmbiguousMatch, err)
+}
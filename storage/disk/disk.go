@@ -0,0 +1,220 @@
+package disk
+
+import (
+	"errors"
+	"io"
+	"os"
+	"regexp"
+
+	log "github.com/Sirupsen/logrus"
+
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+)
+
+var (
+	//ErrNoTable the disk does not contain a partition table
+	ErrNoTable = errors.New("No partition table found")
+
+	//ErrInvalidTable the partition table is corrupt or inconsistent
+	ErrInvalidTable = errors.New("Invalid partition table")
+
+	//ErrInvalidTableType the partition table type is not gpt or mbr
+	ErrInvalidTableType = errors.New("Invalid partition table type")
+
+	//ErrInvalidType the partition type is not valid for the table type
+	ErrInvalidType = errors.New("Invalid partition type")
+
+	//ErrInvalidName the partition name is too long or the table does not support names
+	ErrInvalidName = errors.New("Invalid partition name")
+
+	//ErrPartitionNotFound the partition number does not exist
+	ErrPartitionNotFound = errors.New("Partition not found")
+
+	//ErrTooManyPartitions the table has no free partition slot
+	ErrTooManyPartitions = errors.New("No free partition slot")
+
+	//ErrNoSpace the partition does not fit in the free space
+	ErrNoSpace = errors.New("Not enough free space for the partition")
+
+	//ErrOverlap the partition overlaps another partition
+	ErrOverlap = errors.New("Partition overlaps an existing partition")
+
+	//ErrSectorSizeMismatch the table sector size differs from the disk
+	ErrSectorSizeMismatch = errors.New("Partition table sector size does not match the disk")
+
+	//ErrNotBlockDevice the path is not a block device
+	ErrNotBlockDevice = errors.New("Path is not a block device")
+
+	pathRegex = regexp.MustCompile("^/[a-zA-Z0-9/_.:+@,=\\-]*$")
+)
+
+//Disk reads and writes partition tables on block devices and image files
+type Disk struct {
+	run common.IExecutor
+}
+
+//NewDisk generates a Disk object
+func NewDisk() *Disk {
+	return NewDiskWithExecutor(run.NewRun())
+}
+
+//NewDiskWithExecutor generates a Disk object that runs partx through the
+//given executor
+func NewDiskWithExecutor(executor common.IExecutor) *Disk {
+	myDisk := &Disk{
+		run: executor,
+	}
+	return myDisk
+}
+
+//diskGeometry returns the size in bytes and the logical sector size
+func diskGeometry(file *os.File) (uint64, uint64, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(size), sectorSize(file), nil
+}
+
+//ReadTable reads the partition table from a block device or image file
+func (d *Disk) ReadTable(path string) (*Table, error) {
+	log.Debugln("Disk::ReadTable ENTER")
+	log.Debugln("path:", path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Debugln("Open Failed:", err)
+		log.Debugln("Disk::ReadTable LEAVE")
+		return nil, err
+	}
+	defer file.Close()
+
+	size, sector, err := diskGeometry(file)
+	if err != nil {
+		log.Debugln("diskGeometry Failed:", err)
+		log.Debugln("Disk::ReadTable LEAVE")
+		return nil, err
+	}
+
+	table, err := readTable(file, size, sector)
+	if err != nil {
+		log.Debugln("readTable Failed:", err)
+		log.Debugln("Disk::ReadTable LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("Type:", table.Type, "Partitions:", len(table.Partitions))
+	log.Debugln("Disk::ReadTable LEAVE")
+	return table, nil
+}
+
+//WriteTable writes the partition table to a block device or image file. For
+//GPT the backup header is placed at the current end of the disk so a table
+//read from a disk that has since grown is relocated. The kernel is asked to
+//reread the table when path is a block device.
+func (d *Disk) WriteTable(path string, table *Table) error {
+	log.Debugln("Disk::WriteTable ENTER")
+	log.Debugln("path:", path)
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		log.Debugln("OpenFile Failed:", err)
+		log.Debugln("Disk::WriteTable LEAVE")
+		return err
+	}
+
+	size, sector, err := diskGeometry(file)
+	if err != nil {
+		file.Close()
+		log.Debugln("diskGeometry Failed:", err)
+		log.Debugln("Disk::WriteTable LEAVE")
+		return err
+	}
+	if table.SectorSize != sector {
+		file.Close()
+		log.Debugln("Sector size mismatch. Table:", table.SectorSize, "Disk:", sector)
+		log.Debugln("Disk::WriteTable LEAVE")
+		return ErrSectorSizeMismatch
+	}
+	table.SizeBytes = size
+
+	err = table.validate()
+	if err == nil {
+		err = writeTable(file, table)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		log.Debugln("writeTable Failed:", err)
+		log.Debugln("Disk::WriteTable LEAVE")
+		return err
+	}
+
+	if isBlockDevice(path) {
+		err = d.ReloadPartitions(path)
+		if err != nil {
+			log.Debugln("ReloadPartitions Failed:", err)
+			log.Debugln("Disk::WriteTable LEAVE")
+			return err
+		}
+	}
+
+	log.Debugln("Disk::WriteTable LEAVE")
+	return nil
+}
+
+//ReloadPartitions asks the kernel to reread the partition table. When the
+//disk is in use the individual partitions are updated with partx instead.
+//Returns ErrNotBlockDevice unless path is a block device.
+func (d *Disk) ReloadPartitions(path string) error {
+	log.Debugln("Disk::ReloadPartitions ENTER")
+	log.Debugln("path:", path)
+
+	if !pathRegex.MatchString(path) || !isBlockDevice(path) {
+		log.Debugln("Not a block device")
+		log.Debugln("Disk::ReloadPartitions LEAVE")
+		return ErrNotBlockDevice
+	}
+
+	err := rereadPartitions(path)
+	if err == nil {
+		log.Debugln("Disk::ReloadPartitions LEAVE")
+		return nil
+	}
+	log.Debugln("rereadPartitions Failed:", err)
+
+	if !d.run.ExecExistsInPath("partx") {
+		log.Debugln("partx not found")
+		log.Debugln("Disk::ReloadPartitions LEAVE")
+		return err
+	}
+
+	output, status, errPartx := d.run.CommandOutputStatus("partx -u '" + path + "'")
+	if errPartx == nil && status != 0 {
+		log.Errorln("partx failed:", output)
+		errPartx = err
+	}
+	if errPartx != nil {
+		log.Debugln("partx Failed:", errPartx)
+		log.Debugln("Disk::ReloadPartitions LEAVE")
+		return errPartx
+	}
+
+	log.Debugln("Disk::ReloadPartitions LEAVE")
+	return nil
+}
+
+func isBlockDevice(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0
+}
@@ -0,0 +1,41 @@
+package disk
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	blkRRPart = 0x125F
+	blkSSZGet = 0x1268
+)
+
+func ioctl(fd uintptr, request uintptr, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+//sectorSize returns the logical sector size of a block device or
+//DefaultSectorSize for image files
+func sectorSize(file *os.File) uint64 {
+	var size int32
+	err := ioctl(file.Fd(), blkSSZGet, uintptr(unsafe.Pointer(&size)))
+	if err != nil || size <= 0 {
+		return DefaultSectorSize
+	}
+	return uint64(size)
+}
+
+func rereadPartitions(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ioctl(file.Fd(), blkRRPart, 0)
+}
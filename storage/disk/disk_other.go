@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package disk
+
+import (
+	"os"
+
+	common "github.com/dvonthenen/goxplatform/common"
+)
+
+func sectorSize(file *os.File) uint64 {
+	return DefaultSectorSize
+}
+
+func rereadPartitions(path string) error {
+	return common.ErrNotImplemented
+}
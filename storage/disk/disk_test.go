@@ -0,0 +1,217 @@
+package disk
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+)
+
+const (
+	mib = 1024 * 1024
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+func newTestImage(t *testing.T, size int64) (string, string) {
+	dir, err := ioutil.TempDir("", "disk")
+	assert.Equal(t, nil, err)
+
+	image := filepath.Join(dir, "disk.img")
+	file, err := os.Create(image)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, file.Truncate(size))
+	file.Close()
+	return dir, image
+}
+
+func TestGPTRoundTrip(t *testing.T) {
+	dir, image := newTestImage(t, 64*mib)
+	defer os.RemoveAll(dir)
+
+	d := NewDiskWithExecutor(fake.NewExecutor())
+
+	_, err := d.ReadTable(image)
+	assert.Equal(t, ErrNoTable, err)
+
+	table, err := NewTable(TypeGPT, 64*mib, 0)
+	assert.Equal(t, nil, err)
+
+	esp, err := table.AddPartition(0, 16*mib, "c12a7328-f81f-11d2-ba4b-00a0c93ec93b", "EFI System")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, esp.Number)
+	assert.Equal(t, uint64(2048), esp.StartSector)
+	assert.Equal(t, uint64(34815), esp.EndSector)
+	assert.Equal(t, GUIDEFISystem, esp.Type)
+
+	root, err := table.AddPartition(0, 0, GUIDLinuxFilesystem, "root")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(34816), root.StartSector)
+	assert.Equal(t, uint64(131038), root.EndSector)
+
+	assert.Equal(t, nil, d.WriteTable(image, table))
+
+	read, err := d.ReadTable(image)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, TypeGPT, read.Type)
+	assert.Equal(t, table.DiskGUID, read.DiskGUID)
+	assert.Equal(t, 2, len(read.Partitions))
+	assert.Equal(t, *esp, *read.Partitions[0])
+	assert.Equal(t, *root, *read.Partitions[1])
+	assert.Equal(t, uint64(16*mib), read.Size(read.Partitions[0]))
+}
+
+func TestGPTHeaderLimits(t *testing.T) {
+	table, err := NewTable(TypeGPT, 64*mib, 0)
+	assert.Equal(t, nil, err)
+
+	header := func(numEntries uint32, entrySize uint32) []byte {
+		buf := gptHeaderBytes(table, 1, 0, 2, 0)
+		binary.LittleEndian.PutUint32(buf[80:], numEntries)
+		binary.LittleEndian.PutUint32(buf[84:], entrySize)
+		binary.LittleEndian.PutUint32(buf[16:], 0)
+		binary.LittleEndian.PutUint32(buf[16:], crc32.ChecksumIEEE(buf[:gptHeaderSize]))
+		return buf
+	}
+
+	_, ok := parseGPTHeader(header(128, 128), 1)
+	assert.True(t, ok)
+	_, ok = parseGPTHeader(header(128, 256), 1)
+	assert.True(t, ok)
+	_, ok = parseGPTHeader(header(128, 384), 1)
+	assert.False(t, ok)
+	_, ok = parseGPTHeader(header(128, 1024), 1)
+	assert.False(t, ok)
+	_, ok = parseGPTHeader(header(128, 0xffffff80), 1)
+	assert.False(t, ok)
+}
+
+func TestGPTBackupAndGrow(t *testing.T) {
+	dir, image := newTestImage(t, 64*mib)
+	defer os.RemoveAll(dir)
+
+	d := NewDiskWithExecutor(fake.NewExecutor())
+
+	table, _ := NewTable(TypeGPT, 64*mib, 0)
+	table.AddPartition(0, 0, GUIDLinuxLVM, "data")
+	assert.Equal(t, nil, d.WriteTable(image, table))
+
+	//corrupt the primary header
+	file, _ := os.OpenFile(image, os.O_RDWR, 0)
+	file.WriteAt(make([]byte, 512), 512)
+	file.Close()
+
+	read, err := d.ReadTable(image)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(read.Partitions))
+	assert.Equal(t, "data", read.Partitions[0].Name)
+	assert.Equal(t, nil, d.WriteTable(image, read))
+
+	os.Truncate(image, 128*mib)
+	read, err = d.ReadTable(image)
+	assert.Equal(t, nil, err)
+
+	max, err := read.MaxSize(1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(262110-2048+1)*512, max)
+
+	assert.Equal(t, nil, read.ResizePartition(1, 0))
+	assert.Equal(t, nil, d.WriteTable(image, read))
+
+	grown, err := d.ReadTable(image)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(262110), grown.Partitions[0].EndSector)
+	assert.Equal(t, read.Partitions[0].GUID, grown.Partitions[0].GUID)
+}
+
+func TestMBR(t *testing.T) {
+	dir, image := newTestImage(t, 64*mib)
+	defer os.RemoveAll(dir)
+
+	d := NewDiskWithExecutor(fake.NewExecutor())
+
+	gpt, _ := NewTable(TypeGPT, 64*mib, 0)
+	gpt.AddPartition(0, 0, GUIDLinuxFilesystem, "")
+	assert.Equal(t, nil, d.WriteTable(image, gpt))
+
+	table, err := NewTable(TypeMBR, 64*mib, 0)
+	assert.Equal(t, nil, err)
+
+	_, err = table.AddPartition(0, 8*mib, MBRLinuxSwap, "swap")
+	assert.Equal(t, ErrInvalidName, err)
+	_, err = table.AddPartition(0, 8*mib, GUIDLinuxSwap, "")
+	assert.Equal(t, ErrInvalidType, err)
+
+	boot, err := table.AddPartition(0, 8*mib, "0x83", "")
+	assert.Equal(t, nil, err)
+	boot.Bootable = true
+	_, err = table.AddPartition(0, 0, MBRLinuxLVM, "")
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, nil, d.WriteTable(image, table))
+
+	read, err := d.ReadTable(image)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, TypeMBR, read.Type)
+	assert.Equal(t, table.DiskSignature, read.DiskSignature)
+	assert.Equal(t, 2, len(read.Partitions))
+	assert.Equal(t, MBRLinux, read.Partitions[0].Type)
+	assert.True(t, read.Partitions[0].Bootable)
+	assert.Equal(t, uint64(18432), read.Partitions[1].StartSector)
+	assert.Equal(t, uint64(131071), read.Partitions[1].EndSector)
+	assert.Equal(t, ErrInvalidName, read.SetName(1, "boot"))
+}
+
+func TestTableEdits(t *testing.T) {
+	table, _ := NewTable(TypeMBR, 64*mib, 0)
+
+	_, err := table.AddPartition(2048, 8*mib, MBRLinux, "")
+	assert.Equal(t, nil, err)
+	_, err = table.AddPartition(4096, 8*mib, MBRLinux, "")
+	assert.Equal(t, ErrOverlap, err)
+	_, err = table.AddPartition(0, 128*mib, MBRLinux, "")
+	assert.Equal(t, ErrNoSpace, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = table.AddPartition(0, 8*mib, MBRLinux, "")
+		assert.Equal(t, nil, err)
+	}
+	_, err = table.AddPartition(0, 8*mib, MBRLinux, "")
+	assert.Equal(t, ErrTooManyPartitions, err)
+
+	assert.Equal(t, ErrNoSpace, table.ResizePartition(1, 16*mib))
+	assert.Equal(t, nil, table.DeletePartition(2))
+	assert.Equal(t, nil, table.ResizePartition(1, 16*mib))
+	assert.Equal(t, ErrPartitionNotFound, table.DeletePartition(2))
+
+	p, err := table.AddPartition(0, 0, MBRLinuxRAID, "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, p.Number)
+	assert.Equal(t, nil, table.SetType(2, MBRLinuxLVM))
+	assert.Equal(t, ErrInvalidType, table.SetType(2, "zz"))
+	assert.Equal(t, nil, table.validate())
+}
+
+func TestReloadPartitionsRequiresBlockDevice(t *testing.T) {
+	dir, image := newTestImage(t, mib)
+	defer os.RemoveAll(dir)
+
+	executor := fake.NewExecutor()
+	executor.SetInPath("partx", true)
+	d := NewDiskWithExecutor(executor)
+
+	assert.Equal(t, ErrNotBlockDevice, d.ReloadPartitions(image))
+	assert.Equal(t, ErrNotBlockDevice, d.ReloadPartitions("/dev/sda;reboot"))
+	assert.False(t, executor.Ran("partx"))
+}
@@ -0,0 +1,301 @@
+package disk
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	gptSignature  = "EFI PART"
+	gptRevision   = 0x00010000
+	gptHeaderSize = 92
+	gptEntries    = 128
+	gptEntrySize  = 128
+
+	//largest partition entry array read from disk
+	gptMaxEntriesBytes = 1024 * 1024
+)
+
+type gptHeader struct {
+	myLBA        uint64
+	alternateLBA uint64
+	firstUsable  uint64
+	lastUsable   uint64
+	diskGUID     []byte
+	entriesLBA   uint64
+	numEntries   uint32
+	entrySize    uint32
+	entriesCRC   uint32
+}
+
+//gptEntriesSectors returns the number of sectors of the partition entry array
+func gptEntriesSectors(sectorSize uint64) uint64 {
+	return (gptEntries*gptEntrySize + sectorSize - 1) / sectorSize
+}
+
+//parseGUID converts the text form of a GUID to its mixed endian disk form
+func parseGUID(guid string) ([16]byte, error) {
+	var out [16]byte
+	raw, err := hex.DecodeString(strings.Replace(guid, "-", "", -1))
+	if err != nil || len(raw) != 16 || len(guid) != 36 {
+		return out, ErrInvalidType
+	}
+	out[0], out[1], out[2], out[3] = raw[3], raw[2], raw[1], raw[0]
+	out[4], out[5] = raw[5], raw[4]
+	out[6], out[7] = raw[7], raw[6]
+	copy(out[8:], raw[8:])
+	return out, nil
+}
+
+//formatGUID converts the mixed endian disk form of a GUID to text
+func formatGUID(buf []byte) string {
+	raw := []byte{buf[3], buf[2], buf[1], buf[0], buf[5], buf[4], buf[7], buf[6]}
+	raw = append(raw, buf[8:16]...)
+	s := strings.ToUpper(hex.EncodeToString(raw))
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+//newGUID returns a random version 4 GUID
+func newGUID() string {
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	raw[6] = (raw[6] & 0x0f) | 0x40
+	raw[8] = (raw[8] & 0x3f) | 0x80
+	s := strings.ToUpper(hex.EncodeToString(raw))
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+func decodeName(buf []byte) string {
+	units := make([]uint16, 0, len(buf)/2)
+	for i := 0; i+1 < len(buf); i += 2 {
+		u := binary.LittleEndian.Uint16(buf[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+func encodeName(name string, buf []byte) {
+	for i, u := range utf16.Encode([]rune(name)) {
+		if 2*i+1 >= len(buf) {
+			break
+		}
+		binary.LittleEndian.PutUint16(buf[2*i:], u)
+	}
+}
+
+//parseGPTHeader validates and decodes the header in the sector at lba
+func parseGPTHeader(buf []byte, lba uint64) (*gptHeader, bool) {
+	if string(buf[0:8]) != gptSignature {
+		return nil, false
+	}
+	size := binary.LittleEndian.Uint32(buf[12:])
+	if size < gptHeaderSize || int(size) > len(buf) {
+		return nil, false
+	}
+
+	check := make([]byte, size)
+	copy(check, buf[:size])
+	binary.LittleEndian.PutUint32(check[16:], 0)
+	if crc32.ChecksumIEEE(check) != binary.LittleEndian.Uint32(buf[16:]) {
+		return nil, false
+	}
+
+	header := &gptHeader{
+		myLBA:        binary.LittleEndian.Uint64(buf[24:]),
+		alternateLBA: binary.LittleEndian.Uint64(buf[32:]),
+		firstUsable:  binary.LittleEndian.Uint64(buf[40:]),
+		lastUsable:   binary.LittleEndian.Uint64(buf[48:]),
+		diskGUID:     buf[56:72],
+		entriesLBA:   binary.LittleEndian.Uint64(buf[72:]),
+		numEntries:   binary.LittleEndian.Uint32(buf[80:]),
+		entrySize:    binary.LittleEndian.Uint32(buf[84:]),
+		entriesCRC:   binary.LittleEndian.Uint32(buf[88:]),
+	}
+	if header.myLBA != lba || header.numEntries > 1024 || !validEntrySize(header.entrySize, len(buf)) {
+		return nil, false
+	}
+	if uint64(header.numEntries)*uint64(header.entrySize) > gptMaxEntriesBytes {
+		return nil, false
+	}
+	return header, true
+}
+
+//validEntrySize checks the entry size is 128 times a power of two and fits
+//in a sector as the UEFI spec requires
+func validEntrySize(entrySize uint32, sectorSize int) bool {
+	if entrySize < gptEntrySize || int(entrySize) > sectorSize || entrySize%gptEntrySize != 0 {
+		return false
+	}
+	n := entrySize / gptEntrySize
+	return n&(n-1) == 0
+}
+
+//readGPTAt reads the header at lba and its partition entries
+func readGPTAt(r io.ReaderAt, lba uint64, sectorSize uint64) (*Table, bool) {
+	buf := make([]byte, sectorSize)
+	_, err := r.ReadAt(buf, int64(lba*sectorSize))
+	if err != nil {
+		return nil, false
+	}
+	header, ok := parseGPTHeader(buf, lba)
+	if !ok {
+		return nil, false
+	}
+
+	entries := make([]byte, uint64(header.numEntries)*uint64(header.entrySize))
+	_, err = r.ReadAt(entries, int64(header.entriesLBA*sectorSize))
+	if err != nil || crc32.ChecksumIEEE(entries) != header.entriesCRC {
+		return nil, false
+	}
+
+	table := &Table{
+		Type:       TypeGPT,
+		SectorSize: sectorSize,
+		DiskGUID:   formatGUID(header.diskGUID),
+	}
+	for i := 0; i < int(header.numEntries); i++ {
+		entry := entries[i*int(header.entrySize):]
+		if isZero(entry[0:16]) {
+			continue
+		}
+		table.Partitions = append(table.Partitions, &Partition{
+			Number:      i + 1,
+			Type:        formatGUID(entry[0:16]),
+			GUID:        formatGUID(entry[16:32]),
+			StartSector: binary.LittleEndian.Uint64(entry[32:]),
+			EndSector:   binary.LittleEndian.Uint64(entry[40:]),
+			Attributes:  binary.LittleEndian.Uint64(entry[48:]),
+			Name:        decodeName(entry[56:128]),
+		})
+	}
+	return table, true
+}
+
+//readGPT reads the primary GPT and falls back to the backup at the end of
+//the disk when the primary is corrupt
+func readGPT(r io.ReaderAt, size uint64, sectorSize uint64) (*Table, error) {
+	table, ok := readGPTAt(r, 1, sectorSize)
+	if !ok {
+		log.Warnln("Primary GPT header is invalid. Trying the backup.")
+		table, ok = readGPTAt(r, size/sectorSize-1, sectorSize)
+	}
+	if !ok {
+		return nil, ErrInvalidTable
+	}
+	table.SizeBytes = size
+	return table, nil
+}
+
+func gptHeaderBytes(t *Table, myLBA uint64, alternateLBA uint64, entriesLBA uint64, entriesCRC uint32) []byte {
+	buf := make([]byte, t.SectorSize)
+	copy(buf[0:8], gptSignature)
+	binary.LittleEndian.PutUint32(buf[8:], gptRevision)
+	binary.LittleEndian.PutUint32(buf[12:], gptHeaderSize)
+	binary.LittleEndian.PutUint64(buf[24:], myLBA)
+	binary.LittleEndian.PutUint64(buf[32:], alternateLBA)
+	binary.LittleEndian.PutUint64(buf[40:], t.FirstUsableSector())
+	binary.LittleEndian.PutUint64(buf[48:], t.LastUsableSector())
+	guid, _ := parseGUID(t.DiskGUID)
+	copy(buf[56:72], guid[:])
+	binary.LittleEndian.PutUint64(buf[72:], entriesLBA)
+	binary.LittleEndian.PutUint32(buf[80:], gptEntries)
+	binary.LittleEndian.PutUint32(buf[84:], gptEntrySize)
+	binary.LittleEndian.PutUint32(buf[88:], entriesCRC)
+	binary.LittleEndian.PutUint32(buf[16:], crc32.ChecksumIEEE(buf[:gptHeaderSize]))
+	return buf
+}
+
+//writeGPT writes the protective MBR, the primary GPT and the backup GPT
+func writeGPT(rw readerWriterAt, t *Table) error {
+	if _, err := parseGUID(t.DiskGUID); err != nil {
+		t.DiskGUID = newGUID()
+	}
+
+	entries := make([]byte, gptEntries*gptEntrySize)
+	for _, p := range t.Partitions {
+		entry := entries[(p.Number-1)*gptEntrySize:]
+		partType, _ := parseGUID(p.Type)
+		copy(entry[0:16], partType[:])
+		guid, err := parseGUID(p.GUID)
+		if err != nil {
+			p.GUID = newGUID()
+			guid, _ = parseGUID(p.GUID)
+		}
+		copy(entry[16:32], guid[:])
+		binary.LittleEndian.PutUint64(entry[32:], p.StartSector)
+		binary.LittleEndian.PutUint64(entry[40:], p.EndSector)
+		binary.LittleEndian.PutUint64(entry[48:], p.Attributes)
+		encodeName(p.Name, entry[56:128])
+	}
+	entriesCRC := crc32.ChecksumIEEE(entries)
+
+	lastLBA := t.totalSectors() - 1
+	backupEntriesLBA := lastLBA - gptEntriesSectors(t.SectorSize)
+
+	protective := []*mbrEntry{{
+		partType: mbrProtective,
+		start:    1,
+		sectors:  minUint64(lastLBA, maxUint32),
+	}}
+	if err := writeMBRSector(rw, t.SectorSize, 0, protective); err != nil {
+		return err
+	}
+
+	padded := make([]byte, gptEntriesSectors(t.SectorSize)*t.SectorSize)
+	copy(padded, entries)
+	writes := []struct {
+		lba uint64
+		buf []byte
+	}{
+		{2, padded},
+		{1, gptHeaderBytes(t, 1, lastLBA, 2, entriesCRC)},
+		{backupEntriesLBA, padded},
+		{lastLBA, gptHeaderBytes(t, lastLBA, 1, backupEntriesLBA, entriesCRC)},
+	}
+	for _, w := range writes {
+		_, err := rw.WriteAt(w.buf, int64(w.lba*t.SectorSize))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//wipeGPT clears stale GPT headers so an MBR written over a GPT disk is not
+//mistaken for a corrupt GPT
+func wipeGPT(rw readerWriterAt, t *Table) error {
+	buf := make([]byte, t.SectorSize)
+	zero := make([]byte, t.SectorSize)
+	for _, lba := range []uint64{1, t.totalSectors() - 1} {
+		_, err := rw.ReadAt(buf, int64(lba*t.SectorSize))
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(buf, []byte(gptSignature)) {
+			continue
+		}
+		_, err = rw.WriteAt(zero, int64(lba*t.SectorSize))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func minUint64(a uint64, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,171 @@
+package disk
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	mbrEntries      = 4
+	mbrTableOffset  = 446
+	mbrSigOffset    = 510
+	mbrDiskSigStart = 440
+	mbrBootable     = 0x80
+	mbrProtective   = 0xEE
+)
+
+type readerWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+type mbrEntry struct {
+	bootable bool
+	partType uint8
+	start    uint64
+	sectors  uint64
+}
+
+func newDiskSignature() uint32 {
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return binary.LittleEndian.Uint32(buf)
+}
+
+//chs converts an LBA to the legacy cylinder/head/sector encoding using the
+//255 head, 63 sector geometry. LBAs past cylinder 1023 get the maximum value.
+func chs(lba uint64) []byte {
+	cylinder := lba / (255 * 63)
+	if cylinder > 1023 {
+		return []byte{0xFE, 0xFF, 0xFF}
+	}
+	head := (lba / 63) % 255
+	sector := lba%63 + 1
+	return []byte{byte(head), byte(sector) | byte((cylinder>>2)&0xC0), byte(cylinder)}
+}
+
+func hasMBRSignature(buf []byte) bool {
+	return buf[mbrSigOffset] == 0x55 && buf[mbrSigOffset+1] == 0xAA
+}
+
+func parseMBREntries(buf []byte) []*mbrEntry {
+	entries := make([]*mbrEntry, mbrEntries)
+	for i := 0; i < mbrEntries; i++ {
+		raw := buf[mbrTableOffset+16*i:]
+		entries[i] = &mbrEntry{
+			bootable: raw[0]&mbrBootable != 0,
+			partType: raw[4],
+			start:    uint64(binary.LittleEndian.Uint32(raw[8:])),
+			sectors:  uint64(binary.LittleEndian.Uint32(raw[12:])),
+		}
+	}
+	return entries
+}
+
+//writeMBRSector writes the partition entries and signature to the sector at
+//lba keeping the existing boot code
+func writeMBRSector(rw readerWriterAt, sectorSize uint64, diskSignature uint32, entries []*mbrEntry) error {
+	buf := make([]byte, sectorSize)
+	_, err := rw.ReadAt(buf, 0)
+	if err != nil {
+		return err
+	}
+
+	if diskSignature != 0 {
+		binary.LittleEndian.PutUint32(buf[mbrDiskSigStart:], diskSignature)
+	}
+	for i := 0; i < mbrEntries*16; i++ {
+		buf[mbrTableOffset+i] = 0
+	}
+	for i, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		raw := buf[mbrTableOffset+16*i:]
+		if entry.bootable {
+			raw[0] = mbrBootable
+		}
+		copy(raw[1:4], chs(entry.start))
+		raw[4] = entry.partType
+		copy(raw[5:8], chs(entry.start+entry.sectors-1))
+		binary.LittleEndian.PutUint32(raw[8:], uint32(entry.start))
+		binary.LittleEndian.PutUint32(raw[12:], uint32(entry.sectors))
+	}
+	buf[mbrSigOffset] = 0x55
+	buf[mbrSigOffset+1] = 0xAA
+
+	_, err = rw.WriteAt(buf, 0)
+	return err
+}
+
+//readTable reads the MBR and, when it is a protective MBR, the GPT
+func readTable(r io.ReaderAt, size uint64, sectorSize uint64) (*Table, error) {
+	if size < 2*sectorSize {
+		return nil, ErrNoTable
+	}
+	buf := make([]byte, sectorSize)
+	_, err := r.ReadAt(buf, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !hasMBRSignature(buf) {
+		return nil, ErrNoTable
+	}
+
+	entries := parseMBREntries(buf)
+	for _, entry := range entries {
+		if entry.partType == mbrProtective {
+			return readGPT(r, size, sectorSize)
+		}
+	}
+
+	table := &Table{
+		Type:          TypeMBR,
+		SectorSize:    sectorSize,
+		SizeBytes:     size,
+		DiskSignature: binary.LittleEndian.Uint32(buf[mbrDiskSigStart:]),
+	}
+	for i, entry := range entries {
+		if entry.partType == 0 || entry.sectors == 0 {
+			continue
+		}
+		table.Partitions = append(table.Partitions, &Partition{
+			Number:      i + 1,
+			StartSector: entry.start,
+			EndSector:   entry.start + entry.sectors - 1,
+			Type:        fmt.Sprintf("%02x", entry.partType),
+			Bootable:    entry.bootable,
+		})
+	}
+	return table, nil
+}
+
+//writeTable writes the table in the format of its type
+func writeTable(rw readerWriterAt, t *Table) error {
+	if t.Type == TypeGPT {
+		return writeGPT(rw, t)
+	}
+
+	err := wipeGPT(rw, t)
+	if err != nil {
+		return err
+	}
+	if t.DiskSignature == 0 {
+		t.DiskSignature = newDiskSignature()
+	}
+
+	entries := make([]*mbrEntry, mbrEntries)
+	for _, p := range t.Partitions {
+		var code uint64
+		fmt.Sscanf(p.Type, "%x", &code)
+		entries[p.Number-1] = &mbrEntry{
+			bootable: p.Bootable,
+			partType: uint8(code),
+			start:    p.StartSector,
+			sectors:  p.Sectors(),
+		}
+	}
+	return writeMBRSector(rw, t.SectorSize, t.DiskSignature, entries)
+}
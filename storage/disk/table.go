@@ -0,0 +1,458 @@
+package disk
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	//TypeGPT is a GUID partition table
+	TypeGPT = "gpt"
+
+	//TypeMBR is a DOS master boot record partition table
+	TypeMBR = "mbr"
+
+	//DefaultSectorSize is the logical sector size of image files
+	DefaultSectorSize = 512
+
+	//GUIDLinuxFilesystem is the GPT type of Linux filesystem data
+	GUIDLinuxFilesystem = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+
+	//GUIDLinuxLVM is the GPT type of a Linux LVM physical volume
+	GUIDLinuxLVM = "E6D6D379-F507-44C2-A23C-238F2A3DF928"
+
+	//GUIDLinuxSwap is the GPT type of Linux swap
+	GUIDLinuxSwap = "0657FD6D-A4AB-43C4-84E5-0933C84B4F4F"
+
+	//GUIDLinuxRAID is the GPT type of a Linux RAID member
+	GUIDLinuxRAID = "A19D880F-05FC-4D3B-A006-743F0F84911E"
+
+	//GUIDEFISystem is the GPT type of an EFI system partition
+	GUIDEFISystem = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+
+	//GUIDBIOSBoot is the GPT type of a GRUB BIOS boot partition
+	GUIDBIOSBoot = "21686148-6449-6E6F-744E-656564454649"
+
+	//GUIDMicrosoftBasicData is the GPT type of Windows data partitions
+	GUIDMicrosoftBasicData = "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7"
+
+	//MBRLinux is the MBR type of Linux filesystem data
+	MBRLinux = "83"
+
+	//MBRLinuxLVM is the MBR type of a Linux LVM physical volume
+	MBRLinuxLVM = "8e"
+
+	//MBRLinuxSwap is the MBR type of Linux swap
+	MBRLinuxSwap = "82"
+
+	//MBRLinuxRAID is the MBR type of a Linux RAID member
+	MBRLinuxRAID = "fd"
+
+	//MBREFISystem is the MBR type of an EFI system partition
+	MBREFISystem = "ef"
+
+	alignmentBytes = 1024 * 1024
+	gptMaxNameLen  = 36
+	maxUint32      = 0xFFFFFFFF
+)
+
+//Partition is an entry in a partition table. Sectors are in units of the
+//table sector size and EndSector is inclusive.
+type Partition struct {
+	Number      int
+	StartSector uint64
+	EndSector   uint64
+
+	//Type is a GUID for GPT and a two digit hex code for MBR
+	Type string
+
+	//Name, GUID and Attributes are only used by GPT
+	Name       string
+	GUID       string
+	Attributes uint64
+
+	//Bootable is only used by MBR
+	Bootable bool
+}
+
+//Sectors returns the number of sectors in the partition
+func (p *Partition) Sectors() uint64 {
+	return p.EndSector - p.StartSector + 1
+}
+
+//Table is a GPT or MBR partition table. Logical partitions inside an MBR
+//extended partition are not supported.
+type Table struct {
+	Type       string
+	SectorSize uint64
+	SizeBytes  uint64
+
+	//DiskGUID is only used by GPT
+	DiskGUID string
+
+	//DiskSignature is only used by MBR
+	DiskSignature uint32
+
+	Partitions []*Partition
+}
+
+type byNumber []*Partition
+
+func (a byNumber) Len() int           { return len(a) }
+func (a byNumber) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byNumber) Less(i, j int) bool { return a[i].Number < a[j].Number }
+
+type byStart []*Partition
+
+func (a byStart) Len() int           { return len(a) }
+func (a byStart) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byStart) Less(i, j int) bool { return a[i].StartSector < a[j].StartSector }
+
+//NewTable generates an empty partition table for a disk of sizeBytes. A
+//sectorSize of 0 uses DefaultSectorSize.
+func NewTable(tableType string, sizeBytes uint64, sectorSize uint64) (*Table, error) {
+	if sectorSize == 0 {
+		sectorSize = DefaultSectorSize
+	}
+	if sectorSize%512 != 0 {
+		return nil, ErrInvalidTable
+	}
+
+	table := &Table{
+		Type:       tableType,
+		SectorSize: sectorSize,
+		SizeBytes:  sizeBytes,
+	}
+	switch tableType {
+	case TypeGPT:
+		table.DiskGUID = newGUID()
+	case TypeMBR:
+		table.DiskSignature = newDiskSignature()
+	default:
+		return nil, ErrInvalidTableType
+	}
+
+	if table.FirstUsableSector() > table.LastUsableSector() {
+		return nil, ErrNoSpace
+	}
+	return table, nil
+}
+
+func (t *Table) totalSectors() uint64 {
+	return t.SizeBytes / t.SectorSize
+}
+
+func (t *Table) maxPartitions() int {
+	if t.Type == TypeGPT {
+		return gptEntries
+	}
+	return mbrEntries
+}
+
+//FirstUsableSector returns the first sector a partition can start at
+func (t *Table) FirstUsableSector() uint64 {
+	if t.Type == TypeGPT {
+		return 2 + gptEntriesSectors(t.SectorSize)
+	}
+	return 1
+}
+
+//LastUsableSector returns the last sector a partition can end at
+func (t *Table) LastUsableSector() uint64 {
+	total := t.totalSectors()
+	reserved := uint64(1)
+	if t.Type == TypeGPT {
+		reserved = 2 + gptEntriesSectors(t.SectorSize)
+	}
+	if total < reserved+1 {
+		return 0
+	}
+	return total - reserved
+}
+
+//Offset returns the byte offset of the partition on the disk
+func (t *Table) Offset(p *Partition) uint64 {
+	return p.StartSector * t.SectorSize
+}
+
+//Size returns the size of the partition in bytes
+func (t *Table) Size(p *Partition) uint64 {
+	return p.Sectors() * t.SectorSize
+}
+
+//GetPartition returns the partition with the given number
+func (t *Table) GetPartition(number int) (*Partition, error) {
+	for _, p := range t.Partitions {
+		if p.Number == number {
+			return p, nil
+		}
+	}
+	return nil, ErrPartitionNotFound
+}
+
+func (t *Table) alignUp(sector uint64) uint64 {
+	align := uint64(alignmentBytes) / t.SectorSize
+	return (sector + align - 1) / align * align
+}
+
+func (t *Table) nextNumber() (int, error) {
+	used := make(map[int]bool)
+	for _, p := range t.Partitions {
+		used[p.Number] = true
+	}
+	for i := 1; i <= t.maxPartitions(); i++ {
+		if !used[i] {
+			return i, nil
+		}
+	}
+	return 0, ErrTooManyPartitions
+}
+
+//endOfFree returns the last free sector of the region that contains start,
+//ignoring the partition skip
+func (t *Table) endOfFree(start uint64, skip *Partition) (uint64, error) {
+	end := t.LastUsableSector()
+	if start < t.FirstUsableSector() || start > end {
+		return 0, ErrNoSpace
+	}
+	for _, p := range t.Partitions {
+		if p == skip {
+			continue
+		}
+		if start >= p.StartSector && start <= p.EndSector {
+			return 0, ErrOverlap
+		}
+		if p.StartSector > start && p.StartSector-1 < end {
+			end = p.StartSector - 1
+		}
+	}
+	return end, nil
+}
+
+//firstFreeStart returns the first aligned sector that is not in a partition
+func (t *Table) firstFreeStart() (uint64, error) {
+	sorted := make([]*Partition, len(t.Partitions))
+	copy(sorted, t.Partitions)
+	sort.Sort(byStart(sorted))
+
+	start := t.alignUp(t.FirstUsableSector())
+	for _, p := range sorted {
+		if start < p.StartSector {
+			break
+		}
+		if start <= p.EndSector {
+			start = t.alignUp(p.EndSector + 1)
+		}
+	}
+	if start > t.LastUsableSector() {
+		return 0, ErrNoSpace
+	}
+	return start, nil
+}
+
+func (t *Table) sectorsFor(sizeBytes uint64) uint64 {
+	return (sizeBytes + t.SectorSize - 1) / t.SectorSize
+}
+
+//AddPartition adds a partition. A startSector of 0 uses the first aligned
+//free sector and a sizeBytes of 0 uses all the free space from the start.
+func (t *Table) AddPartition(startSector uint64, sizeBytes uint64, partType string, name string) (*Partition, error) {
+	normalized, err := normalizeType(t.Type, partType)
+	if err != nil {
+		return nil, err
+	}
+	err = t.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+	number, err := t.nextNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	if startSector == 0 {
+		startSector, err = t.firstFreeStart()
+		if err != nil {
+			return nil, err
+		}
+	}
+	end, err := t.endOfFree(startSector, nil)
+	if err != nil {
+		return nil, err
+	}
+	if sizeBytes > 0 {
+		want := startSector + t.sectorsFor(sizeBytes) - 1
+		if want > end {
+			return nil, ErrNoSpace
+		}
+		end = want
+	}
+
+	p := &Partition{
+		Number:      number,
+		StartSector: startSector,
+		EndSector:   end,
+		Type:        normalized,
+	}
+	if t.Type == TypeGPT {
+		p.Name = name
+		p.GUID = newGUID()
+	}
+	t.Partitions = append(t.Partitions, p)
+	sort.Sort(byNumber(t.Partitions))
+	return p, nil
+}
+
+//DeletePartition removes the partition with the given number
+func (t *Table) DeletePartition(number int) error {
+	for i, p := range t.Partitions {
+		if p.Number == number {
+			t.Partitions = append(t.Partitions[:i], t.Partitions[i+1:]...)
+			return nil
+		}
+	}
+	return ErrPartitionNotFound
+}
+
+//MaxSize returns the largest size in bytes the partition can be resized to
+//without moving its start
+func (t *Table) MaxSize(number int) (uint64, error) {
+	p, err := t.GetPartition(number)
+	if err != nil {
+		return 0, err
+	}
+	end, err := t.endOfFree(p.StartSector, p)
+	if err != nil {
+		return 0, err
+	}
+	return (end - p.StartSector + 1) * t.SectorSize, nil
+}
+
+//ResizePartition moves the end of the partition so it is sizeBytes long. A
+//sizeBytes of 0 grows the partition into all the free space that follows it.
+func (t *Table) ResizePartition(number int, sizeBytes uint64) error {
+	p, err := t.GetPartition(number)
+	if err != nil {
+		return err
+	}
+	end, err := t.endOfFree(p.StartSector, p)
+	if err != nil {
+		return err
+	}
+	if sizeBytes > 0 {
+		want := p.StartSector + t.sectorsFor(sizeBytes) - 1
+		if want > end {
+			return ErrNoSpace
+		}
+		end = want
+	}
+	p.EndSector = end
+	return nil
+}
+
+//SetType changes the type of the partition
+func (t *Table) SetType(number int, partType string) error {
+	p, err := t.GetPartition(number)
+	if err != nil {
+		return err
+	}
+	normalized, err := normalizeType(t.Type, partType)
+	if err != nil {
+		return err
+	}
+	p.Type = normalized
+	return nil
+}
+
+//SetName changes the name of a GPT partition
+func (t *Table) SetName(number int, name string) error {
+	p, err := t.GetPartition(number)
+	if err != nil {
+		return err
+	}
+	if t.Type != TypeGPT {
+		return ErrInvalidName
+	}
+	err = t.checkName(name)
+	if err != nil {
+		return err
+	}
+	p.Name = name
+	return nil
+}
+
+func (t *Table) checkName(name string) error {
+	if len(name) == 0 {
+		return nil
+	}
+	if t.Type != TypeGPT || len(utf16.Encode([]rune(name))) > gptMaxNameLen {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+//validate checks every partition is in the usable area and that none overlap
+func (t *Table) validate() error {
+	if t.Type != TypeGPT && t.Type != TypeMBR {
+		return ErrInvalidTableType
+	}
+	if len(t.Partitions) > t.maxPartitions() {
+		return ErrTooManyPartitions
+	}
+
+	sorted := make([]*Partition, len(t.Partitions))
+	copy(sorted, t.Partitions)
+	sort.Sort(byStart(sorted))
+
+	numbers := make(map[int]bool)
+	for i, p := range sorted {
+		if p.Number < 1 || p.Number > t.maxPartitions() || numbers[p.Number] {
+			return ErrInvalidTable
+		}
+		numbers[p.Number] = true
+		if _, err := normalizeType(t.Type, p.Type); err != nil {
+			return err
+		}
+		if p.StartSector < t.FirstUsableSector() || p.EndSector > t.LastUsableSector() || p.EndSector < p.StartSector {
+			return ErrNoSpace
+		}
+		if t.Type == TypeMBR && (p.StartSector > maxUint32 || p.Sectors() > maxUint32) {
+			return ErrNoSpace
+		}
+		if i > 0 && p.StartSector <= sorted[i-1].EndSector {
+			return ErrOverlap
+		}
+	}
+	return nil
+}
+
+//normalizeType returns the canonical form of the partition type for the table
+func normalizeType(tableType string, partType string) (string, error) {
+	switch tableType {
+	case TypeGPT:
+		guid, err := parseGUID(partType)
+		if err != nil || isZero(guid[:]) {
+			return "", ErrInvalidType
+		}
+		return formatGUID(guid[:]), nil
+	case TypeMBR:
+		code, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(partType), "0x"), 16, 8)
+		if err != nil || code == 0 || code == mbrProtective {
+			return "", ErrInvalidType
+		}
+		return fmt.Sprintf("%02x", code), nil
+	}
+	return "", ErrInvalidTableType
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
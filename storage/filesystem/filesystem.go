@@ -0,0 +1,320 @@
+package filesystem
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+	disk "github.com/dvonthenen/goxplatform/storage/disk"
+)
+
+const (
+	defaultSysfsRoot = "/sys"
+	defaultDevDir    = "/dev"
+
+	//partitions are only grown when at least this much space can be gained so
+	//alignment slack at the end of the disk is ignored
+	minPartitionGrowth = 1024 * 1024
+)
+
+var (
+	//ErrUnsupportedFilesystem the filesystem type cannot be grown
+	ErrUnsupportedFilesystem = errors.New("Filesystem type does not support online grow")
+
+	//ErrToolNotFound the resize tool for the filesystem is not installed
+	ErrToolNotFound = errors.New("Filesystem resize tool not found")
+
+	//ErrResizeFailed the resize tool failed
+	ErrResizeFailed = errors.New("Filesystem resize failed")
+
+	//ErrInvalidPath the device or mount point contains characters that are
+	//not allowed on a command line
+	ErrInvalidPath = errors.New("Invalid device or mount point path")
+
+	//ErrDeviceNotInFilesystem the device is not listed as a member of the
+	//btrfs filesystem
+	ErrDeviceNotInFilesystem = errors.New("Device is not part of the btrfs filesystem")
+
+	pathRegex = regexp.MustCompile("^/[a-zA-Z0-9/_.:+@,=\\-]*$")
+
+	btrfsDevidRegex = regexp.MustCompile("^\\s*devid\\s+(\\d+)\\s.*\\spath\\s+(\\S+)\\s*$")
+)
+
+//GrowResult describes what GrowFilesystem did
+type GrowResult struct {
+	Device     string
+	MountPoint string
+	FsType     string
+
+	//Disk and PartitionNumber are set when Device is a partition
+	Disk            string
+	PartitionNumber int
+	PartitionGrown  bool
+
+	OldSizeBytes uint64
+	NewSizeBytes uint64
+}
+
+//Grown returns true if the filesystem is larger than before
+func (gr *GrowResult) Grown() bool {
+	return gr.NewSizeBytes > gr.OldSizeBytes
+}
+
+//Filesystem grows mounted filesystems
+type Filesystem struct {
+	run       common.IExecutor
+	disk      *disk.Disk
+	sysfsRoot string
+	devDir    string
+
+	getMounts  func() ([]*fs.MountInfo, error)
+	getFsStats func(path string) (*fs.FsStats, error)
+}
+
+//NewFilesystem generates a Filesystem object
+func NewFilesystem() *Filesystem {
+	return NewFilesystemWithExecutor(run.NewRun())
+}
+
+//NewFilesystemWithExecutor generates a Filesystem object that runs the resize
+//tools through the given executor
+func NewFilesystemWithExecutor(executor common.IExecutor) *Filesystem {
+	myFs := fs.NewFs()
+	myFilesystem := &Filesystem{
+		run:        executor,
+		disk:       disk.NewDiskWithExecutor(executor),
+		sysfsRoot:  defaultSysfsRoot,
+		devDir:     defaultDevDir,
+		getMounts:  myFs.GetMounts,
+		getFsStats: myFs.GetFsStats,
+	}
+	return myFilesystem
+}
+
+func canonical(path string) string {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return realPath
+}
+
+//findMount returns the mount whose mount point or source device is target
+func (f *Filesystem) findMount(target string) (*fs.MountInfo, error) {
+	mounts, err := f.getMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	target = canonical(target)
+	var found *fs.MountInfo
+	for _, mi := range mounts {
+		if canonical(mi.MountPoint) == target {
+			found = mi
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	for _, mi := range mounts {
+		if strings.HasPrefix(mi.Source, "/") && canonical(mi.Source) == target {
+			return mi, nil
+		}
+	}
+	return nil, fs.ErrNotMounted
+}
+
+//partitionOf returns the parent disk and partition number of device when it
+//is a partition
+func (f *Filesystem) partitionOf(device string) (string, int, bool) {
+	name := filepath.Base(device)
+	blockDir := filepath.Join(f.sysfsRoot, "class", "block", name)
+
+	data, err := ioutil.ReadFile(filepath.Join(blockDir, "partition"))
+	if err != nil {
+		return "", 0, false
+	}
+	number, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", 0, false
+	}
+
+	realDir, err := filepath.EvalSymlinks(blockDir)
+	if err != nil {
+		return "", 0, false
+	}
+	parent := filepath.Base(filepath.Dir(realDir))
+	return filepath.Join(f.devDir, parent), number, true
+}
+
+//growPartition grows the partition into the free space that follows it
+func (f *Filesystem) growPartition(diskPath string, number int) (bool, error) {
+	table, err := f.disk.ReadTable(diskPath)
+	if err != nil {
+		return false, err
+	}
+	p, err := table.GetPartition(number)
+	if err != nil {
+		return false, err
+	}
+	max, err := table.MaxSize(number)
+	if err != nil {
+		return false, err
+	}
+	if max < table.Size(p)+minPartitionGrowth {
+		log.Debugln("Partition already fills the free space")
+		return false, nil
+	}
+
+	err = table.ResizePartition(number, 0)
+	if err != nil {
+		return false, err
+	}
+	err = f.disk.WriteTable(diskPath, table)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//btrfsDevid returns the btrfs device id of device in the filesystem mounted
+//at mountPoint
+func (f *Filesystem) btrfsDevid(device string, mountPoint string) (string, error) {
+	output, status, err := f.run.CommandOutputStatus("btrfs filesystem show " + mountPoint)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		log.Errorln("btrfs filesystem show failed:", output)
+		return "", ErrResizeFailed
+	}
+	for _, line := range strings.Split(output, "\n") {
+		matches := btrfsDevidRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		if canonical(matches[2]) == canonical(device) {
+			return matches[1], nil
+		}
+	}
+	return "", ErrDeviceNotInFilesystem
+}
+
+func validatePaths(paths ...string) error {
+	for _, path := range paths {
+		if !pathRegex.MatchString(path) {
+			return ErrInvalidPath
+		}
+	}
+	return nil
+}
+
+func (f *Filesystem) growCommand(fsType string, device string, mountPoint string) (string, string, error) {
+	if err := validatePaths(device, mountPoint); err != nil {
+		return "", "", err
+	}
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		return "resize2fs", "resize2fs " + device, nil
+	case "xfs":
+		return "xfs_growfs", "xfs_growfs " + mountPoint, nil
+	case "btrfs":
+		if !f.run.ExecExistsInPath("btrfs") {
+			return "", "", ErrToolNotFound
+		}
+		devid, err := f.btrfsDevid(device, mountPoint)
+		if err != nil {
+			return "", "", err
+		}
+		return "btrfs", "btrfs filesystem resize " + devid + ":max " + mountPoint, nil
+	}
+	return "", "", ErrUnsupportedFilesystem
+}
+
+//GrowFilesystem grows the mounted filesystem given by its device or mount
+//point to fill the underlying volume. If the device is a partition it is
+//first grown into the free space that follows it on the disk.
+func (f *Filesystem) GrowFilesystem(target string) (*GrowResult, error) {
+	log.Debugln("Filesystem::GrowFilesystem ENTER")
+	log.Debugln("target:", target)
+
+	mi, err := f.findMount(target)
+	if err != nil {
+		log.Debugln("findMount Failed:", err)
+		log.Debugln("Filesystem::GrowFilesystem LEAVE")
+		return nil, err
+	}
+	if mi.HasOption("ro") {
+		log.Debugln("Filesystem is read-only")
+		log.Debugln("Filesystem::GrowFilesystem LEAVE")
+		return nil, fs.ErrReadOnlyFilesystem
+	}
+
+	result := &GrowResult{
+		Device:     canonical(mi.Source),
+		MountPoint: mi.MountPoint,
+		FsType:     mi.FsType,
+	}
+
+	exe, cmdLine, err := f.growCommand(result.FsType, result.Device, result.MountPoint)
+	if err != nil {
+		log.Debugln("growCommand Failed:", err)
+		log.Debugln("Filesystem::GrowFilesystem LEAVE")
+		return nil, err
+	}
+	if !f.run.ExecExistsInPath(exe) {
+		log.Debugln("Tool not found:", exe)
+		log.Debugln("Filesystem::GrowFilesystem LEAVE")
+		return nil, ErrToolNotFound
+	}
+
+	stats, err := f.getFsStats(result.MountPoint)
+	if err != nil {
+		log.Debugln("GetFsStats Failed:", err)
+		log.Debugln("Filesystem::GrowFilesystem LEAVE")
+		return nil, err
+	}
+	result.OldSizeBytes = stats.TotalBytes
+
+	if diskPath, number, ok := f.partitionOf(result.Device); ok {
+		result.Disk = diskPath
+		result.PartitionNumber = number
+		result.PartitionGrown, err = f.growPartition(diskPath, number)
+		if err != nil {
+			log.Debugln("growPartition Failed:", err)
+			log.Debugln("Filesystem::GrowFilesystem LEAVE")
+			return nil, err
+		}
+	}
+
+	output, status, err := f.run.CommandOutputStatus(cmdLine)
+	if err == nil && status != 0 {
+		log.Errorln("Resize failed:", cmdLine, "Output:", output)
+		err = ErrResizeFailed
+	}
+	if err != nil {
+		log.Debugln("Resize Failed:", err)
+		log.Debugln("Filesystem::GrowFilesystem LEAVE")
+		return nil, err
+	}
+
+	stats, err = f.getFsStats(result.MountPoint)
+	if err != nil {
+		log.Debugln("GetFsStats Failed:", err)
+		log.Debugln("Filesystem::GrowFilesystem LEAVE")
+		return nil, err
+	}
+	result.NewSizeBytes = stats.TotalBytes
+
+	log.Debugln("GrowFilesystem Old:", result.OldSizeBytes, "New:", result.NewSizeBytes)
+	log.Debugln("Filesystem::GrowFilesystem LEAVE")
+	return result, nil
+}
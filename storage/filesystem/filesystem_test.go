@@ -0,0 +1,218 @@
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+	disk "github.com/dvonthenen/goxplatform/storage/disk"
+)
+
+const (
+	mib = 1024 * 1024
+
+	testBtrfsShow = `Label: none  uuid: 6b1d3c5e-4f2a-4b7c-9d8e-0a1b2c3d4e5f
+	Total devices 2 FS bytes used 144.00KiB
+	devid    1 size 10.00GiB used 2.02GiB path /dev/sdc
+	devid    2 size 10.00GiB used 2.02GiB path /dev/sdd
+`
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+type testEnv struct {
+	dir      string
+	executor *fake.Executor
+	mounts   []*fs.MountInfo
+	sizes    []uint64
+}
+
+func newTestFilesystem(t *testing.T) (*Filesystem, *testEnv) {
+	dir, err := ioutil.TempDir("", "filesystem")
+	assert.Equal(t, nil, err)
+
+	env := &testEnv{
+		dir:      dir,
+		executor: fake.NewExecutor(),
+		sizes:    []uint64{100, 200},
+	}
+	f := NewFilesystemWithExecutor(env.executor)
+	f.sysfsRoot = filepath.Join(dir, "sys")
+	f.devDir = filepath.Join(dir, "dev")
+	f.getMounts = func() ([]*fs.MountInfo, error) {
+		return env.mounts, nil
+	}
+	f.getFsStats = func(path string) (*fs.FsStats, error) {
+		size := env.sizes[0]
+		if len(env.sizes) > 1 {
+			env.sizes = env.sizes[1:]
+		}
+		return &fs.FsStats{Path: path, TotalBytes: size}, nil
+	}
+	os.MkdirAll(f.devDir, 0755)
+	return f, env
+}
+
+//makePartitionedDisk creates a 64 MiB disk image with a 32 MiB partition 1
+//and its sysfs entries
+func makePartitionedDisk(t *testing.T, f *Filesystem) string {
+	image := filepath.Join(f.devDir, "sda")
+	file, _ := os.Create(image)
+	file.Truncate(64 * mib)
+	file.Close()
+	ioutil.WriteFile(filepath.Join(f.devDir, "sda1"), nil, 0644)
+
+	table, _ := disk.NewTable(disk.TypeGPT, 64*mib, 0)
+	table.AddPartition(0, 32*mib, disk.GUIDLinuxFilesystem, "data")
+	assert.Equal(t, nil, f.disk.WriteTable(image, table))
+
+	partDir := filepath.Join(f.sysfsRoot, "devices", "pci0000:00", "block", "sda", "sda1")
+	os.MkdirAll(partDir, 0755)
+	ioutil.WriteFile(filepath.Join(partDir, "partition"), []byte("1\n"), 0644)
+	os.MkdirAll(filepath.Join(f.sysfsRoot, "class", "block"), 0755)
+	os.Symlink(partDir, filepath.Join(f.sysfsRoot, "class", "block", "sda1"))
+	return image
+}
+
+func TestGrowExt4Partition(t *testing.T) {
+	f, env := newTestFilesystem(t)
+	defer os.RemoveAll(env.dir)
+
+	image := makePartitionedDisk(t, f)
+	device := filepath.Join(f.devDir, "sda1")
+	env.mounts = []*fs.MountInfo{{MountPoint: env.dir, Source: device, FsType: "ext4", Options: "rw"}}
+	env.executor.SetInPath("resize2fs", true)
+	env.executor.On("^resize2fs ", "The filesystem on /dev/sda1 is now 16384 (4k) blocks long.", 0)
+
+	result, err := f.GrowFilesystem(device)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, image, result.Disk)
+	assert.Equal(t, 1, result.PartitionNumber)
+	assert.True(t, result.PartitionGrown)
+	assert.True(t, result.Grown())
+	assert.Equal(t, uint64(100), result.OldSizeBytes)
+	assert.Equal(t, uint64(200), result.NewSizeBytes)
+	assert.True(t, env.executor.Ran("^resize2fs "+device+"$"))
+
+	table, _ := f.disk.ReadTable(image)
+	assert.Equal(t, table.LastUsableSector(), table.Partitions[0].EndSector)
+
+	result, err = f.GrowFilesystem(env.dir)
+	assert.Equal(t, nil, err)
+	assert.False(t, result.PartitionGrown)
+}
+
+func TestGrowXfsAndBtrfs(t *testing.T) {
+	f, env := newTestFilesystem(t)
+	defer os.RemoveAll(env.dir)
+
+	env.mounts = []*fs.MountInfo{
+		{MountPoint: "/var/lib/data", Source: "/dev/mapper/vg-data", FsType: "xfs"},
+		{MountPoint: "/srv", Source: "/dev/sdd", FsType: "btrfs"},
+		{MountPoint: "/other", Source: "/dev/sde", FsType: "btrfs"},
+		{MountPoint: "/broken", Source: "/dev/sdf", FsType: "btrfs"},
+	}
+	env.executor.SetInPath("xfs_growfs", true)
+	env.executor.SetInPath("btrfs", true)
+	env.executor.On("^xfs_growfs ", "data blocks changed from 2621440 to 5242880", 0)
+	env.executor.On("^btrfs filesystem show /srv$", testBtrfsShow, 0)
+	env.executor.On("^btrfs filesystem show /other$", testBtrfsShow, 0)
+	env.executor.On("^btrfs filesystem show /broken$", "ERROR: not a btrfs filesystem", 1)
+	env.executor.On("^btrfs filesystem resize ", "Resize device id 2 (/dev/sdd) from 10.00GiB to max", 0)
+
+	result, err := f.GrowFilesystem("/var/lib/data")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, result.PartitionNumber)
+	assert.True(t, env.executor.Ran("^xfs_growfs /var/lib/data$"))
+
+	_, err = f.GrowFilesystem("/srv")
+	assert.Equal(t, nil, err)
+	assert.True(t, env.executor.Ran("^btrfs filesystem resize 2:max /srv$"))
+
+	_, err = f.GrowFilesystem("/other")
+	assert.Equal(t, ErrDeviceNotInFilesystem, err)
+	_, err = f.GrowFilesystem("/broken")
+	assert.Equal(t, ErrResizeFailed, err)
+}
+
+func TestGrowErrors(t *testing.T) {
+	f, env := newTestFilesystem(t)
+	defer os.RemoveAll(env.dir)
+
+	env.mounts = []*fs.MountInfo{
+		{MountPoint: "/boot", Source: "/dev/sda1", FsType: "vfat"},
+		{MountPoint: "/data", Source: "/dev/sdb", FsType: "ext4"},
+		{MountPoint: "/ro", Source: "/dev/sdc", FsType: "ext4", Options: "ro"},
+	}
+
+	_, err := f.GrowFilesystem("/nowhere")
+	assert.Equal(t, fs.ErrNotMounted, err)
+	_, err = f.GrowFilesystem("/boot")
+	assert.Equal(t, ErrUnsupportedFilesystem, err)
+	_, err = f.GrowFilesystem("/ro")
+	assert.Equal(t, fs.ErrReadOnlyFilesystem, err)
+	_, err = f.GrowFilesystem("/data")
+	assert.Equal(t, ErrToolNotFound, err)
+
+	env.executor.SetInPath("resize2fs", true)
+	env.executor.On("^resize2fs ", "resize2fs: Permission denied", 1)
+	_, err = f.GrowFilesystem("/data")
+	assert.Equal(t, ErrResizeFailed, err)
+}
+
+func TestMountAndMakeFilesystem(t *testing.T) {
+	f, env := newTestFilesystem(t)
+	defer os.RemoveAll(env.dir)
+
+	target := filepath.Join(env.dir, "mnt", "data")
+	env.mounts = []*fs.MountInfo{{MountPoint: env.dir, Source: "/dev/sdz", FsType: "ext4"}}
+	env.executor.On("^mount ", "", 0)
+	env.executor.On("^umount ", "", 0)
+
+	mounted, err := f.Mount("/dev/mapper/data", target, "xfs", "noatime,nofail")
+	assert.Equal(t, nil, err)
+	assert.True(t, mounted)
+	assert.True(t, env.executor.Ran("^mount -t xfs -o noatime,nofail /dev/mapper/data "+target+"$"))
+
+	env.mounts = append(env.mounts, &fs.MountInfo{MountPoint: target, Source: "/dev/mapper/data", FsType: "xfs"})
+	mounted, err = f.Mount("/dev/mapper/data", target, "xfs", "")
+	assert.Equal(t, nil, err)
+	assert.False(t, mounted)
+	_, err = f.Mount("/dev/sdb", target, "", "")
+	assert.Equal(t, ErrAlreadyMounted, err)
+	_, err = f.Mount("/dev/sdb", target, "", "rw;reboot")
+	assert.Equal(t, ErrInvalidPath, err)
+
+	unmounted, err := f.Unmount(target)
+	assert.Equal(t, nil, err)
+	assert.True(t, unmounted)
+	unmounted, err = f.Unmount("/mnt/other")
+	assert.Equal(t, nil, err)
+	assert.False(t, unmounted)
+
+	env.executor.SetInPath("mkfs.ext4", true)
+	env.executor.On("^blkid .* /dev/sdb$", "", 2)
+	env.executor.On("^blkid .* /dev/sdc$", "xfs", 0)
+	env.executor.On("^mkfs.ext4 ", "", 0)
+
+	created, err := f.MakeFilesystem("/dev/sdb", "ext4", "data")
+	assert.Equal(t, nil, err)
+	assert.True(t, created)
+	assert.True(t, env.executor.Ran("^mkfs.ext4 -L data /dev/sdb$"))
+
+	_, err = f.MakeFilesystem("/dev/sdc", "ext4", "")
+	assert.Equal(t, ErrFilesystemExists, err)
+	created, err = f.MakeFilesystem("/dev/sdc", "xfs", "")
+	assert.Equal(t, nil, err)
+	assert.False(t, created)
+}
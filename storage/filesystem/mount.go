@@ -0,0 +1,241 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+)
+
+const (
+	blkidNotFound = 2
+)
+
+var (
+	//ErrAlreadyMounted another device is mounted on the mount point
+	ErrAlreadyMounted = errors.New("Another device is mounted on the mount point")
+
+	//ErrFilesystemExists the device already contains a different filesystem
+	ErrFilesystemExists = errors.New("Device already contains a different filesystem")
+
+	//ErrMountFailed the mount or umount command failed
+	ErrMountFailed = errors.New("Mount command failed")
+
+	//ErrMkfsFailed the mkfs command failed
+	ErrMkfsFailed = errors.New("mkfs failed")
+
+	//ErrProbeFailed blkid failed to probe the device
+	ErrProbeFailed = errors.New("Unable to probe the device")
+
+	fsTypeRegex  = regexp.MustCompile("^[a-z0-9_.]+$")
+	optionsRegex = regexp.MustCompile("^[a-zA-Z0-9_.,:=/@+\\-]*$")
+	labelRegex   = regexp.MustCompile("^[a-zA-Z0-9_.\\-]{0,16}$")
+	sourceRegex  = regexp.MustCompile("^[a-zA-Z0-9_.,:=/@+\\[\\]\\-]+$")
+)
+
+//GetFsType returns the filesystem type on device or an empty string if the
+//device does not contain a filesystem
+func (f *Filesystem) GetFsType(device string) (string, error) {
+	log.Debugln("Filesystem::GetFsType ENTER")
+	log.Debugln("device:", device)
+
+	if err := validatePaths(device); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Filesystem::GetFsType LEAVE")
+		return "", err
+	}
+
+	output, status, err := f.run.CommandOutputStatus("blkid -p -o value -s TYPE " + device)
+	if err != nil {
+		log.Debugln("blkid Failed:", err)
+		log.Debugln("Filesystem::GetFsType LEAVE")
+		return "", err
+	}
+	if status == blkidNotFound {
+		log.Debugln("No filesystem found")
+		log.Debugln("Filesystem::GetFsType LEAVE")
+		return "", nil
+	}
+	if status != 0 {
+		log.Errorln("blkid failed:", output)
+		log.Debugln("Filesystem::GetFsType LEAVE")
+		return "", ErrProbeFailed
+	}
+
+	log.Debugln("GetFsType =", output)
+	log.Debugln("Filesystem::GetFsType LEAVE")
+	return output, nil
+}
+
+//MakeFilesystem creates a filesystem of fsType on device unless it already
+//contains one. A device that contains a different filesystem is never
+//overwritten. Returns true if the filesystem was created.
+func (f *Filesystem) MakeFilesystem(device string, fsType string, label string) (bool, error) {
+	log.Debugln("Filesystem::MakeFilesystem ENTER")
+	log.Debugln("device:", device)
+	log.Debugln("fsType:", fsType)
+
+	if !fsTypeRegex.MatchString(fsType) || !labelRegex.MatchString(label) {
+		log.Debugln("Invalid fsType or label")
+		log.Debugln("Filesystem::MakeFilesystem LEAVE")
+		return false, ErrInvalidPath
+	}
+
+	existing, err := f.GetFsType(device)
+	if err != nil {
+		log.Debugln("GetFsType Failed:", err)
+		log.Debugln("Filesystem::MakeFilesystem LEAVE")
+		return false, err
+	}
+	if existing == fsType {
+		log.Debugln("Filesystem already exists")
+		log.Debugln("Filesystem::MakeFilesystem LEAVE")
+		return false, nil
+	}
+	if len(existing) > 0 {
+		log.Errorln("Device", device, "already contains", existing)
+		log.Debugln("Filesystem::MakeFilesystem LEAVE")
+		return false, ErrFilesystemExists
+	}
+
+	exe := "mkfs." + fsType
+	if !f.run.ExecExistsInPath(exe) {
+		log.Debugln("Tool not found:", exe)
+		log.Debugln("Filesystem::MakeFilesystem LEAVE")
+		return false, ErrToolNotFound
+	}
+
+	cmdLine := exe
+	if len(label) > 0 {
+		cmdLine += " -L " + label
+	}
+	cmdLine += " " + device
+	output, status, err := f.run.CommandOutputStatus(cmdLine)
+	if err == nil && status != 0 {
+		log.Errorln("mkfs failed:", output)
+		err = ErrMkfsFailed
+	}
+	if err != nil {
+		log.Debugln("mkfs Failed:", err)
+		log.Debugln("Filesystem::MakeFilesystem LEAVE")
+		return false, err
+	}
+
+	log.Debugln("Filesystem::MakeFilesystem LEAVE")
+	return true, nil
+}
+
+//Mount mounts source on target, creating target if needed. An empty fsType
+//lets mount detect it. Returns true if it was mounted and false if source is
+//already mounted there.
+func (f *Filesystem) Mount(source string, target string, fsType string, options string) (bool, error) {
+	log.Debugln("Filesystem::Mount ENTER")
+	log.Debugln("source:", source)
+	log.Debugln("target:", target)
+	log.Debugln("fsType:", fsType)
+	log.Debugln("options:", options)
+
+	if (len(fsType) > 0 && !fsTypeRegex.MatchString(fsType)) || !optionsRegex.MatchString(options) {
+		log.Debugln("Invalid fsType or options")
+		log.Debugln("Filesystem::Mount LEAVE")
+		return false, ErrInvalidPath
+	}
+	if err := validatePaths(target); err != nil {
+		log.Debugln("Invalid target")
+		log.Debugln("Filesystem::Mount LEAVE")
+		return false, err
+	}
+	if !sourceRegex.MatchString(source) {
+		log.Debugln("Invalid source")
+		log.Debugln("Filesystem::Mount LEAVE")
+		return false, ErrInvalidPath
+	}
+
+	mi, err := f.findMount(target)
+	if err == nil && canonical(mi.MountPoint) == canonical(target) {
+		if mi.Source == source || canonical(mi.Source) == canonical(source) {
+			log.Debugln("Already mounted")
+			log.Debugln("Filesystem::Mount LEAVE")
+			return false, nil
+		}
+		log.Errorln(mi.Source, "is already mounted on", target)
+		log.Debugln("Filesystem::Mount LEAVE")
+		return false, ErrAlreadyMounted
+	}
+
+	err = os.MkdirAll(target, 0755)
+	if err != nil {
+		log.Debugln("MkdirAll Failed:", err)
+		log.Debugln("Filesystem::Mount LEAVE")
+		return false, err
+	}
+
+	cmdLine := "mount"
+	if len(fsType) > 0 {
+		cmdLine += " -t " + fsType
+	}
+	if len(options) > 0 {
+		cmdLine += " -o " + options
+	}
+	if strings.ContainsAny(source, "[]") {
+		//IPv6 NFS servers are in brackets which bash treats as a glob
+		source = "'" + source + "'"
+	}
+	cmdLine += " " + source + " " + target
+	output, status, err := f.run.CommandOutputStatus(cmdLine)
+	if err == nil && status != 0 {
+		log.Errorln("mount failed:", output)
+		err = ErrMountFailed
+	}
+	if err != nil {
+		log.Debugln("mount Failed:", err)
+		log.Debugln("Filesystem::Mount LEAVE")
+		return false, err
+	}
+
+	log.Debugln("Filesystem::Mount LEAVE")
+	return true, nil
+}
+
+//Unmount unmounts the mount point or device target. Returns true if it was
+//unmounted and false if it was not mounted.
+func (f *Filesystem) Unmount(target string) (bool, error) {
+	log.Debugln("Filesystem::Unmount ENTER")
+	log.Debugln("target:", target)
+
+	if err := validatePaths(target); err != nil {
+		log.Debugln("Invalid target")
+		log.Debugln("Filesystem::Unmount LEAVE")
+		return false, err
+	}
+
+	_, err := f.findMount(target)
+	if err == fs.ErrNotMounted {
+		log.Debugln("Not mounted")
+		log.Debugln("Filesystem::Unmount LEAVE")
+		return false, nil
+	}
+	if err != nil {
+		log.Debugln("findMount Failed:", err)
+		log.Debugln("Filesystem::Unmount LEAVE")
+		return false, err
+	}
+
+	output, status, err := f.run.CommandOutputStatus("umount " + target)
+	if err == nil && status != 0 {
+		log.Errorln("umount failed:", output)
+		err = ErrMountFailed
+	}
+	if err != nil {
+		log.Debugln("umount Failed:", err)
+		log.Debugln("Filesystem::Unmount LEAVE")
+		return false, err
+	}
+
+	log.Debugln("Filesystem::Unmount LEAVE")
+	return true, nil
+}
@@ -0,0 +1,455 @@
+package iscsi
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+)
+
+const (
+	//StartupAutomatic logs into the node when iscsid starts
+	StartupAutomatic = "automatic"
+
+	//StartupManual only logs into the node when asked
+	StartupManual = "manual"
+
+	//StartupOnBoot logs into the node from the initramfs
+	StartupOnBoot = "onboot"
+
+	defaultInitiatorFile = "/etc/iscsi/initiatorname.iscsi"
+	defaultSysfsRoot     = "/sys"
+	defaultIqnPrefix     = "iqn.2005-03.org.open-iscsi"
+
+	//iscsiadm exit codes
+	exitSessionExists  = 15
+	exitNoObjectsFound = 21
+)
+
+var (
+	//ErrInitiatorNameNotFound the initiator name file does not contain a name
+	ErrInitiatorNameNotFound = errors.New("Initiator name not found")
+
+	//ErrInvalidTarget the target IQN or portal is invalid
+	ErrInvalidTarget = errors.New("Invalid iSCSI target")
+
+	//ErrInvalidStartup the node startup value is invalid
+	ErrInvalidStartup = errors.New("Invalid iSCSI node startup value")
+
+	//ErrIscsiadmFailed iscsiadm returned an error
+	ErrIscsiadmFailed = errors.New("iscsiadm command failed")
+
+	iqnRegex     = regexp.MustCompile("^(iqn\\.[0-9]{4}-[0-9]{2}\\.[a-zA-Z0-9.\\-]+(:[a-zA-Z0-9.:\\-]+)?|eui\\.[0-9a-fA-F]{16}|naa\\.[0-9a-fA-F]{16,32})$")
+	portalRegex  = regexp.MustCompile("^(\\[[0-9a-fA-F:.]+\\]|[a-zA-Z0-9.\\-]+)(:[0-9]+)?$")
+	sessionRegex = regexp.MustCompile("^(\\S+): \\[([0-9]+)\\] (\\S+),([0-9]+) (\\S+)")
+)
+
+//Target is an iSCSI target reachable through a portal
+type Target struct {
+	Portal string
+	TPGT   int
+	IQN    string
+}
+
+//Session is an active iSCSI session
+type Session struct {
+	ID        int
+	Transport string
+	Target
+
+	//Devices are the block devices attached through the session (/dev/sdb)
+	Devices []string
+}
+
+//Iscsi manages the open-iscsi initiator
+type Iscsi struct {
+	run           common.IExecutor
+	initiatorFile string
+	sysfsRoot     string
+	fs            *fs.Fs
+}
+
+//NewIscsi generates an Iscsi object
+func NewIscsi() *Iscsi {
+	return NewIscsiWithExecutor(run.NewRun())
+}
+
+//NewIscsiWithExecutor generates an Iscsi object that runs iscsiadm through
+//the given executor
+func NewIscsiWithExecutor(executor common.IExecutor) *Iscsi {
+	myIscsi := &Iscsi{
+		run:           executor,
+		initiatorFile: defaultInitiatorFile,
+		sysfsRoot:     defaultSysfsRoot,
+		fs:            fs.NewFs(),
+	}
+	return myIscsi
+}
+
+func validateTarget(target *Target) error {
+	if target == nil || !iqnRegex.MatchString(target.IQN) || !portalRegex.MatchString(target.Portal) {
+		return ErrInvalidTarget
+	}
+	return nil
+}
+
+func parseInitiatorName(data string) string {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "InitiatorName=") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "InitiatorName="))
+		}
+	}
+	return ""
+}
+
+//GetInitiatorName returns the initiator name of this host
+func (iscsi *Iscsi) GetInitiatorName() (string, error) {
+	log.Debugln("Iscsi::GetInitiatorName ENTER")
+
+	data, err := ioutil.ReadFile(iscsi.initiatorFile)
+	if err != nil {
+		log.Debugln("ReadFile Failed:", err)
+		log.Debugln("Iscsi::GetInitiatorName LEAVE")
+		return "", err
+	}
+
+	name := parseInitiatorName(string(data))
+	if len(name) == 0 {
+		log.Debugln("No InitiatorName in", iscsi.initiatorFile)
+		log.Debugln("Iscsi::GetInitiatorName LEAVE")
+		return "", ErrInitiatorNameNotFound
+	}
+
+	log.Debugln("InitiatorName:", name)
+	log.Debugln("Iscsi::GetInitiatorName LEAVE")
+	return name, nil
+}
+
+func (iscsi *Iscsi) generateInitiatorName() (string, error) {
+	if iscsi.run.ExecExistsInPath("iscsi-iname") {
+		name, err := iscsi.run.CommandOutput("iscsi-iname")
+		if err == nil && iqnRegex.MatchString(name) {
+			return name, nil
+		}
+		log.Warnln("iscsi-iname Failed. Generating name. Err:", err)
+	}
+
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return defaultIqnPrefix + ":" + hex.EncodeToString(buf), nil
+}
+
+//EnsureInitiatorName returns the initiator name of this host, generating and
+//persisting one if it does not exist. Returns true if a name was generated.
+func (iscsi *Iscsi) EnsureInitiatorName() (string, bool, error) {
+	log.Debugln("Iscsi::EnsureInitiatorName ENTER")
+
+	lock, err := iscsi.fs.Lock("iscsi", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("Iscsi::EnsureInitiatorName LEAVE")
+		return "", false, err
+	}
+	defer lock.Unlock()
+
+	name, err := iscsi.GetInitiatorName()
+	if err == nil {
+		log.Debugln("Iscsi::EnsureInitiatorName LEAVE")
+		return name, false, nil
+	}
+	if err != ErrInitiatorNameNotFound && !os.IsNotExist(err) {
+		log.Debugln("GetInitiatorName Failed:", err)
+		log.Debugln("Iscsi::EnsureInitiatorName LEAVE")
+		return "", false, err
+	}
+
+	name, err = iscsi.generateInitiatorName()
+	if err != nil {
+		log.Debugln("generateInitiatorName Failed:", err)
+		log.Debugln("Iscsi::EnsureInitiatorName LEAVE")
+		return "", false, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(iscsi.initiatorFile), 0755)
+	if err != nil {
+		log.Debugln("MkdirAll Failed:", err)
+		log.Debugln("Iscsi::EnsureInitiatorName LEAVE")
+		return "", false, err
+	}
+
+	err = iscsi.fs.WriteFileAtomic(iscsi.initiatorFile, []byte("InitiatorName="+name+"\n"), 0644)
+	if err != nil {
+		log.Debugln("WriteFile Failed:", err)
+		log.Debugln("Iscsi::EnsureInitiatorName LEAVE")
+		return "", false, err
+	}
+
+	log.Infoln("Generated InitiatorName:", name)
+	log.Debugln("Iscsi::EnsureInitiatorName LEAVE")
+	return name, true, nil
+}
+
+func parseDiscovery(output string) []*Target {
+	list := []*Target{}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		idx := strings.LastIndex(fields[0], ",")
+		if idx == -1 {
+			continue
+		}
+		tpgt, err := strconv.Atoi(fields[0][idx+1:])
+		if err != nil {
+			continue
+		}
+
+		target := &Target{
+			Portal: fields[0][:idx],
+			TPGT:   tpgt,
+			IQN:    fields[1],
+		}
+		//the names end up on iscsiadm command lines so anything a portal
+		//sends back has to pass the same checks as a caller's target
+		if validateTarget(target) != nil {
+			log.Warnln("Ignoring invalid discovered target:", scanner.Text())
+			continue
+		}
+		list = append(list, target)
+	}
+
+	return list
+}
+
+//Discover performs a sendtargets discovery against the portal
+func (iscsi *Iscsi) Discover(portal string) ([]*Target, error) {
+	log.Debugln("Iscsi::Discover ENTER")
+	log.Debugln("portal:", portal)
+
+	if !portalRegex.MatchString(portal) {
+		log.Debugln("Invalid portal")
+		log.Debugln("Iscsi::Discover LEAVE")
+		return nil, ErrInvalidTarget
+	}
+
+	cmdLine := "iscsiadm -m discovery -t sendtargets -p '" + portal + "'"
+	output, status, err := iscsi.run.CommandOutputStatus(cmdLine)
+	if err != nil {
+		log.Debugln("CommandOutputStatus Failed:", err)
+		log.Debugln("Iscsi::Discover LEAVE")
+		return nil, err
+	}
+	if status == exitNoObjectsFound {
+		log.Debugln("No targets found")
+		log.Debugln("Iscsi::Discover LEAVE")
+		return []*Target{}, nil
+	}
+	if status != 0 {
+		log.Errorln("Discovery Failed:", output)
+		log.Debugln("Iscsi::Discover LEAVE")
+		return nil, ErrIscsiadmFailed
+	}
+
+	list := parseDiscovery(output)
+
+	log.Debugln("Discover Count:", len(list))
+	log.Debugln("Iscsi::Discover LEAVE")
+	return list, nil
+}
+
+//Login logs into the target. Logging into a target that already has a
+//session succeeds.
+func (iscsi *Iscsi) Login(target *Target) error {
+	log.Debugln("Iscsi::Login ENTER")
+
+	if err := validateTarget(target); err != nil {
+		log.Debugln("Invalid target")
+		log.Debugln("Iscsi::Login LEAVE")
+		return err
+	}
+	log.Debugln("target:", target.IQN, "portal:", target.Portal)
+
+	cmdLine := "iscsiadm -m node -T '" + target.IQN + "' -p '" + target.Portal + "' --login"
+	output, status, err := iscsi.run.CommandOutputStatus(cmdLine)
+	if err != nil {
+		log.Debugln("CommandOutputStatus Failed:", err)
+		log.Debugln("Iscsi::Login LEAVE")
+		return err
+	}
+	if status != 0 && status != exitSessionExists {
+		log.Errorln("Login Failed:", output)
+		log.Debugln("Iscsi::Login LEAVE")
+		return ErrIscsiadmFailed
+	}
+
+	log.Debugln("Login Succeeded")
+	log.Debugln("Iscsi::Login LEAVE")
+	return nil
+}
+
+//Logout logs out of the target. Logging out of a target without a session
+//succeeds.
+func (iscsi *Iscsi) Logout(target *Target) error {
+	log.Debugln("Iscsi::Logout ENTER")
+
+	if err := validateTarget(target); err != nil {
+		log.Debugln("Invalid target")
+		log.Debugln("Iscsi::Logout LEAVE")
+		return err
+	}
+	log.Debugln("target:", target.IQN, "portal:", target.Portal)
+
+	cmdLine := "iscsiadm -m node -T '" + target.IQN + "' -p '" + target.Portal + "' --logout"
+	output, status, err := iscsi.run.CommandOutputStatus(cmdLine)
+	if err != nil {
+		log.Debugln("CommandOutputStatus Failed:", err)
+		log.Debugln("Iscsi::Logout LEAVE")
+		return err
+	}
+	if status != 0 && status != exitNoObjectsFound {
+		log.Errorln("Logout Failed:", output)
+		log.Debugln("Iscsi::Logout LEAVE")
+		return ErrIscsiadmFailed
+	}
+
+	log.Debugln("Logout Succeeded")
+	log.Debugln("Iscsi::Logout LEAVE")
+	return nil
+}
+
+func parseSessions(output string) []*Session {
+	list := []*Session{}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		needles := sessionRegex.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if needles == nil {
+			continue
+		}
+
+		id, _ := strconv.Atoi(needles[2])
+		tpgt, _ := strconv.Atoi(needles[4])
+		list = append(list, &Session{
+			ID:        id,
+			Transport: needles[1],
+			Target: Target{
+				Portal: needles[3],
+				TPGT:   tpgt,
+				IQN:    needles[5],
+			},
+		})
+	}
+
+	return list
+}
+
+//sessionDevices returns the block devices attached to the session using the
+//sysfs layout iscsi_session/session<ID>/device/target*/<H:C:T:L>/block/<dev>
+func (iscsi *Iscsi) sessionDevices(id int) []string {
+	pattern := filepath.Join(iscsi.sysfsRoot, "class", "iscsi_session",
+		"session"+strconv.Itoa(id), "device", "target*", "*", "block", "*")
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		log.Debugln("Glob Failed:", err)
+		return []string{}
+	}
+
+	devices := make([]string, 0, len(matches))
+	for _, match := range matches {
+		devices = append(devices, "/dev/"+filepath.Base(match))
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+//GetSessions returns the active sessions along with their block devices
+func (iscsi *Iscsi) GetSessions() ([]*Session, error) {
+	log.Debugln("Iscsi::GetSessions ENTER")
+
+	output, status, err := iscsi.run.CommandOutputStatus("iscsiadm -m session")
+	if err != nil {
+		log.Debugln("CommandOutputStatus Failed:", err)
+		log.Debugln("Iscsi::GetSessions LEAVE")
+		return nil, err
+	}
+	if status == exitNoObjectsFound {
+		log.Debugln("No active sessions")
+		log.Debugln("Iscsi::GetSessions LEAVE")
+		return []*Session{}, nil
+	}
+	if status != 0 {
+		log.Errorln("Session list Failed:", output)
+		log.Debugln("Iscsi::GetSessions LEAVE")
+		return nil, ErrIscsiadmFailed
+	}
+
+	list := parseSessions(output)
+	for _, session := range list {
+		session.Devices = iscsi.sessionDevices(session.ID)
+	}
+
+	log.Debugln("GetSessions Count:", len(list))
+	log.Debugln("Iscsi::GetSessions LEAVE")
+	return list, nil
+}
+
+//SetNodeStartup persists the node.startup setting of the target so it is or
+//is not logged into automatically
+func (iscsi *Iscsi) SetNodeStartup(target *Target, startup string) error {
+	log.Debugln("Iscsi::SetNodeStartup ENTER")
+	log.Debugln("startup:", startup)
+
+	if err := validateTarget(target); err != nil {
+		log.Debugln("Invalid target")
+		log.Debugln("Iscsi::SetNodeStartup LEAVE")
+		return err
+	}
+	if startup != StartupAutomatic && startup != StartupManual && startup != StartupOnBoot {
+		log.Debugln("Invalid startup")
+		log.Debugln("Iscsi::SetNodeStartup LEAVE")
+		return ErrInvalidStartup
+	}
+
+	cmdLine := "iscsiadm -m node -T '" + target.IQN + "' -p '" + target.Portal +
+		"' --op update -n node.startup -v " + startup
+	output, status, err := iscsi.run.CommandOutputStatus(cmdLine)
+	if err != nil {
+		log.Debugln("CommandOutputStatus Failed:", err)
+		log.Debugln("Iscsi::SetNodeStartup LEAVE")
+		return err
+	}
+	if status != 0 {
+		log.Errorln("SetNodeStartup Failed:", output)
+		log.Debugln("Iscsi::SetNodeStartup LEAVE")
+		return ErrIscsiadmFailed
+	}
+
+	log.Debugln("SetNodeStartup Succeeded")
+	log.Debugln("Iscsi::SetNodeStartup LEAVE")
+	return nil
+}
@@ -0,0 +1,149 @@
+package iscsi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+)
+
+const (
+	testTargetIQN = "iqn.2003-01.org.linux-iscsi.storage:sn.0123456789ab"
+
+	testDiscovery = `10.0.0.10:3260,1 iqn.2003-01.org.linux-iscsi.storage:sn.0123456789ab
+[fe80::1]:3260,1 iqn.2003-01.org.linux-iscsi.storage:sn.0123456789ab
+10.0.0.10:3260,1 iqn.2003-01.org.x:$(reboot)
+10.0.0.10;reboot:3260,1 iqn.2003-01.org.linux-iscsi.storage:sn.0123456789ab
+`
+
+	testSessions = `tcp: [1] 10.0.0.10:3260,1 iqn.2003-01.org.linux-iscsi.storage:sn.0123456789ab (non-flash)
+tcp: [3] 10.0.0.11:3260,2 iqn.2003-01.org.linux-iscsi.storage:sn.ba9876543210 (non-flash)
+`
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+func newTestIscsi(t *testing.T) (*Iscsi, *fake.Executor, string) {
+	dir, err := ioutil.TempDir("", "iscsi")
+	assert.Equal(t, nil, err)
+
+	executor := fake.NewExecutor()
+	iscsi := NewIscsiWithExecutor(executor)
+	iscsi.initiatorFile = filepath.Join(dir, "iscsi", "initiatorname.iscsi")
+	iscsi.sysfsRoot = filepath.Join(dir, "sys")
+	iscsi.fs.SetLockDir(dir)
+	return iscsi, executor, dir
+}
+
+func TestEnsureInitiatorName(t *testing.T) {
+	iscsi, executor, dir := newTestIscsi(t)
+	defer os.RemoveAll(dir)
+
+	executor.SetInPath("iscsi-iname", true)
+	executor.On("^iscsi-iname$", "iqn.2005-03.org.open-iscsi:4f2a1b3c5d6e", 0)
+
+	_, err := iscsi.GetInitiatorName()
+	assert.True(t, os.IsNotExist(err))
+
+	name, generated, err := iscsi.EnsureInitiatorName()
+	assert.Equal(t, nil, err)
+	assert.True(t, generated)
+	assert.Equal(t, "iqn.2005-03.org.open-iscsi:4f2a1b3c5d6e", name)
+
+	name, generated, err = iscsi.EnsureInitiatorName()
+	assert.Equal(t, nil, err)
+	assert.False(t, generated)
+	assert.Equal(t, "iqn.2005-03.org.open-iscsi:4f2a1b3c5d6e", name)
+}
+
+func TestDiscover(t *testing.T) {
+	iscsi, executor, dir := newTestIscsi(t)
+	defer os.RemoveAll(dir)
+
+	executor.On("sendtargets -p '10.0.0.10'$", testDiscovery, 0)
+	executor.On("sendtargets -p '10.0.0.99'$", "iscsiadm: No portals found", 21)
+
+	targets, err := iscsi.Discover("10.0.0.10")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(targets))
+	assert.Equal(t, "10.0.0.10:3260", targets[0].Portal)
+	assert.Equal(t, 1, targets[0].TPGT)
+	assert.Equal(t, testTargetIQN, targets[0].IQN)
+	assert.Equal(t, "[fe80::1]:3260", targets[1].Portal)
+
+	targets, err = iscsi.Discover("10.0.0.99")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(targets))
+
+	_, err = iscsi.Discover("10.0.0.10; reboot")
+	assert.Equal(t, ErrInvalidTarget, err)
+}
+
+func TestLoginLogout(t *testing.T) {
+	iscsi, executor, dir := newTestIscsi(t)
+	defer os.RemoveAll(dir)
+
+	target := &Target{Portal: "10.0.0.10:3260", IQN: testTargetIQN}
+
+	executor.On("--login$", "iscsiadm: default: 1 session requested, but 1 already present.", 15)
+	executor.On("--logout$", "iscsiadm: No matching sessions found", 21)
+
+	assert.Equal(t, nil, iscsi.Login(target))
+	assert.Equal(t, nil, iscsi.Logout(target))
+
+	executor.On("--login$", "iscsiadm: initiator reported error (8 - connection timed out)", 8)
+	assert.Equal(t, ErrIscsiadmFailed, iscsi.Login(target))
+
+	assert.Equal(t, ErrInvalidTarget, iscsi.Login(&Target{Portal: "10.0.0.10", IQN: "bogus"}))
+	assert.Equal(t, ErrInvalidTarget, iscsi.Login(&Target{Portal: "10.0.0.10", IQN: "iqn.2003-01.org.x:$(reboot)"}))
+	assert.Equal(t, ErrInvalidTarget, iscsi.Login(&Target{Portal: "10.0.0.10", IQN: "iqn.2003-01.org.x:a;touch${IFS}/tmp/pwn;#"}))
+}
+
+func TestGetSessions(t *testing.T) {
+	iscsi, executor, dir := newTestIscsi(t)
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(iscsi.sysfsRoot, "class", "iscsi_session", "session1",
+		"device", "target2:0:0", "2:0:0:1", "block", "sdc"), 0755)
+	os.MkdirAll(filepath.Join(iscsi.sysfsRoot, "class", "iscsi_session", "session1",
+		"device", "target2:0:0", "2:0:0:0", "block", "sdb"), 0755)
+
+	executor.On("^iscsiadm -m session$", testSessions, 0)
+
+	sessions, err := iscsi.GetSessions()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(sessions))
+	assert.Equal(t, 1, sessions[0].ID)
+	assert.Equal(t, "tcp", sessions[0].Transport)
+	assert.Equal(t, testTargetIQN, sessions[0].IQN)
+	assert.Equal(t, []string{"/dev/sdb", "/dev/sdc"}, sessions[0].Devices)
+	assert.Equal(t, 3, sessions[1].ID)
+	assert.Equal(t, 2, sessions[1].TPGT)
+	assert.Equal(t, 0, len(sessions[1].Devices))
+
+	executor.On("^iscsiadm -m session$", "iscsiadm: No active sessions.", 21)
+	sessions, err = iscsi.GetSessions()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(sessions))
+}
+
+func TestSetNodeStartup(t *testing.T) {
+	iscsi, executor, dir := newTestIscsi(t)
+	defer os.RemoveAll(dir)
+
+	target := &Target{Portal: "10.0.0.10:3260", IQN: testTargetIQN}
+	executor.On("-n node.startup -v automatic$", "", 0)
+
+	assert.Equal(t, nil, iscsi.SetNodeStartup(target, StartupAutomatic))
+	assert.True(t, executor.Ran("-T '"+testTargetIQN+"' -p '10.0.0.10:3260' --op update"))
+	assert.Equal(t, ErrInvalidStartup, iscsi.SetNodeStartup(target, "sometimes"))
+}
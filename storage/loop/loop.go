@@ -0,0 +1,416 @@
+package loop
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+)
+
+const (
+	defaultSysfsRoot = "/sys"
+	deletedSuffix    = " (deleted)"
+)
+
+var (
+	//ErrInvalidPath the image or device path is invalid
+	ErrInvalidPath = errors.New("Invalid image or loop device path")
+
+	//ErrImageExists the image file already exists with a different size
+	ErrImageExists = errors.New("Image file already exists with a different size")
+
+	//ErrLosetupFailed the losetup command failed
+	ErrLosetupFailed = errors.New("losetup failed")
+
+	pathRegex   = regexp.MustCompile("^/[a-zA-Z0-9/_.:+@,=\\-]*$")
+	deviceRegex = regexp.MustCompile("^/dev/loop[0-9]+$")
+)
+
+//AttachOptions configures how an image is attached
+type AttachOptions struct {
+	//Offset is where the device starts in the file
+	Offset uint64
+
+	//SizeLimit is the maximum size of the device. 0 uses the rest of the file.
+	SizeLimit uint64
+
+	ReadOnly bool
+
+	//PartScan makes the kernel scan the device for partitions
+	PartScan bool
+}
+
+//Device is an attached loop device
+type Device struct {
+	Device      string
+	BackingFile string
+	Offset      uint64
+	SizeLimit   uint64
+	ReadOnly    bool
+	AutoClear   bool
+}
+
+//Loop manages loop devices and the image files behind them
+type Loop struct {
+	run       common.IExecutor
+	sysfsRoot string
+	fs        *fs.Fs
+}
+
+//NewLoop generates a Loop object
+func NewLoop() *Loop {
+	return NewLoopWithExecutor(run.NewRun())
+}
+
+//NewLoopWithExecutor generates a Loop object that runs losetup through the
+//given executor
+func NewLoopWithExecutor(executor common.IExecutor) *Loop {
+	myLoop := &Loop{
+		run:       executor,
+		sysfsRoot: defaultSysfsRoot,
+		fs:        fs.NewFs(),
+	}
+	return myLoop
+}
+
+func absPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !pathRegex.MatchString(abs) {
+		return "", ErrInvalidPath
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs, nil
+	}
+	//a symlink can point at a name the shell would interpret
+	if !pathRegex.MatchString(real) {
+		return "", ErrInvalidPath
+	}
+	return real, nil
+}
+
+func readSysfsValue(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+//CreateImage creates an image file of sizeBytes. A sparse image only
+//allocates blocks as they are written while a preallocated one reserves them
+//with fallocate. An existing image of the same size is left as it is.
+//Returns true if the image was created.
+func (l *Loop) CreateImage(path string, sizeBytes uint64, preallocate bool) (bool, error) {
+	log.Debugln("Loop::CreateImage ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("sizeBytes:", sizeBytes)
+	log.Debugln("preallocate:", preallocate)
+
+	info, err := os.Stat(path)
+	if err == nil {
+		if !info.Mode().IsRegular() || uint64(info.Size()) != sizeBytes {
+			log.Debugln("Image exists with size:", info.Size())
+			log.Debugln("Loop::CreateImage LEAVE")
+			return false, ErrImageExists
+		}
+		log.Debugln("Image already exists")
+		log.Debugln("Loop::CreateImage LEAVE")
+		return false, nil
+	}
+
+	err = l.fs.JournalSnapshot(path)
+	if err != nil {
+		log.Debugln("JournalSnapshot Failed:", err)
+		log.Debugln("Loop::CreateImage LEAVE")
+		return false, err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Debugln("OpenFile Failed:", err)
+		log.Debugln("Loop::CreateImage LEAVE")
+		return false, err
+	}
+
+	if preallocate {
+		err = fallocate(file, int64(sizeBytes))
+	} else {
+		err = file.Truncate(int64(sizeBytes))
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(path)
+		log.Debugln("Allocate Failed:", err)
+		log.Debugln("Loop::CreateImage LEAVE")
+		return false, err
+	}
+
+	log.Debugln("Loop::CreateImage LEAVE")
+	return true, nil
+}
+
+//GetDevices returns the attached loop devices
+func (l *Loop) GetDevices() ([]*Device, error) {
+	log.Debugln("Loop::GetDevices ENTER")
+
+	blockDir := filepath.Join(l.sysfsRoot, "block")
+	entries, err := ioutil.ReadDir(blockDir)
+	if err != nil {
+		log.Debugln("ReadDir Failed:", err)
+		log.Debugln("Loop::GetDevices LEAVE")
+		return nil, err
+	}
+
+	list := []*Device{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "loop") {
+			continue
+		}
+		loopDir := filepath.Join(blockDir, name, "loop")
+		backing := readSysfsValue(filepath.Join(loopDir, "backing_file"))
+		if len(backing) == 0 {
+			continue
+		}
+		offset, _ := strconv.ParseUint(readSysfsValue(filepath.Join(loopDir, "offset")), 10, 64)
+		sizeLimit, _ := strconv.ParseUint(readSysfsValue(filepath.Join(loopDir, "sizelimit")), 10, 64)
+		list = append(list, &Device{
+			Device:      "/dev/" + name,
+			BackingFile: backing,
+			Offset:      offset,
+			SizeLimit:   sizeLimit,
+			ReadOnly:    readSysfsValue(filepath.Join(blockDir, name, "ro")) == "1",
+			AutoClear:   readSysfsValue(filepath.Join(loopDir, "autoclear")) == "1",
+		})
+	}
+	sort.Sort(byDevice(list))
+
+	log.Debugln("GetDevices Count:", len(list))
+	log.Debugln("Loop::GetDevices LEAVE")
+	return list, nil
+}
+
+type byDevice []*Device
+
+func (a byDevice) Len() int      { return len(a) }
+func (a byDevice) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byDevice) Less(i, j int) bool {
+	ni, _ := strconv.Atoi(strings.TrimPrefix(a[i].Device, "/dev/loop"))
+	nj, _ := strconv.Atoi(strings.TrimPrefix(a[j].Device, "/dev/loop"))
+	return ni < nj
+}
+
+//FindByFile returns the loop devices backed by the image file
+func (l *Loop) FindByFile(path string) ([]*Device, error) {
+	log.Debugln("Loop::FindByFile ENTER")
+	log.Debugln("path:", path)
+
+	abs, err := absPath(path)
+	if err != nil {
+		log.Debugln("absPath Failed:", err)
+		log.Debugln("Loop::FindByFile LEAVE")
+		return nil, err
+	}
+
+	devices, err := l.GetDevices()
+	if err != nil {
+		log.Debugln("GetDevices Failed:", err)
+		log.Debugln("Loop::FindByFile LEAVE")
+		return nil, err
+	}
+
+	list := []*Device{}
+	for _, dev := range devices {
+		if strings.TrimSuffix(dev.BackingFile, deletedSuffix) == abs {
+			list = append(list, dev)
+		}
+	}
+
+	log.Debugln("FindByFile Count:", len(list))
+	log.Debugln("Loop::FindByFile LEAVE")
+	return list, nil
+}
+
+//Attach attaches the image file to the first free loop device and returns
+//the device path. A nil opts attaches the whole file read-write.
+func (l *Loop) Attach(path string, opts *AttachOptions) (string, error) {
+	log.Debugln("Loop::Attach ENTER")
+	log.Debugln("path:", path)
+
+	abs, err := absPath(path)
+	if err != nil {
+		log.Debugln("absPath Failed:", err)
+		log.Debugln("Loop::Attach LEAVE")
+		return "", err
+	}
+	if opts == nil {
+		opts = &AttachOptions{}
+	}
+
+	cmdLine := "losetup --find --show"
+	if opts.Offset > 0 {
+		cmdLine += " --offset " + strconv.FormatUint(opts.Offset, 10)
+	}
+	if opts.SizeLimit > 0 {
+		cmdLine += " --sizelimit " + strconv.FormatUint(opts.SizeLimit, 10)
+	}
+	if opts.ReadOnly {
+		cmdLine += " --read-only"
+	}
+	if opts.PartScan {
+		cmdLine += " --partscan"
+	}
+	cmdLine += " " + abs
+
+	output, status, err := l.run.CommandOutputStatus(cmdLine)
+	if err == nil && (status != 0 || !deviceRegex.MatchString(output)) {
+		log.Errorln("losetup failed:", output)
+		err = ErrLosetupFailed
+	}
+	if err != nil {
+		log.Debugln("losetup Failed:", err)
+		log.Debugln("Loop::Attach LEAVE")
+		return "", err
+	}
+
+	log.Debugln("Attach =", output)
+	log.Debugln("Loop::Attach LEAVE")
+	return output, nil
+}
+
+//Detach detaches the loop device. Detaching a device that is not attached
+//succeeds.
+func (l *Loop) Detach(device string) error {
+	log.Debugln("Loop::Detach ENTER")
+	log.Debugln("device:", device)
+
+	if !deviceRegex.MatchString(device) {
+		log.Debugln("Invalid device")
+		log.Debugln("Loop::Detach LEAVE")
+		return ErrInvalidPath
+	}
+
+	backing := readSysfsValue(filepath.Join(l.sysfsRoot, "block", filepath.Base(device), "loop", "backing_file"))
+	if len(backing) == 0 {
+		log.Debugln("Device is not attached")
+		log.Debugln("Loop::Detach LEAVE")
+		return nil
+	}
+
+	output, status, err := l.run.CommandOutputStatus("losetup --detach " + device)
+	if err == nil && status != 0 {
+		log.Errorln("losetup failed:", output)
+		err = ErrLosetupFailed
+	}
+	if err != nil {
+		log.Debugln("losetup Failed:", err)
+		log.Debugln("Loop::Detach LEAVE")
+		return err
+	}
+
+	log.Debugln("Loop::Detach LEAVE")
+	return nil
+}
+
+//DetachFile detaches every loop device backed by the image file
+func (l *Loop) DetachFile(path string) error {
+	devices, err := l.FindByFile(path)
+	if err != nil {
+		return err
+	}
+	for _, dev := range devices {
+		err = l.Detach(dev.Device)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Session tracks the images and loop devices created through it so they can
+//be released with a single deferred Cleanup call
+type Session struct {
+	loop    *Loop
+	mutex   sync.Mutex
+	devices []string
+	images  []string
+}
+
+//NewSession generates a Session that creates and attaches through this Loop
+func (l *Loop) NewSession() *Session {
+	mySession := &Session{
+		loop: l,
+	}
+	return mySession
+}
+
+//CreateImage creates the image and registers it for removal
+func (s *Session) CreateImage(path string, sizeBytes uint64, preallocate bool) error {
+	created, err := s.loop.CreateImage(path, sizeBytes, preallocate)
+	if err != nil {
+		return err
+	}
+	if created {
+		s.mutex.Lock()
+		s.images = append(s.images, path)
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+//Attach attaches the image and registers the device for detach
+func (s *Session) Attach(path string, opts *AttachOptions) (string, error) {
+	device, err := s.loop.Attach(path, opts)
+	if err != nil {
+		return "", err
+	}
+	s.mutex.Lock()
+	s.devices = append(s.devices, device)
+	s.mutex.Unlock()
+	return device, nil
+}
+
+//Cleanup detaches the registered devices, newest first, then removes the
+//registered images. Every item is attempted and the first error is returned.
+func (s *Session) Cleanup() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var first error
+	for i := len(s.devices) - 1; i >= 0; i-- {
+		if err := s.loop.Detach(s.devices[i]); err != nil {
+			log.Warnln("Detach failed:", s.devices[i], "Err:", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	for i := len(s.images) - 1; i >= 0; i-- {
+		if err := os.Remove(s.images[i]); err != nil && !os.IsNotExist(err) {
+			log.Warnln("Remove failed:", s.images[i], "Err:", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	s.devices = nil
+	s.images = nil
+	return first
+}
@@ -0,0 +1,13 @@
+package loop
+
+import (
+	"os"
+	"syscall"
+)
+
+func fallocate(file *os.File, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	return syscall.Fallocate(int(file.Fd()), 0, 0, size)
+}
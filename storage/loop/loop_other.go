@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package loop
+
+import (
+	"os"
+
+	common "github.com/dvonthenen/goxplatform/common"
+)
+
+func fallocate(file *os.File, size int64) error {
+	return common.ErrNotImplemented
+}
@@ -0,0 +1,134 @@
+package loop
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+func newTestLoop(t *testing.T) (*Loop, *fake.Executor, string) {
+	dir, err := ioutil.TempDir("", "loop")
+	assert.Equal(t, nil, err)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	executor := fake.NewExecutor()
+	loop := NewLoopWithExecutor(executor)
+	loop.sysfsRoot = filepath.Join(dir, "sys")
+	os.MkdirAll(filepath.Join(loop.sysfsRoot, "block", "sda"), 0755)
+	return loop, executor, dir
+}
+
+func attachFake(loop *Loop, name string, backing string, offset string, ro string) {
+	loopDir := filepath.Join(loop.sysfsRoot, "block", name, "loop")
+	os.MkdirAll(loopDir, 0755)
+	ioutil.WriteFile(filepath.Join(loopDir, "backing_file"), []byte(backing+"\n"), 0644)
+	ioutil.WriteFile(filepath.Join(loopDir, "offset"), []byte(offset+"\n"), 0644)
+	ioutil.WriteFile(filepath.Join(loopDir, "sizelimit"), []byte("0\n"), 0644)
+	ioutil.WriteFile(filepath.Join(loopDir, "autoclear"), []byte("0\n"), 0644)
+	ioutil.WriteFile(filepath.Join(loop.sysfsRoot, "block", name, "ro"), []byte(ro+"\n"), 0644)
+}
+
+func TestCreateImage(t *testing.T) {
+	loop, _, dir := newTestLoop(t)
+	defer os.RemoveAll(dir)
+
+	sparse := filepath.Join(dir, "sparse.img")
+	created, err := loop.CreateImage(sparse, 64*1024*1024, false)
+	assert.Equal(t, nil, err)
+	assert.True(t, created)
+
+	created, err = loop.CreateImage(sparse, 64*1024*1024, false)
+	assert.Equal(t, nil, err)
+	assert.False(t, created)
+	_, err = loop.CreateImage(sparse, 1024, false)
+	assert.Equal(t, ErrImageExists, err)
+
+	full := filepath.Join(dir, "full.img")
+	created, err = loop.CreateImage(full, 1024*1024, true)
+	assert.Equal(t, nil, err)
+	assert.True(t, created)
+
+	info, _ := os.Stat(full)
+	assert.Equal(t, int64(1024*1024), info.Size())
+}
+
+func TestAttachFindDetach(t *testing.T) {
+	loop, executor, dir := newTestLoop(t)
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "disk.img")
+	loop.CreateImage(image, 1024*1024, false)
+
+	executor.On("^losetup --find --show ", "/dev/loop3", 0)
+	executor.On("^losetup --detach ", "", 0)
+
+	device, err := loop.Attach(image, &AttachOptions{Offset: 1048576, ReadOnly: true, PartScan: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/dev/loop3", device)
+	assert.True(t, executor.Ran("^losetup --find --show --offset 1048576 --read-only --partscan "+regexp.QuoteMeta(image)+"$"))
+
+	attachFake(loop, "loop3", image, "1048576", "1")
+	attachFake(loop, "loop10", "/var/lib/other.img (deleted)", "0", "0")
+	attachFake(loop, "loop1", image+" (deleted)", "0", "0")
+
+	devices, err := loop.GetDevices()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(devices))
+	assert.Equal(t, "/dev/loop10", devices[2].Device)
+
+	found, err := loop.FindByFile(image)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(found))
+	assert.Equal(t, "/dev/loop1", found[0].Device)
+	assert.Equal(t, uint64(1048576), found[1].Offset)
+	assert.True(t, found[1].ReadOnly)
+
+	assert.Equal(t, nil, loop.Detach("/dev/loop3"))
+	assert.Equal(t, nil, loop.Detach("/dev/loop7"))
+	assert.False(t, executor.Ran("--detach /dev/loop7"))
+	assert.Equal(t, ErrInvalidPath, loop.Detach("/dev/sda"))
+
+	_, err = loop.Attach(filepath.Join(dir, "my disk.img"), nil)
+	assert.Equal(t, ErrInvalidPath, err)
+
+	evil := filepath.Join(dir, "x;reboot.img")
+	loop.CreateImage(evil, 1024*1024, false)
+	link := filepath.Join(dir, "link.img")
+	os.Symlink(evil, link)
+	_, err = loop.Attach(link, nil)
+	assert.Equal(t, ErrInvalidPath, err)
+	assert.False(t, executor.Ran("reboot"))
+}
+
+func TestSessionCleanup(t *testing.T) {
+	loop, executor, dir := newTestLoop(t)
+	defer os.RemoveAll(dir)
+
+	executor.On("^losetup --find --show ", "/dev/loop0", 0)
+	executor.On("^losetup --detach ", "", 0)
+
+	image := filepath.Join(dir, "scratch.img")
+	session := loop.NewSession()
+	assert.Equal(t, nil, session.CreateImage(image, 1024*1024, false))
+	device, err := session.Attach(image, nil)
+	assert.Equal(t, nil, err)
+	attachFake(loop, "loop0", image, "0", "0")
+
+	assert.Equal(t, nil, session.Cleanup())
+	assert.True(t, executor.Ran("^losetup --detach "+device+"$"))
+	_, err = os.Stat(image)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,184 @@
+package luks
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+)
+
+//CrypttabEntry is a line in /etc/crypttab
+type CrypttabEntry struct {
+	Name    string
+	Device  string
+	KeyFile string
+	Options string
+}
+
+//String returns the entry formatted as a crypttab line
+func (ce *CrypttabEntry) String() string {
+	keyFile := ce.KeyFile
+	if len(keyFile) == 0 {
+		keyFile = "none"
+	}
+	line := ce.Name + "\t" + ce.Device + "\t" + keyFile
+	if len(ce.Options) > 0 {
+		line += "\t" + ce.Options
+	}
+	return line
+}
+
+func parseCrypttabLine(line string) *CrypttabEntry {
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] == '#' {
+		return nil
+	}
+
+	fields := strings.Fields(trimmed)
+	if len(fields) < 2 {
+		return nil
+	}
+
+	entry := &CrypttabEntry{
+		Name:   fields[0],
+		Device: fields[1],
+	}
+	if len(fields) > 2 && fields[2] != "none" && fields[2] != "-" {
+		entry.KeyFile = fields[2]
+	}
+	if len(fields) > 3 {
+		entry.Options = fields[3]
+	}
+	return entry
+}
+
+func readCrypttab(path string) ([]*CrypttabEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []*CrypttabEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := []*CrypttabEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if entry := parseCrypttabLine(scanner.Text()); entry != nil {
+			list = append(list, entry)
+		}
+	}
+	return list, scanner.Err()
+}
+
+//mergeCrypttab replaces the line with the same name as entry or appends it.
+//When remove is true the lines with that name are dropped instead.
+func mergeCrypttab(path string, entry *CrypttabEntry, remove bool) (bool, error) {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	written := remove
+	var buffer bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(existing))
+	for scanner.Scan() {
+		line := scanner.Text()
+		current := parseCrypttabLine(line)
+		if current == nil || current.Name != entry.Name {
+			buffer.WriteString(line + "\n")
+			continue
+		}
+		if written {
+			continue
+		}
+		if current.String() == entry.String() {
+			buffer.WriteString(line + "\n")
+		} else {
+			buffer.WriteString(entry.String() + "\n")
+		}
+		written = true
+	}
+	if !written {
+		buffer.WriteString(entry.String() + "\n")
+	}
+
+	if bytes.Equal(existing, buffer.Bytes()) {
+		return false, nil
+	}
+
+	err = fs.NewFs().WriteFileAtomic(path, buffer.Bytes(), 0600)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+//GetCrypttabEntries returns the entries in /etc/crypttab
+func (l *Luks) GetCrypttabEntries() ([]*CrypttabEntry, error) {
+	return readCrypttab(l.crypttabFile)
+}
+
+//EnsureCrypttabEntry adds the entry to /etc/crypttab or updates the entry
+//with the same name. Returns true if the file changed.
+func (l *Luks) EnsureCrypttabEntry(entry *CrypttabEntry) (bool, error) {
+	log.Debugln("Luks::EnsureCrypttabEntry ENTER")
+	log.Debugln("entry:", entry.String())
+
+	if !nameRegex.MatchString(entry.Name) || len(entry.Device) == 0 {
+		log.Debugln("Invalid entry")
+		log.Debugln("Luks::EnsureCrypttabEntry LEAVE")
+		return false, ErrInvalidName
+	}
+
+	lock, err := l.fs.Lock("crypttab", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("Luks::EnsureCrypttabEntry LEAVE")
+		return false, err
+	}
+	defer lock.Unlock()
+
+	changed, err := mergeCrypttab(l.crypttabFile, entry, false)
+	if err != nil {
+		log.Debugln("mergeCrypttab Failed:", err)
+		log.Debugln("Luks::EnsureCrypttabEntry LEAVE")
+		return false, err
+	}
+
+	log.Debugln("EnsureCrypttabEntry changed:", changed)
+	log.Debugln("Luks::EnsureCrypttabEntry LEAVE")
+	return changed, nil
+}
+
+//RemoveCrypttabEntry removes the entry for the mapping name from
+///etc/crypttab. Returns true if the file changed.
+func (l *Luks) RemoveCrypttabEntry(name string) (bool, error) {
+	log.Debugln("Luks::RemoveCrypttabEntry ENTER")
+	log.Debugln("name:", name)
+
+	lock, err := l.fs.Lock("crypttab", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("Luks::RemoveCrypttabEntry LEAVE")
+		return false, err
+	}
+	defer lock.Unlock()
+
+	changed, err := mergeCrypttab(l.crypttabFile, &CrypttabEntry{Name: name}, true)
+	if err != nil {
+		log.Debugln("mergeCrypttab Failed:", err)
+		log.Debugln("Luks::RemoveCrypttabEntry LEAVE")
+		return false, err
+	}
+
+	log.Debugln("RemoveCrypttabEntry changed:", changed)
+	log.Debugln("Luks::RemoveCrypttabEntry LEAVE")
+	return changed, nil
+}
@@ -0,0 +1,580 @@
+package luks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+	filesystem "github.com/dvonthenen/goxplatform/storage/filesystem"
+)
+
+const (
+	defaultMapperDir    = "/dev/mapper"
+	defaultCrypttabFile = "/etc/crypttab"
+
+	isLuksNo      = 1
+	blkidNotFound = 2
+)
+
+var (
+	//ErrInvalidName the mapping name or device path is invalid
+	ErrInvalidName = errors.New("Invalid LUKS mapping name or device")
+
+	//ErrNoKey neither a key file nor a passphrase was given
+	ErrNoKey = errors.New("A key file or passphrase is required")
+
+	//ErrAlreadyLuks the device is already formatted as LUKS
+	ErrAlreadyLuks = errors.New("Device is already a LUKS device")
+
+	//ErrNotLuks the device is not a LUKS device
+	ErrNotLuks = errors.New("Device is not a LUKS device")
+
+	//ErrCryptsetupFailed the cryptsetup command failed
+	ErrCryptsetupFailed = errors.New("cryptsetup failed")
+
+	//ErrDeviceNotEmpty the device holds a filesystem, partition table or other
+	//signature and formatting was not forced
+	ErrDeviceNotEmpty = errors.New("Device is not empty")
+
+	//ErrMappingInUse the mapping name is already used for a different device
+	ErrMappingInUse = errors.New("Mapping is in use by another device")
+
+	nameRegex = regexp.MustCompile("^[a-zA-Z0-9_.\\-]+$")
+	pathRegex = regexp.MustCompile("^/[a-zA-Z0-9/_.:+@,=\\-]*$")
+)
+
+//Key unlocks a LUKS key slot. KeyFile takes precedence over Passphrase.
+type Key struct {
+	KeyFile    string
+	Passphrase string
+}
+
+//Volume describes an encrypted volume brought up by EnsureVolume
+type Volume struct {
+	Device string
+	Name   string
+	Key    *Key
+
+	//FsType, when set, creates the filesystem on the mapping if it has none
+	FsType string
+	Label  string
+
+	//MountPoint, when set, mounts the mapping
+	MountPoint   string
+	MountOptions string
+
+	//Persist adds the volume to crypttab and, with a MountPoint, to fstab
+	Persist bool
+
+	//Force formats the device even if it is not empty
+	Force bool
+}
+
+//Luks manages LUKS encrypted devices with cryptsetup
+type Luks struct {
+	run          common.IExecutor
+	filesystem   *filesystem.Filesystem
+	mapperDir    string
+	crypttabFile string
+	fs           *fs.Fs
+
+	ensureFstabEntry func(entry *fs.FstabEntry) (bool, error)
+}
+
+//NewLuks generates a Luks object
+func NewLuks() *Luks {
+	return NewLuksWithExecutor(run.NewRun())
+}
+
+//NewLuksWithExecutor generates a Luks object that runs cryptsetup through
+//the given executor
+func NewLuksWithExecutor(executor common.IExecutor) *Luks {
+	myFs := fs.NewFs()
+	myLuks := &Luks{
+		run:              executor,
+		filesystem:       filesystem.NewFilesystemWithExecutor(executor),
+		mapperDir:        defaultMapperDir,
+		crypttabFile:     defaultCrypttabFile,
+		fs:               myFs,
+		ensureFstabEntry: myFs.EnsureFstabEntry,
+	}
+	return myLuks
+}
+
+func validatePaths(paths ...string) error {
+	for _, path := range paths {
+		if !pathRegex.MatchString(path) {
+			return ErrInvalidName
+		}
+	}
+	return nil
+}
+
+//keyFile returns a key file for key. A passphrase is written without a
+//trailing newline to a private temporary file so it never appears on the
+//command line. The returned function removes that file.
+func (l *Luks) keyFile(key *Key) (string, func(), error) {
+	if key == nil || (len(key.KeyFile) == 0 && len(key.Passphrase) == 0) {
+		return "", func() {}, ErrNoKey
+	}
+	if len(key.KeyFile) > 0 {
+		if err := validatePaths(key.KeyFile); err != nil {
+			return "", func() {}, err
+		}
+		return key.KeyFile, func() {}, nil
+	}
+
+	scope := l.fs.NewTempScope()
+	file, err := scope.TempFile("luks")
+	if err != nil {
+		return "", func() {}, err
+	}
+	cleanup := func() {
+		scope.Cleanup()
+	}
+	_, err = file.WriteString(key.Passphrase)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+	return file.Name(), cleanup, nil
+}
+
+func (l *Luks) cryptsetup(args string) (string, error) {
+	output, status, err := l.run.CommandOutputStatus("cryptsetup " + args)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		log.Errorln("cryptsetup failed:", args, "Output:", output)
+		return output, ErrCryptsetupFailed
+	}
+	return output, nil
+}
+
+//MapperPath returns the /dev/mapper path of the mapping name
+func (l *Luks) MapperPath(name string) string {
+	return filepath.Join(l.mapperDir, name)
+}
+
+//IsLuks returns true if device contains a LUKS header
+func (l *Luks) IsLuks(device string) (bool, error) {
+	log.Debugln("Luks::IsLuks ENTER")
+	log.Debugln("device:", device)
+
+	if err := validatePaths(device); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Luks::IsLuks LEAVE")
+		return false, err
+	}
+
+	output, status, err := l.run.CommandOutputStatus("cryptsetup isLuks " + device)
+	if err != nil {
+		log.Debugln("cryptsetup Failed:", err)
+		log.Debugln("Luks::IsLuks LEAVE")
+		return false, err
+	}
+	if status != 0 && status != isLuksNo {
+		log.Errorln("cryptsetup isLuks failed:", output)
+		log.Debugln("Luks::IsLuks LEAVE")
+		return false, ErrCryptsetupFailed
+	}
+
+	log.Debugln("IsLuks =", status == 0)
+	log.Debugln("Luks::IsLuks LEAVE")
+	return status == 0, nil
+}
+
+//GetUUID returns the UUID of the LUKS header on device
+func (l *Luks) GetUUID(device string) (string, error) {
+	if err := validatePaths(device); err != nil {
+		return "", err
+	}
+	return l.cryptsetup("luksUUID " + device)
+}
+
+//hasSignature returns true if blkid finds a filesystem, partition table or
+//any other signature on device
+func (l *Luks) hasSignature(device string) (bool, error) {
+	output, status, err := l.run.CommandOutputStatus("blkid -p -o value -s TYPE -s PTTYPE " + device)
+	if err != nil {
+		return false, err
+	}
+	if status == blkidNotFound {
+		return false, nil
+	}
+	if status != 0 {
+		log.Errorln("blkid failed:", output)
+		return false, filesystem.ErrProbeFailed
+	}
+	return len(strings.TrimSpace(output)) > 0, nil
+}
+
+//backingDevice returns the device behind the active mapping name
+func (l *Luks) backingDevice(name string) (string, error) {
+	output, err := l.cryptsetup("status " + name)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "device:" {
+			return fields[1], nil
+		}
+	}
+	return "", ErrCryptsetupFailed
+}
+
+//sameDevice compares device paths after resolving symlinks such as
+///dev/disk/by-uuid
+func sameDevice(a string, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	return a == b
+}
+
+//Format formats device as LUKS2. It refuses to format a device that is
+//already LUKS and, unless force is set, one that holds a filesystem,
+//partition table or other signature so existing data is never destroyed.
+func (l *Luks) Format(device string, key *Key, force bool) error {
+	log.Debugln("Luks::Format ENTER")
+	log.Debugln("device:", device)
+	log.Debugln("force:", force)
+
+	isLuks, err := l.IsLuks(device)
+	if err != nil {
+		log.Debugln("IsLuks Failed:", err)
+		log.Debugln("Luks::Format LEAVE")
+		return err
+	}
+	if isLuks {
+		log.Debugln("Device is already LUKS")
+		log.Debugln("Luks::Format LEAVE")
+		return ErrAlreadyLuks
+	}
+
+	if !force {
+		inUse, errProbe := l.hasSignature(device)
+		if errProbe != nil {
+			log.Debugln("hasSignature Failed:", errProbe)
+			log.Debugln("Luks::Format LEAVE")
+			return errProbe
+		}
+		if inUse {
+			log.Errorln("Device", device, "is not empty")
+			log.Debugln("Luks::Format LEAVE")
+			return ErrDeviceNotEmpty
+		}
+	}
+
+	keyFile, cleanup, err := l.keyFile(key)
+	if err != nil {
+		log.Debugln("keyFile Failed:", err)
+		log.Debugln("Luks::Format LEAVE")
+		return err
+	}
+	defer cleanup()
+
+	_, err = l.cryptsetup("luksFormat --type luks2 --batch-mode --key-file " + keyFile + " " + device)
+	if err != nil {
+		log.Debugln("luksFormat Failed:", err)
+		log.Debugln("Luks::Format LEAVE")
+		return err
+	}
+
+	log.Debugln("Luks::Format LEAVE")
+	return nil
+}
+
+//Open unlocks device as /dev/mapper/name and returns the mapper path. Opening
+//a mapping that already exists for device succeeds without unlocking it
+//again. Returns ErrMappingInUse if the name is mapped to another device.
+func (l *Luks) Open(device string, name string, key *Key) (string, error) {
+	log.Debugln("Luks::Open ENTER")
+	log.Debugln("device:", device)
+	log.Debugln("name:", name)
+
+	if !nameRegex.MatchString(name) {
+		log.Debugln("Invalid name")
+		log.Debugln("Luks::Open LEAVE")
+		return "", ErrInvalidName
+	}
+	if err := validatePaths(device); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Luks::Open LEAVE")
+		return "", err
+	}
+
+	mapper := l.MapperPath(name)
+	if _, err := os.Stat(mapper); err == nil {
+		backing, errStatus := l.backingDevice(name)
+		if errStatus != nil {
+			log.Debugln("backingDevice Failed:", errStatus)
+			log.Debugln("Luks::Open LEAVE")
+			return "", errStatus
+		}
+		if !sameDevice(backing, device) {
+			log.Errorln("Mapping", name, "is already open on", backing)
+			log.Debugln("Luks::Open LEAVE")
+			return "", ErrMappingInUse
+		}
+		log.Debugln("Mapping already exists")
+		log.Debugln("Luks::Open LEAVE")
+		return mapper, nil
+	}
+
+	keyFile, cleanup, err := l.keyFile(key)
+	if err != nil {
+		log.Debugln("keyFile Failed:", err)
+		log.Debugln("Luks::Open LEAVE")
+		return "", err
+	}
+	defer cleanup()
+
+	_, err = l.cryptsetup("open --type luks --key-file " + keyFile + " " + device + " " + name)
+	if err != nil {
+		log.Debugln("open Failed:", err)
+		log.Debugln("Luks::Open LEAVE")
+		return "", err
+	}
+
+	log.Debugln("Open =", mapper)
+	log.Debugln("Luks::Open LEAVE")
+	return mapper, nil
+}
+
+//Close removes the /dev/mapper/name mapping if it exists
+func (l *Luks) Close(name string) error {
+	log.Debugln("Luks::Close ENTER")
+	log.Debugln("name:", name)
+
+	if !nameRegex.MatchString(name) {
+		log.Debugln("Invalid name")
+		log.Debugln("Luks::Close LEAVE")
+		return ErrInvalidName
+	}
+	if _, err := os.Stat(l.MapperPath(name)); os.IsNotExist(err) {
+		log.Debugln("Mapping does not exist")
+		log.Debugln("Luks::Close LEAVE")
+		return nil
+	}
+
+	_, err := l.cryptsetup("close " + name)
+	if err != nil {
+		log.Debugln("close Failed:", err)
+		log.Debugln("Luks::Close LEAVE")
+		return err
+	}
+
+	log.Debugln("Luks::Close LEAVE")
+	return nil
+}
+
+//AddKey adds newKey to a free key slot on device, unlocking it with key
+func (l *Luks) AddKey(device string, key *Key, newKey *Key) error {
+	log.Debugln("Luks::AddKey ENTER")
+	log.Debugln("device:", device)
+
+	if err := validatePaths(device); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Luks::AddKey LEAVE")
+		return err
+	}
+
+	keyFile, cleanup, err := l.keyFile(key)
+	if err != nil {
+		log.Debugln("keyFile Failed:", err)
+		log.Debugln("Luks::AddKey LEAVE")
+		return err
+	}
+	defer cleanup()
+
+	newKeyFile, newCleanup, err := l.keyFile(newKey)
+	if err != nil {
+		log.Debugln("keyFile Failed:", err)
+		log.Debugln("Luks::AddKey LEAVE")
+		return err
+	}
+	defer newCleanup()
+
+	_, err = l.cryptsetup("luksAddKey --batch-mode --key-file " + keyFile + " " + device + " " + newKeyFile)
+	if err != nil {
+		log.Debugln("luksAddKey Failed:", err)
+		log.Debugln("Luks::AddKey LEAVE")
+		return err
+	}
+
+	log.Debugln("Luks::AddKey LEAVE")
+	return nil
+}
+
+//RemoveKey removes the key slot that key unlocks
+func (l *Luks) RemoveKey(device string, key *Key) error {
+	log.Debugln("Luks::RemoveKey ENTER")
+	log.Debugln("device:", device)
+
+	if err := validatePaths(device); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Luks::RemoveKey LEAVE")
+		return err
+	}
+
+	keyFile, cleanup, err := l.keyFile(key)
+	if err != nil {
+		log.Debugln("keyFile Failed:", err)
+		log.Debugln("Luks::RemoveKey LEAVE")
+		return err
+	}
+	defer cleanup()
+
+	_, err = l.cryptsetup("luksRemoveKey --batch-mode --key-file " + keyFile + " " + device)
+	if err != nil {
+		log.Debugln("luksRemoveKey Failed:", err)
+		log.Debugln("Luks::RemoveKey LEAVE")
+		return err
+	}
+
+	log.Debugln("Luks::RemoveKey LEAVE")
+	return nil
+}
+
+//KillSlot wipes key slot, unlocking the device with key from another slot
+func (l *Luks) KillSlot(device string, slot int, key *Key) error {
+	log.Debugln("Luks::KillSlot ENTER")
+	log.Debugln("device:", device)
+	log.Debugln("slot:", slot)
+
+	if err := validatePaths(device); err != nil || slot < 0 {
+		log.Debugln("Invalid device or slot")
+		log.Debugln("Luks::KillSlot LEAVE")
+		return ErrInvalidName
+	}
+
+	keyFile, cleanup, err := l.keyFile(key)
+	if err != nil {
+		log.Debugln("keyFile Failed:", err)
+		log.Debugln("Luks::KillSlot LEAVE")
+		return err
+	}
+	defer cleanup()
+
+	_, err = l.cryptsetup("luksKillSlot --batch-mode --key-file " + keyFile + " " + device + " " + strconv.Itoa(slot))
+	if err != nil {
+		log.Debugln("luksKillSlot Failed:", err)
+		log.Debugln("Luks::KillSlot LEAVE")
+		return err
+	}
+
+	log.Debugln("Luks::KillSlot LEAVE")
+	return nil
+}
+
+//EnsureVolume brings up an encrypted volume in one call. A device that is
+//not LUKS yet is formatted first. Formatting a device that holds data needs
+//Force. The volume is then opened, given a filesystem and mounted as
+//requested, and persisted in crypttab and fstab. Returns the mapper path.
+func (l *Luks) EnsureVolume(vol *Volume) (string, error) {
+	log.Debugln("Luks::EnsureVolume ENTER")
+	log.Debugln("device:", vol.Device)
+	log.Debugln("name:", vol.Name)
+
+	isLuks, err := l.IsLuks(vol.Device)
+	if err == nil && !isLuks {
+		err = l.Format(vol.Device, vol.Key, vol.Force)
+	}
+	if err != nil {
+		log.Debugln("Format Failed:", err)
+		log.Debugln("Luks::EnsureVolume LEAVE")
+		return "", err
+	}
+
+	mapper, err := l.Open(vol.Device, vol.Name, vol.Key)
+	if err != nil {
+		log.Debugln("Open Failed:", err)
+		log.Debugln("Luks::EnsureVolume LEAVE")
+		return "", err
+	}
+
+	if len(vol.FsType) > 0 {
+		_, err = l.filesystem.MakeFilesystem(mapper, vol.FsType, vol.Label)
+		if err != nil {
+			log.Debugln("MakeFilesystem Failed:", err)
+			log.Debugln("Luks::EnsureVolume LEAVE")
+			return "", err
+		}
+	}
+
+	if len(vol.MountPoint) > 0 {
+		_, err = l.filesystem.Mount(mapper, vol.MountPoint, vol.FsType, vol.MountOptions)
+		if err != nil {
+			log.Debugln("Mount Failed:", err)
+			log.Debugln("Luks::EnsureVolume LEAVE")
+			return "", err
+		}
+	}
+
+	if vol.Persist {
+		err = l.persistVolume(vol, mapper)
+		if err != nil {
+			log.Debugln("persistVolume Failed:", err)
+			log.Debugln("Luks::EnsureVolume LEAVE")
+			return "", err
+		}
+	}
+
+	log.Debugln("EnsureVolume =", mapper)
+	log.Debugln("Luks::EnsureVolume LEAVE")
+	return mapper, nil
+}
+
+func (l *Luks) persistVolume(vol *Volume, mapper string) error {
+	uuid, err := l.GetUUID(vol.Device)
+	if err != nil {
+		return err
+	}
+
+	entry := &CrypttabEntry{
+		Name:    vol.Name,
+		Device:  "UUID=" + uuid,
+		Options: "luks",
+	}
+	if vol.Key != nil && len(vol.Key.KeyFile) > 0 {
+		entry.KeyFile = vol.Key.KeyFile
+	}
+	lock, err := l.fs.Lock("crypttab", fs.DefaultLockTimeout)
+	if err != nil {
+		return err
+	}
+	_, err = mergeCrypttab(l.crypttabFile, entry, false)
+	lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if len(vol.MountPoint) == 0 || len(vol.FsType) == 0 {
+		return nil
+	}
+	_, err = l.ensureFstabEntry(&fs.FstabEntry{
+		Source:     mapper,
+		MountPoint: vol.MountPoint,
+		FsType:     vol.FsType,
+		Options:    vol.MountOptions,
+		Pass:       2,
+	})
+	return err
+}
@@ -0,0 +1,148 @@
+package luks
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+func newTestLuks(t *testing.T) (*Luks, *fake.Executor, string) {
+	dir, err := ioutil.TempDir("", "luks")
+	assert.Equal(t, nil, err)
+
+	executor := fake.NewExecutor()
+	luks := NewLuksWithExecutor(executor)
+	luks.mapperDir = filepath.Join(dir, "mapper")
+	luks.crypttabFile = filepath.Join(dir, "crypttab")
+	luks.fs.SetTempDir(dir)
+	luks.fs.SetLockDir(dir)
+	os.MkdirAll(luks.mapperDir, 0755)
+	return luks, executor, dir
+}
+
+func TestFormatAndOpen(t *testing.T) {
+	luks, executor, dir := newTestLuks(t)
+	defer os.RemoveAll(dir)
+
+	executor.On("^cryptsetup isLuks /dev/sdb$", "", 1)
+	executor.On("^cryptsetup isLuks /dev/sdc$", "", 0)
+	executor.On("^cryptsetup isLuks /dev/sdd$", "", 1)
+	executor.On("^cryptsetup luksFormat ", "", 0)
+	executor.On("^cryptsetup open ", "", 0)
+	executor.On("^blkid .* /dev/sdb$", "", 2)
+	executor.On("^blkid .* /dev/sdd$", "gpt", 0)
+
+	assert.Equal(t, ErrNoKey, luks.Format("/dev/sdb", &Key{}, false))
+	assert.Equal(t, nil, luks.Format("/dev/sdb", &Key{Passphrase: "secret"}, false))
+	assert.Equal(t, ErrAlreadyLuks, luks.Format("/dev/sdc", &Key{Passphrase: "secret"}, false))
+
+	//a device holding data is only formatted when forced
+	assert.Equal(t, ErrDeviceNotEmpty, luks.Format("/dev/sdd", &Key{Passphrase: "secret"}, false))
+	assert.False(t, executor.Ran("^cryptsetup luksFormat .* /dev/sdd$"))
+	assert.Equal(t, nil, luks.Format("/dev/sdd", &Key{Passphrase: "secret"}, true))
+	assert.True(t, executor.Ran("^cryptsetup luksFormat .* /dev/sdd$"))
+
+	//the passphrase is passed in a key file that is removed afterwards
+	assert.False(t, executor.Ran("secret"))
+	assert.True(t, executor.Ran("^cryptsetup luksFormat --type luks2 --batch-mode --key-file "+regexp.QuoteMeta(dir)+"/luks[0-9]+ /dev/sdb$"))
+	files, _ := filepath.Glob(filepath.Join(dir, "luks*"))
+	assert.Equal(t, 0, len(files))
+
+	mapper, err := luks.Open("/dev/sdc", "data", &Key{KeyFile: "/etc/keys/data.key"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(luks.mapperDir, "data"), mapper)
+	assert.True(t, executor.Ran("^cryptsetup open --type luks --key-file /etc/keys/data.key /dev/sdc data$"))
+
+	_, err = luks.Open("/dev/sdc", "data; reboot", &Key{KeyFile: "/etc/keys/data.key"})
+	assert.Equal(t, ErrInvalidName, err)
+
+	//an existing mapping is only reused for the same device
+	ioutil.WriteFile(mapper, []byte{}, 0644)
+	executor.On("^cryptsetup status data$", "/dev/mapper/data is active.\n  type:    LUKS2\n  device:  /dev/sdc\n", 0)
+	_, err = luks.Open("/dev/sdc", "data", &Key{KeyFile: "/etc/keys/data.key"})
+	assert.Equal(t, nil, err)
+	_, err = luks.Open("/dev/sdd", "data", &Key{KeyFile: "/etc/keys/data.key"})
+	assert.Equal(t, ErrMappingInUse, err)
+	assert.False(t, executor.Ran("^cryptsetup open .* /dev/sdd data$"))
+	os.Remove(mapper)
+
+	//closing a mapping that does not exist is a no-op
+	assert.Equal(t, nil, luks.Close("data"))
+	assert.False(t, executor.Ran("^cryptsetup close"))
+}
+
+func TestKeySlots(t *testing.T) {
+	luks, executor, dir := newTestLuks(t)
+	defer os.RemoveAll(dir)
+
+	executor.On("^cryptsetup luksAddKey ", "", 0)
+	executor.On("^cryptsetup luksKillSlot ", "No key available with this passphrase.", 2)
+
+	key := &Key{KeyFile: "/etc/keys/old.key"}
+	assert.Equal(t, nil, luks.AddKey("/dev/sdb", key, &Key{KeyFile: "/etc/keys/new.key"}))
+	assert.True(t, executor.Ran("^cryptsetup luksAddKey --batch-mode --key-file /etc/keys/old.key /dev/sdb /etc/keys/new.key$"))
+	assert.Equal(t, ErrCryptsetupFailed, luks.KillSlot("/dev/sdb", 1, key))
+}
+
+func TestEnsureVolume(t *testing.T) {
+	luks, executor, dir := newTestLuks(t)
+	defer os.RemoveAll(dir)
+
+	var fstab []*fs.FstabEntry
+	luks.ensureFstabEntry = func(entry *fs.FstabEntry) (bool, error) {
+		fstab = append(fstab, entry)
+		return true, nil
+	}
+
+	mountPoint := filepath.Join(dir, "mnt")
+	executor.SetInPath("mkfs.ext4", true)
+	executor.On("^cryptsetup isLuks ", "", 1)
+	executor.On("^cryptsetup luksFormat ", "", 0)
+	executor.On("^cryptsetup open ", "", 0)
+	executor.On("^cryptsetup luksUUID ", "4f2a1b3c-5d6e-4f70-8a9b-0c1d2e3f4a5b", 0)
+	executor.On("^blkid ", "", 2)
+	executor.On("^mkfs.ext4 ", "", 0)
+	executor.On("^mount ", "", 0)
+
+	mapper, err := luks.EnsureVolume(&Volume{
+		Device:     "/dev/sdb",
+		Name:       "secure",
+		Key:        &Key{KeyFile: "/etc/keys/secure.key"},
+		FsType:     "ext4",
+		MountPoint: mountPoint,
+		Persist:    true,
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(luks.mapperDir, "secure"), mapper)
+	assert.True(t, executor.Ran("^mkfs.ext4 "+regexp.QuoteMeta(mapper)+"$"))
+	assert.True(t, executor.Ran("^mount -t ext4 "+regexp.QuoteMeta(mapper+" "+mountPoint)+"$"))
+
+	entries, err := luks.GetCrypttabEntries()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "UUID=4f2a1b3c-5d6e-4f70-8a9b-0c1d2e3f4a5b", entries[0].Device)
+	assert.Equal(t, "/etc/keys/secure.key", entries[0].KeyFile)
+	assert.Equal(t, 1, len(fstab))
+	assert.Equal(t, mapper, fstab[0].Source)
+
+	changed, err := luks.EnsureCrypttabEntry(entries[0])
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+	changed, err = luks.RemoveCrypttabEntry("secure")
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+}
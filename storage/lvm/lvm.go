@@ -0,0 +1,728 @@
+package lvm
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+)
+
+const (
+	reportArgs = " --reportformat json --units b --nosuffix"
+
+	pvFields = "pv_name,vg_name,pv_size,pv_free,pv_uuid"
+	vgFields = "vg_name,vg_size,vg_free,vg_extent_size,pv_count,lv_count,vg_uuid"
+	lvFields = "lv_name,vg_name,lv_path,lv_size,lv_attr,lv_uuid,origin,pool_lv,segtype"
+)
+
+var (
+	//ErrInvalidName the volume or device name is invalid
+	ErrInvalidName = errors.New("Invalid LVM name")
+
+	//ErrNotFound the volume does not exist
+	ErrNotFound = errors.New("LVM volume not found")
+
+	//ErrInvalidReport the LVM report could not be parsed
+	ErrInvalidReport = errors.New("Unable to parse the LVM report")
+
+	//ErrLvmFailed the LVM command failed
+	ErrLvmFailed = errors.New("LVM command failed")
+
+	//ErrShrinkNeedsFs shrinking an LV without resizing its filesystem would
+	//cut off the end of the filesystem
+	ErrShrinkNeedsFs = errors.New("Shrinking a logical volume requires resizing the filesystem")
+
+	nameRegex   = regexp.MustCompile("^[a-zA-Z0-9+_.][a-zA-Z0-9+_.\\-]*$")
+	deviceRegex = regexp.MustCompile("^/dev/[a-zA-Z0-9/_.:+\\-]+$")
+)
+
+//PhysicalVolume is an LVM PV
+type PhysicalVolume struct {
+	Name      string
+	VGName    string
+	SizeBytes uint64
+	FreeBytes uint64
+	UUID      string
+}
+
+//VolumeGroup is an LVM VG
+type VolumeGroup struct {
+	Name            string
+	SizeBytes       uint64
+	FreeBytes       uint64
+	ExtentSizeBytes uint64
+	PVCount         int
+	LVCount         int
+	UUID            string
+}
+
+//LogicalVolume is an LVM LV
+type LogicalVolume struct {
+	Name      string
+	VGName    string
+	Path      string
+	SizeBytes uint64
+	Attr      string
+	UUID      string
+
+	//Origin is the origin LV when this LV is a snapshot
+	Origin  string
+	PoolLV  string
+	SegType string
+}
+
+//IsSnapshot returns true if the LV is a snapshot
+func (lv *LogicalVolume) IsSnapshot() bool {
+	return len(lv.Origin) > 0
+}
+
+type report struct {
+	Report []map[string][]map[string]string `json:"report"`
+}
+
+//Lvm manages LVM physical volumes, volume groups and logical volumes
+type Lvm struct {
+	run common.IExecutor
+}
+
+//NewLvm generates a Lvm object
+func NewLvm() *Lvm {
+	return NewLvmWithExecutor(run.NewRun())
+}
+
+//NewLvmWithExecutor generates a Lvm object that runs the LVM tools through
+//the given executor
+func NewLvmWithExecutor(executor common.IExecutor) *Lvm {
+	myLvm := &Lvm{
+		run: executor,
+	}
+	return myLvm
+}
+
+func validateNames(names ...string) error {
+	for _, name := range names {
+		if !nameRegex.MatchString(name) {
+			return ErrInvalidName
+		}
+	}
+	return nil
+}
+
+func validateDevices(devices ...string) error {
+	if len(devices) == 0 {
+		return ErrInvalidName
+	}
+	for _, device := range devices {
+		if !deviceRegex.MatchString(device) {
+			return ErrInvalidName
+		}
+	}
+	return nil
+}
+
+func parseUint(value string) uint64 {
+	num, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	return num
+}
+
+func parseInt(value string) int {
+	num, _ := strconv.Atoi(strings.TrimSpace(value))
+	return num
+}
+
+//parseReport returns the rows of the section (pv, vg, lv) of the JSON report.
+//Warnings LVM prints around the JSON are ignored.
+func parseReport(output string, section string) ([]map[string]string, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start == -1 || end < start {
+		return nil, ErrInvalidReport
+	}
+
+	r := report{}
+	err := json.Unmarshal([]byte(output[start:end+1]), &r)
+	if err != nil {
+		log.Debugln("Unmarshal Failed:", err)
+		return nil, ErrInvalidReport
+	}
+
+	rows := []map[string]string{}
+	for _, entry := range r.Report {
+		rows = append(rows, entry[section]...)
+	}
+	return rows, nil
+}
+
+func (lvm *Lvm) exec(cmdLine string) (string, error) {
+	output, status, err := lvm.run.CommandOutputStatus(cmdLine)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		log.Errorln("LVM command failed:", cmdLine, "Output:", output)
+		return output, ErrLvmFailed
+	}
+	return output, nil
+}
+
+func (lvm *Lvm) report(cmdLine string, section string) ([]map[string]string, error) {
+	output, err := lvm.exec(cmdLine)
+	if err != nil {
+		return nil, err
+	}
+	return parseReport(output, section)
+}
+
+//GetPhysicalVolumes returns the PVs on the host
+func (lvm *Lvm) GetPhysicalVolumes() ([]*PhysicalVolume, error) {
+	log.Debugln("Lvm::GetPhysicalVolumes ENTER")
+
+	rows, err := lvm.report("pvs"+reportArgs+" -o "+pvFields, "pv")
+	if err != nil {
+		log.Debugln("report Failed:", err)
+		log.Debugln("Lvm::GetPhysicalVolumes LEAVE")
+		return nil, err
+	}
+
+	list := make([]*PhysicalVolume, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, &PhysicalVolume{
+			Name:      row["pv_name"],
+			VGName:    row["vg_name"],
+			SizeBytes: parseUint(row["pv_size"]),
+			FreeBytes: parseUint(row["pv_free"]),
+			UUID:      row["pv_uuid"],
+		})
+	}
+
+	log.Debugln("GetPhysicalVolumes Count:", len(list))
+	log.Debugln("Lvm::GetPhysicalVolumes LEAVE")
+	return list, nil
+}
+
+//GetVolumeGroups returns the VGs on the host
+func (lvm *Lvm) GetVolumeGroups() ([]*VolumeGroup, error) {
+	log.Debugln("Lvm::GetVolumeGroups ENTER")
+
+	rows, err := lvm.report("vgs"+reportArgs+" -o "+vgFields, "vg")
+	if err != nil {
+		log.Debugln("report Failed:", err)
+		log.Debugln("Lvm::GetVolumeGroups LEAVE")
+		return nil, err
+	}
+
+	list := make([]*VolumeGroup, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, &VolumeGroup{
+			Name:            row["vg_name"],
+			SizeBytes:       parseUint(row["vg_size"]),
+			FreeBytes:       parseUint(row["vg_free"]),
+			ExtentSizeBytes: parseUint(row["vg_extent_size"]),
+			PVCount:         parseInt(row["pv_count"]),
+			LVCount:         parseInt(row["lv_count"]),
+			UUID:            row["vg_uuid"],
+		})
+	}
+
+	log.Debugln("GetVolumeGroups Count:", len(list))
+	log.Debugln("Lvm::GetVolumeGroups LEAVE")
+	return list, nil
+}
+
+//GetLogicalVolumes returns the LVs on the host
+func (lvm *Lvm) GetLogicalVolumes() ([]*LogicalVolume, error) {
+	log.Debugln("Lvm::GetLogicalVolumes ENTER")
+
+	rows, err := lvm.report("lvs"+reportArgs+" -o "+lvFields, "lv")
+	if err != nil {
+		log.Debugln("report Failed:", err)
+		log.Debugln("Lvm::GetLogicalVolumes LEAVE")
+		return nil, err
+	}
+
+	list := make([]*LogicalVolume, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, &LogicalVolume{
+			Name:      row["lv_name"],
+			VGName:    row["vg_name"],
+			Path:      row["lv_path"],
+			SizeBytes: parseUint(row["lv_size"]),
+			Attr:      row["lv_attr"],
+			UUID:      row["lv_uuid"],
+			Origin:    row["origin"],
+			PoolLV:    row["pool_lv"],
+			SegType:   row["segtype"],
+		})
+	}
+
+	log.Debugln("GetLogicalVolumes Count:", len(list))
+	log.Debugln("Lvm::GetLogicalVolumes LEAVE")
+	return list, nil
+}
+
+//GetPhysicalVolume returns the PV for device or ErrNotFound
+func (lvm *Lvm) GetPhysicalVolume(device string) (*PhysicalVolume, error) {
+	list, err := lvm.GetPhysicalVolumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, pv := range list {
+		if pv.Name == device {
+			return pv, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+//GetVolumeGroup returns the VG or ErrNotFound
+func (lvm *Lvm) GetVolumeGroup(vgName string) (*VolumeGroup, error) {
+	list, err := lvm.GetVolumeGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, vg := range list {
+		if vg.Name == vgName {
+			return vg, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+//GetLogicalVolume returns the LV or ErrNotFound
+func (lvm *Lvm) GetLogicalVolume(vgName string, lvName string) (*LogicalVolume, error) {
+	list, err := lvm.GetLogicalVolumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, lv := range list {
+		if lv.VGName == vgName && lv.Name == lvName {
+			return lv, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+//EnsurePhysicalVolume initializes device as a PV if it is not one already.
+//Returns true if the PV was created.
+func (lvm *Lvm) EnsurePhysicalVolume(device string) (bool, error) {
+	log.Debugln("Lvm::EnsurePhysicalVolume ENTER")
+	log.Debugln("device:", device)
+
+	if err := validateDevices(device); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Lvm::EnsurePhysicalVolume LEAVE")
+		return false, err
+	}
+
+	_, err := lvm.GetPhysicalVolume(device)
+	if err == nil {
+		log.Debugln("PV already exists")
+		log.Debugln("Lvm::EnsurePhysicalVolume LEAVE")
+		return false, nil
+	}
+	if err != ErrNotFound {
+		log.Debugln("GetPhysicalVolume Failed:", err)
+		log.Debugln("Lvm::EnsurePhysicalVolume LEAVE")
+		return false, err
+	}
+
+	_, err = lvm.exec("pvcreate -y " + device)
+	if err != nil {
+		log.Debugln("pvcreate Failed:", err)
+		log.Debugln("Lvm::EnsurePhysicalVolume LEAVE")
+		return false, err
+	}
+
+	log.Debugln("EnsurePhysicalVolume Created")
+	log.Debugln("Lvm::EnsurePhysicalVolume LEAVE")
+	return true, nil
+}
+
+//EnsureVolumeGroup creates the VG from devices or extends it with the devices
+//that are not yet part of it. Returns true if anything changed.
+func (lvm *Lvm) EnsureVolumeGroup(vgName string, devices []string) (bool, error) {
+	log.Debugln("Lvm::EnsureVolumeGroup ENTER")
+	log.Debugln("vgName:", vgName)
+	log.Debugln("devices:", devices)
+
+	if err := validateNames(vgName); err != nil {
+		log.Debugln("Invalid name")
+		log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+		return false, err
+	}
+	if err := validateDevices(devices...); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+		return false, err
+	}
+
+	pvs, err := lvm.GetPhysicalVolumes()
+	if err != nil {
+		log.Debugln("GetPhysicalVolumes Failed:", err)
+		log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+		return false, err
+	}
+
+	owners := make(map[string]string)
+	vgExists := false
+	for _, pv := range pvs {
+		owners[pv.Name] = pv.VGName
+	}
+	_, err = lvm.GetVolumeGroup(vgName)
+	if err == nil {
+		vgExists = true
+	} else if err != ErrNotFound {
+		log.Debugln("GetVolumeGroup Failed:", err)
+		log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+		return false, err
+	}
+
+	missing := []string{}
+	for _, device := range devices {
+		owner := owners[device]
+		if owner == vgName {
+			continue
+		}
+		if len(owner) > 0 {
+			log.Errorln("Device", device, "already belongs to VG", owner)
+			log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+			return false, ErrLvmFailed
+		}
+		missing = append(missing, device)
+	}
+
+	if len(missing) == 0 {
+		log.Debugln("VG already contains all devices")
+		log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+		return false, nil
+	}
+
+	cmdLine := "vgcreate -y " + vgName + " " + strings.Join(missing, " ")
+	if vgExists {
+		cmdLine = "vgextend -y " + vgName + " " + strings.Join(missing, " ")
+	}
+	_, err = lvm.exec(cmdLine)
+	if err != nil {
+		log.Debugln("VG create/extend Failed:", err)
+		log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+		return false, err
+	}
+
+	log.Debugln("EnsureVolumeGroup Changed")
+	log.Debugln("Lvm::EnsureVolumeGroup LEAVE")
+	return true, nil
+}
+
+func sizeArg(sizeBytes uint64) string {
+	if sizeBytes == 0 {
+		return " -l 100%FREE"
+	}
+	return " -L " + strconv.FormatUint(sizeBytes, 10) + "b"
+}
+
+//EnsureLogicalVolume creates the LV with sizeBytes or grows it if it is
+//smaller. A sizeBytes of 0 uses all the free space in the VG when creating.
+//Returns true if anything changed.
+func (lvm *Lvm) EnsureLogicalVolume(vgName string, lvName string, sizeBytes uint64) (bool, error) {
+	log.Debugln("Lvm::EnsureLogicalVolume ENTER")
+	log.Debugln("vgName:", vgName)
+	log.Debugln("lvName:", lvName)
+	log.Debugln("sizeBytes:", sizeBytes)
+
+	if err := validateNames(vgName, lvName); err != nil {
+		log.Debugln("Invalid name")
+		log.Debugln("Lvm::EnsureLogicalVolume LEAVE")
+		return false, err
+	}
+
+	lv, err := lvm.GetLogicalVolume(vgName, lvName)
+	if err == nil {
+		changed, errExtend := lvm.ExtendLogicalVolume(vgName, lvName, sizeBytes, false)
+		log.Debugln("LV exists. Size:", lv.SizeBytes)
+		log.Debugln("Lvm::EnsureLogicalVolume LEAVE")
+		return changed, errExtend
+	}
+	if err != ErrNotFound {
+		log.Debugln("GetLogicalVolume Failed:", err)
+		log.Debugln("Lvm::EnsureLogicalVolume LEAVE")
+		return false, err
+	}
+
+	_, err = lvm.exec("lvcreate -y -n " + lvName + sizeArg(sizeBytes) + " " + vgName)
+	if err != nil {
+		log.Debugln("lvcreate Failed:", err)
+		log.Debugln("Lvm::EnsureLogicalVolume LEAVE")
+		return false, err
+	}
+
+	log.Debugln("EnsureLogicalVolume Created")
+	log.Debugln("Lvm::EnsureLogicalVolume LEAVE")
+	return true, nil
+}
+
+//ExtendLogicalVolume grows the LV to sizeBytes if it is smaller. When
+//resizeFs is true the filesystem on the LV is grown as well. Returns true if
+//the LV was extended.
+func (lvm *Lvm) ExtendLogicalVolume(vgName string, lvName string, sizeBytes uint64, resizeFs bool) (bool, error) {
+	log.Debugln("Lvm::ExtendLogicalVolume ENTER")
+	log.Debugln("vgName:", vgName)
+	log.Debugln("lvName:", lvName)
+	log.Debugln("sizeBytes:", sizeBytes)
+
+	if err := validateNames(vgName, lvName); err != nil {
+		log.Debugln("Invalid name")
+		log.Debugln("Lvm::ExtendLogicalVolume LEAVE")
+		return false, err
+	}
+
+	lv, err := lvm.GetLogicalVolume(vgName, lvName)
+	if err != nil {
+		log.Debugln("GetLogicalVolume Failed:", err)
+		log.Debugln("Lvm::ExtendLogicalVolume LEAVE")
+		return false, err
+	}
+	if sizeBytes == 0 || lv.SizeBytes >= sizeBytes {
+		log.Debugln("LV is already large enough")
+		log.Debugln("Lvm::ExtendLogicalVolume LEAVE")
+		return false, nil
+	}
+
+	cmdLine := "lvextend -y" + sizeArg(sizeBytes)
+	if resizeFs {
+		cmdLine += " -r"
+	}
+	cmdLine += " " + vgName + "/" + lvName
+	_, err = lvm.exec(cmdLine)
+	if err != nil {
+		log.Debugln("lvextend Failed:", err)
+		log.Debugln("Lvm::ExtendLogicalVolume LEAVE")
+		return false, err
+	}
+
+	log.Debugln("ExtendLogicalVolume Succeeded")
+	log.Debugln("Lvm::ExtendLogicalVolume LEAVE")
+	return true, nil
+}
+
+//ResizeLogicalVolume grows or shrinks the LV to sizeBytes, rounded up to a
+//whole number of extents like LVM does. When resizeFs is true the filesystem
+//is resized with it. Shrinking without resizeFs returns ErrShrinkNeedsFs.
+//Returns true if the LV was resized.
+func (lvm *Lvm) ResizeLogicalVolume(vgName string, lvName string, sizeBytes uint64, resizeFs bool) (bool, error) {
+	log.Debugln("Lvm::ResizeLogicalVolume ENTER")
+	log.Debugln("vgName:", vgName)
+	log.Debugln("lvName:", lvName)
+	log.Debugln("sizeBytes:", sizeBytes)
+
+	if err := validateNames(vgName, lvName); err != nil || sizeBytes == 0 {
+		log.Debugln("Invalid name or size")
+		log.Debugln("Lvm::ResizeLogicalVolume LEAVE")
+		return false, ErrInvalidName
+	}
+
+	vg, err := lvm.GetVolumeGroup(vgName)
+	if err != nil {
+		log.Debugln("GetVolumeGroup Failed:", err)
+		log.Debugln("Lvm::ResizeLogicalVolume LEAVE")
+		return false, err
+	}
+	if extent := vg.ExtentSizeBytes; extent > 0 && sizeBytes%extent != 0 {
+		sizeBytes += extent - sizeBytes%extent
+		log.Debugln("Rounded up to:", sizeBytes)
+	}
+
+	lv, err := lvm.GetLogicalVolume(vgName, lvName)
+	if err != nil {
+		log.Debugln("GetLogicalVolume Failed:", err)
+		log.Debugln("Lvm::ResizeLogicalVolume LEAVE")
+		return false, err
+	}
+	if lv.SizeBytes == sizeBytes {
+		log.Debugln("LV is already the requested size")
+		log.Debugln("Lvm::ResizeLogicalVolume LEAVE")
+		return false, nil
+	}
+	if sizeBytes < lv.SizeBytes && !resizeFs {
+		log.Errorln("Refusing to shrink", vgName+"/"+lvName, "without resizing the filesystem")
+		log.Debugln("Lvm::ResizeLogicalVolume LEAVE")
+		return false, ErrShrinkNeedsFs
+	}
+
+	cmdLine := "lvresize -y" + sizeArg(sizeBytes)
+	if resizeFs {
+		cmdLine += " -r"
+	}
+	cmdLine += " " + vgName + "/" + lvName
+	_, err = lvm.exec(cmdLine)
+	if err != nil {
+		log.Debugln("lvresize Failed:", err)
+		log.Debugln("Lvm::ResizeLogicalVolume LEAVE")
+		return false, err
+	}
+
+	log.Debugln("ResizeLogicalVolume Succeeded")
+	log.Debugln("Lvm::ResizeLogicalVolume LEAVE")
+	return true, nil
+}
+
+//EnsureSnapshot creates a snapshot of the origin LV if it does not exist. A
+//sizeBytes of 0 creates a thin snapshot. Returns true if it was created.
+func (lvm *Lvm) EnsureSnapshot(vgName string, originName string, snapName string, sizeBytes uint64) (bool, error) {
+	log.Debugln("Lvm::EnsureSnapshot ENTER")
+	log.Debugln("vgName:", vgName)
+	log.Debugln("originName:", originName)
+	log.Debugln("snapName:", snapName)
+
+	if err := validateNames(vgName, originName, snapName); err != nil {
+		log.Debugln("Invalid name")
+		log.Debugln("Lvm::EnsureSnapshot LEAVE")
+		return false, err
+	}
+
+	snap, err := lvm.GetLogicalVolume(vgName, snapName)
+	if err == nil {
+		if snap.Origin != originName {
+			log.Errorln("LV", snapName, "exists but is not a snapshot of", originName)
+			log.Debugln("Lvm::EnsureSnapshot LEAVE")
+			return false, ErrLvmFailed
+		}
+		log.Debugln("Snapshot already exists")
+		log.Debugln("Lvm::EnsureSnapshot LEAVE")
+		return false, nil
+	}
+	if err != ErrNotFound {
+		log.Debugln("GetLogicalVolume Failed:", err)
+		log.Debugln("Lvm::EnsureSnapshot LEAVE")
+		return false, err
+	}
+
+	cmdLine := "lvcreate -y -s -n " + snapName
+	if sizeBytes > 0 {
+		cmdLine += sizeArg(sizeBytes)
+	}
+	cmdLine += " " + vgName + "/" + originName
+	_, err = lvm.exec(cmdLine)
+	if err != nil {
+		log.Debugln("lvcreate Failed:", err)
+		log.Debugln("Lvm::EnsureSnapshot LEAVE")
+		return false, err
+	}
+
+	log.Debugln("EnsureSnapshot Created")
+	log.Debugln("Lvm::EnsureSnapshot LEAVE")
+	return true, nil
+}
+
+//RemoveLogicalVolume removes the LV if it exists. Returns true if it was removed.
+func (lvm *Lvm) RemoveLogicalVolume(vgName string, lvName string) (bool, error) {
+	log.Debugln("Lvm::RemoveLogicalVolume ENTER")
+	log.Debugln("vgName:", vgName)
+	log.Debugln("lvName:", lvName)
+
+	if err := validateNames(vgName, lvName); err != nil {
+		log.Debugln("Invalid name")
+		log.Debugln("Lvm::RemoveLogicalVolume LEAVE")
+		return false, err
+	}
+
+	_, err := lvm.GetLogicalVolume(vgName, lvName)
+	if err == ErrNotFound {
+		log.Debugln("LV does not exist")
+		log.Debugln("Lvm::RemoveLogicalVolume LEAVE")
+		return false, nil
+	}
+	if err != nil {
+		log.Debugln("GetLogicalVolume Failed:", err)
+		log.Debugln("Lvm::RemoveLogicalVolume LEAVE")
+		return false, err
+	}
+
+	_, err = lvm.exec("lvremove -y " + vgName + "/" + lvName)
+	if err != nil {
+		log.Debugln("lvremove Failed:", err)
+		log.Debugln("Lvm::RemoveLogicalVolume LEAVE")
+		return false, err
+	}
+
+	log.Debugln("RemoveLogicalVolume Succeeded")
+	log.Debugln("Lvm::RemoveLogicalVolume LEAVE")
+	return true, nil
+}
+
+//RemoveVolumeGroup removes the VG if it exists. The VG must not contain any
+//LVs. Returns true if it was removed.
+func (lvm *Lvm) RemoveVolumeGroup(vgName string) (bool, error) {
+	log.Debugln("Lvm::RemoveVolumeGroup ENTER")
+	log.Debugln("vgName:", vgName)
+
+	if err := validateNames(vgName); err != nil {
+		log.Debugln("Invalid name")
+		log.Debugln("Lvm::RemoveVolumeGroup LEAVE")
+		return false, err
+	}
+
+	_, err := lvm.GetVolumeGroup(vgName)
+	if err == ErrNotFound {
+		log.Debugln("VG does not exist")
+		log.Debugln("Lvm::RemoveVolumeGroup LEAVE")
+		return false, nil
+	}
+	if err != nil {
+		log.Debugln("GetVolumeGroup Failed:", err)
+		log.Debugln("Lvm::RemoveVolumeGroup LEAVE")
+		return false, err
+	}
+
+	_, err = lvm.exec("vgremove -y " + vgName)
+	if err != nil {
+		log.Debugln("vgremove Failed:", err)
+		log.Debugln("Lvm::RemoveVolumeGroup LEAVE")
+		return false, err
+	}
+
+	log.Debugln("RemoveVolumeGroup Succeeded")
+	log.Debugln("Lvm::RemoveVolumeGroup LEAVE")
+	return true, nil
+}
+
+//RemovePhysicalVolume wipes the PV label from device if it has one. Returns
+//true if it was removed.
+func (lvm *Lvm) RemovePhysicalVolume(device string) (bool, error) {
+	log.Debugln("Lvm::RemovePhysicalVolume ENTER")
+	log.Debugln("device:", device)
+
+	if err := validateDevices(device); err != nil {
+		log.Debugln("Invalid device")
+		log.Debugln("Lvm::RemovePhysicalVolume LEAVE")
+		return false, err
+	}
+
+	_, err := lvm.GetPhysicalVolume(device)
+	if err == ErrNotFound {
+		log.Debugln("PV does not exist")
+		log.Debugln("Lvm::RemovePhysicalVolume LEAVE")
+		return false, nil
+	}
+	if err != nil {
+		log.Debugln("GetPhysicalVolume Failed:", err)
+		log.Debugln("Lvm::RemovePhysicalVolume LEAVE")
+		return false, err
+	}
+
+	_, err = lvm.exec("pvremove -y " + device)
+	if err != nil {
+		log.Debugln("pvremove Failed:", err)
+		log.Debugln("Lvm::RemovePhysicalVolume LEAVE")
+		return false, err
+	}
+
+	log.Debugln("RemovePhysicalVolume Succeeded")
+	log.Debugln("Lvm::RemovePhysicalVolume LEAVE")
+	return true, nil
+}
@@ -0,0 +1,219 @@
+package lvm
+
+import (
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+)
+
+const (
+	testPvs = `  WARNING: Not using device /dev/sdd for PV abc.
+  {
+      "report": [
+          {
+              "pv": [
+                  {"pv_name":"/dev/sdb", "vg_name":"data", "pv_size":"10733223936", "pv_free":"2143289344", "pv_uuid":"pv-uuid-b"},
+                  {"pv_name":"/dev/sdc", "vg_name":"", "pv_size":"10737418240", "pv_free":"10737418240", "pv_uuid":"pv-uuid-c"}
+              ]
+          }
+      ]
+  }
+`
+
+	testVgs = `  {
+      "report": [
+          {
+              "vg": [
+                  {"vg_name":"data", "vg_size":"10733223936", "vg_free":"2143289344", "vg_extent_size":"4194304", "pv_count":"1", "lv_count":"2", "vg_uuid":"vg-uuid"}
+              ]
+          }
+      ]
+  }
+`
+
+	testLvs = `  {
+      "report": [
+          {
+              "lv": [
+                  {"lv_name":"db", "vg_name":"data", "lv_path":"/dev/data/db", "lv_size":"8589934592", "lv_attr":"owi-a-s---", "lv_uuid":"lv-uuid-db", "origin":"", "pool_lv":"", "segtype":"linear"},
+                  {"lv_name":"db-snap", "vg_name":"data", "lv_path":"/dev/data/db-snap", "lv_size":"1073741824", "lv_attr":"swi-a-s---", "lv_uuid":"lv-uuid-snap", "origin":"db", "pool_lv":"", "segtype":"linear"}
+              ]
+          }
+      ]
+  }
+`
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+func newTestLvm() (*Lvm, *fake.Executor) {
+	executor := fake.NewExecutor()
+	executor.On("^pvs ", testPvs, 0)
+	executor.On("^vgs ", testVgs, 0)
+	executor.On("^lvs ", testLvs, 0)
+	return NewLvmWithExecutor(executor), executor
+}
+
+func TestReports(t *testing.T) {
+	lvm, _ := newTestLvm()
+
+	pvs, err := lvm.GetPhysicalVolumes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(pvs))
+	assert.Equal(t, "/dev/sdb", pvs[0].Name)
+	assert.Equal(t, "data", pvs[0].VGName)
+	assert.Equal(t, uint64(2143289344), pvs[0].FreeBytes)
+	assert.Equal(t, "", pvs[1].VGName)
+
+	vg, err := lvm.GetVolumeGroup("data")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(4194304), vg.ExtentSizeBytes)
+	assert.Equal(t, 2, vg.LVCount)
+
+	lv, err := lvm.GetLogicalVolume("data", "db-snap")
+	assert.Equal(t, nil, err)
+	assert.True(t, lv.IsSnapshot())
+	assert.Equal(t, "/dev/data/db-snap", lv.Path)
+
+	_, err = lvm.GetLogicalVolume("data", "missing")
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = parseReport("  No volume groups found", "vg")
+	assert.Equal(t, ErrInvalidReport, err)
+}
+
+func TestEnsurePhysicalVolume(t *testing.T) {
+	lvm, executor := newTestLvm()
+	executor.On("^pvcreate -y /dev/sdd$", "", 0)
+
+	changed, err := lvm.EnsurePhysicalVolume("/dev/sdb")
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	changed, err = lvm.EnsurePhysicalVolume("/dev/sdd")
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	_, err = lvm.EnsurePhysicalVolume("/dev/sdb; reboot")
+	assert.Equal(t, ErrInvalidName, err)
+}
+
+func TestEnsureVolumeGroup(t *testing.T) {
+	lvm, executor := newTestLvm()
+	executor.On("^vgextend ", "", 0)
+	executor.On("^vgcreate ", "", 0)
+
+	changed, err := lvm.EnsureVolumeGroup("data", []string{"/dev/sdb"})
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	changed, err = lvm.EnsureVolumeGroup("data", []string{"/dev/sdb", "/dev/sdc"})
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	assert.True(t, executor.Ran("^vgextend -y data /dev/sdc$"))
+
+	changed, err = lvm.EnsureVolumeGroup("logs", []string{"/dev/sdc"})
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	assert.True(t, executor.Ran("^vgcreate -y logs /dev/sdc$"))
+
+	_, err = lvm.EnsureVolumeGroup("logs", []string{"/dev/sdb"})
+	assert.Equal(t, ErrLvmFailed, err)
+}
+
+func TestEnsureLogicalVolume(t *testing.T) {
+	lvm, executor := newTestLvm()
+	executor.On("^lvcreate ", "", 0)
+	executor.On("^lvextend ", "", 0)
+
+	changed, err := lvm.EnsureLogicalVolume("data", "db", 4294967296)
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	changed, err = lvm.EnsureLogicalVolume("data", "db", 10737418240)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	assert.True(t, executor.Ran("^lvextend -y -L 10737418240b data/db$"))
+
+	changed, err = lvm.EnsureLogicalVolume("data", "web", 0)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	assert.True(t, executor.Ran("^lvcreate -y -n web -l 100%FREE data$"))
+
+	executor.On("^lvcreate ", "  Volume group \"data\" has insufficient free space", 5)
+	_, err = lvm.EnsureLogicalVolume("data", "big", 1099511627776)
+	assert.Equal(t, ErrLvmFailed, err)
+}
+
+func TestResizeLogicalVolume(t *testing.T) {
+	lvm, executor := newTestLvm()
+	executor.On("^lvresize ", "", 0)
+
+	changed, err := lvm.ResizeLogicalVolume("data", "db", 8589934592, true)
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	//a size that is not a whole number of extents is rounded up by LVM
+	changed, err = lvm.ResizeLogicalVolume("data", "db", 8589934592-1024, false)
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	_, err = lvm.ResizeLogicalVolume("data", "db", 4294967296, false)
+	assert.Equal(t, ErrShrinkNeedsFs, err)
+	assert.False(t, executor.Ran("^lvresize "))
+
+	changed, err = lvm.ResizeLogicalVolume("data", "db", 4294967296, true)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	assert.True(t, executor.Ran("^lvresize -y -L 4294967296b -r data/db$"))
+
+	changed, err = lvm.ResizeLogicalVolume("data", "db", 10000000000, false)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	assert.True(t, executor.Ran("^lvresize -y -L 10003415040b data/db$"))
+
+	_, err = lvm.ResizeLogicalVolume("data", "missing", 4294967296, true)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestSnapshotAndRemove(t *testing.T) {
+	lvm, executor := newTestLvm()
+	executor.On("^lvcreate ", "", 0)
+	executor.On("^lvremove ", "", 0)
+	executor.On("^vgremove ", "", 0)
+
+	changed, err := lvm.EnsureSnapshot("data", "db", "db-snap", 1073741824)
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	changed, err = lvm.EnsureSnapshot("data", "db", "db-snap2", 1073741824)
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	assert.True(t, executor.Ran("^lvcreate -y -s -n db-snap2 -L 1073741824b data/db$"))
+
+	_, err = lvm.EnsureSnapshot("data", "web", "db-snap", 0)
+	assert.Equal(t, ErrLvmFailed, err)
+
+	changed, err = lvm.RemoveLogicalVolume("data", "db-snap")
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	changed, err = lvm.RemoveLogicalVolume("data", "gone")
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	changed, err = lvm.RemoveVolumeGroup("logs")
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	changed, err = lvm.RemoveVolumeGroup("data")
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+}
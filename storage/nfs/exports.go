@@ -0,0 +1,429 @@
+package nfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+)
+
+var (
+	//ErrInvalidExport the export line could not be parsed
+	ErrInvalidExport = errors.New("Invalid NFS export")
+
+	//ErrInvalidExportOption the export option is unknown or conflicts with another
+	ErrInvalidExportOption = errors.New("Invalid NFS export option")
+
+	//ErrInvalidExportsName the exports.d file name is invalid
+	ErrInvalidExportsName = errors.New("Invalid exports.d file name")
+
+	hostRegex        = regexp.MustCompile("^[a-zA-Z0-9_.*?:/@\\[\\]\\-]*$")
+	exportsNameRegex = regexp.MustCompile("^[a-zA-Z0-9_.\\-]+$")
+
+	exportFlags = map[string]bool{
+		"rw": true, "ro": true,
+		"sync": true, "async": true,
+		"secure": true, "insecure": true,
+		"wdelay": true, "no_wdelay": true,
+		"hide": true, "nohide": true,
+		"crossmnt": true, "no_acl": true,
+		"subtree_check": true, "no_subtree_check": true,
+		"secure_locks": true, "insecure_locks": true, "auth_nlm": true, "no_auth_nlm": true,
+		"root_squash": true, "no_root_squash": true,
+		"all_squash": true, "no_all_squash": true,
+		"mountpoint": true, "mp": true,
+		"pnfs": true, "no_pnfs": true, "security_label": true,
+	}
+
+	exportValueOptions = map[string]bool{
+		"anonuid": true, "anongid": true, "fsid": true, "sec": true,
+		"refer": true, "replicas": true, "mountpoint": true, "mp": true,
+	}
+
+	exportConflicts = [][2]string{
+		{"rw", "ro"},
+		{"sync", "async"},
+		{"secure", "insecure"},
+		{"wdelay", "no_wdelay"},
+		{"hide", "nohide"},
+		{"subtree_check", "no_subtree_check"},
+		{"secure_locks", "insecure_locks"},
+		{"auth_nlm", "no_auth_nlm"},
+		{"root_squash", "no_root_squash"},
+		{"all_squash", "no_all_squash"},
+		{"pnfs", "no_pnfs"},
+	}
+)
+
+//ExportClient is a host, network or netgroup and the options it is
+//exported with. An empty Host exports to everyone.
+type ExportClient struct {
+	Host    string
+	Options []string
+}
+
+//Export is an entry in /etc/exports or /etc/exports.d
+type Export struct {
+	Path    string
+	Clients []*ExportClient
+
+	//File is the file the export was read from
+	File string
+}
+
+//String returns the export formatted as an exports line
+func (e *Export) String() string {
+	path := e.Path
+	if strings.ContainsAny(path, " \t") {
+		path = "\"" + path + "\""
+	}
+	line := path
+	for _, client := range e.Clients {
+		line += " " + client.Host
+		if len(client.Options) > 0 {
+			line += "(" + strings.Join(client.Options, ",") + ")"
+		}
+	}
+	return line
+}
+
+//validateExportOptions checks every option is known and that no two
+//options contradict each other
+func validateExportOptions(options []string) error {
+	seen := make(map[string]bool)
+	for _, opt := range options {
+		name := opt
+		idx := strings.Index(opt, "=")
+		if idx != -1 {
+			name = opt[:idx]
+			if !exportValueOptions[name] || idx == len(opt)-1 || strings.ContainsAny(opt, " \t(),") {
+				return ErrInvalidExportOption
+			}
+		} else if !exportFlags[name] {
+			return ErrInvalidExportOption
+		}
+		seen[name] = true
+	}
+	for _, pair := range exportConflicts {
+		if seen[pair[0]] && seen[pair[1]] {
+			return ErrInvalidExportOption
+		}
+	}
+	return nil
+}
+
+func (e *Export) validate() error {
+	if !strings.HasPrefix(e.Path, "/") || strings.ContainsAny(e.Path, "\"\n\\") {
+		return ErrInvalidExportPath
+	}
+	if len(e.Clients) == 0 {
+		return ErrInvalidExport
+	}
+	for _, client := range e.Clients {
+		if !hostRegex.MatchString(client.Host) {
+			return ErrInvalidExport
+		}
+		if err := validateExportOptions(client.Options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitOptions(options string) []string {
+	list := []string{}
+	for _, opt := range strings.Split(options, ",") {
+		if opt = strings.TrimSpace(opt); len(opt) > 0 {
+			list = append(list, opt)
+		}
+	}
+	return list
+}
+
+//parseExportLine parses a logical exports line. Default options given with
+//a leading dash are folded into the clients that follow them.
+func parseExportLine(line string) (*Export, error) {
+	line = strings.TrimSpace(line)
+	export := &Export{}
+
+	var rest string
+	if strings.HasPrefix(line, "\"") {
+		end := strings.Index(line[1:], "\"")
+		if end == -1 {
+			return nil, ErrInvalidExport
+		}
+		export.Path = line[1 : end+1]
+		rest = line[end+2:]
+	} else {
+		fields := strings.Fields(line)
+		export.Path = fields[0]
+		rest = strings.TrimPrefix(line, fields[0])
+	}
+
+	defaults := []string{}
+	for _, token := range strings.Fields(rest) {
+		if strings.HasPrefix(token, "-") {
+			defaults = splitOptions(token[1:])
+			continue
+		}
+		client := &ExportClient{
+			Host:    token,
+			Options: append([]string{}, defaults...),
+		}
+		if idx := strings.Index(token, "("); idx != -1 {
+			if !strings.HasSuffix(token, ")") {
+				return nil, ErrInvalidExport
+			}
+			client.Host = token[:idx]
+			client.Options = append(client.Options, splitOptions(token[idx+1:len(token)-1])...)
+		}
+		export.Clients = append(export.Clients, client)
+	}
+	return export, nil
+}
+
+//exportsLine is a logical line with the physical lines it was read from
+type exportsLine struct {
+	text     string
+	physical []string
+	export   *Export
+}
+
+func readExportsLines(path string) ([]*exportsLine, []byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	lines := []*exportsLine{}
+	var current *exportsLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		raw := scanner.Text()
+		if current == nil {
+			current = &exportsLine{}
+		}
+		current.physical = append(current.physical, raw)
+		if strings.HasSuffix(raw, "\\") {
+			current.text += strings.TrimSuffix(raw, "\\") + " "
+			continue
+		}
+		current.text += raw
+
+		trimmed := strings.TrimSpace(current.text)
+		if len(trimmed) > 0 && trimmed[0] != '#' {
+			export, errParse := parseExportLine(trimmed)
+			if errParse != nil {
+				log.Warnln("Ignoring invalid exports line:", trimmed)
+			} else {
+				export.File = path
+				current.export = export
+			}
+		}
+		lines = append(lines, current)
+		current = nil
+	}
+	if current != nil {
+		lines = append(lines, current)
+	}
+	return lines, data, scanner.Err()
+}
+
+//mergeExports replaces the line that exports the same path as export or
+//appends it. When remove is true the lines for that path are dropped.
+func mergeExports(path string, export *Export, remove bool) (bool, error) {
+	lines, existing, err := readExportsLines(path)
+	if err != nil {
+		return false, err
+	}
+
+	written := remove
+	var buffer bytes.Buffer
+	for _, line := range lines {
+		if line.export == nil || line.export.Path != export.Path {
+			for _, raw := range line.physical {
+				buffer.WriteString(raw + "\n")
+			}
+			continue
+		}
+		if written {
+			continue
+		}
+		if line.export.String() == export.String() {
+			for _, raw := range line.physical {
+				buffer.WriteString(raw + "\n")
+			}
+		} else {
+			buffer.WriteString(export.String() + "\n")
+		}
+		written = true
+	}
+	if !written {
+		buffer.WriteString(export.String() + "\n")
+	}
+
+	if bytes.Equal(existing, buffer.Bytes()) {
+		return false, nil
+	}
+
+	err = fs.NewFs().WriteFileAtomic(path, buffer.Bytes(), 0644)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//exportsFiles returns /etc/exports followed by the exports.d files
+func (n *Nfs) exportsFiles() []string {
+	files := []string{n.exportsFile}
+	matches, _ := filepath.Glob(filepath.Join(n.exportsDir, "*.exports"))
+	sort.Strings(matches)
+	return append(files, matches...)
+}
+
+//GetExports returns the exports configured in /etc/exports and
+///etc/exports.d
+func (n *Nfs) GetExports() ([]*Export, error) {
+	log.Debugln("Nfs::GetExports ENTER")
+
+	list := []*Export{}
+	for _, file := range n.exportsFiles() {
+		lines, _, err := readExportsLines(file)
+		if err != nil {
+			log.Debugln("readExportsLines Failed:", err)
+			log.Debugln("Nfs::GetExports LEAVE")
+			return nil, err
+		}
+		for _, line := range lines {
+			if line.export != nil {
+				list = append(list, line.export)
+			}
+		}
+	}
+
+	log.Debugln("GetExports Count:", len(list))
+	log.Debugln("Nfs::GetExports LEAVE")
+	return list, nil
+}
+
+//EnsureExport writes the export to /etc/exports, or to
+///etc/exports.d/<name>.exports when name is set, replacing any other
+//definition of the same path. Call Reexport to apply it. Returns true if a
+//file changed.
+func (n *Nfs) EnsureExport(export *Export, name string) (bool, error) {
+	log.Debugln("Nfs::EnsureExport ENTER")
+	log.Debugln("export:", export.String())
+	log.Debugln("name:", name)
+
+	if err := export.validate(); err != nil {
+		log.Debugln("Invalid export:", err)
+		log.Debugln("Nfs::EnsureExport LEAVE")
+		return false, err
+	}
+
+	target := n.exportsFile
+	if len(name) > 0 {
+		if !exportsNameRegex.MatchString(name) {
+			log.Debugln("Invalid name")
+			log.Debugln("Nfs::EnsureExport LEAVE")
+			return false, ErrInvalidExportsName
+		}
+		err := os.MkdirAll(n.exportsDir, 0755)
+		if err != nil {
+			log.Debugln("MkdirAll Failed:", err)
+			log.Debugln("Nfs::EnsureExport LEAVE")
+			return false, err
+		}
+		target = filepath.Join(n.exportsDir, name+".exports")
+	}
+
+	lock, err := n.fs.Lock("exports", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("Nfs::EnsureExport LEAVE")
+		return false, err
+	}
+	defer lock.Unlock()
+
+	changed, err := mergeExports(target, export, false)
+	if err != nil {
+		log.Debugln("mergeExports Failed:", err)
+		log.Debugln("Nfs::EnsureExport LEAVE")
+		return false, err
+	}
+
+	for _, file := range n.exportsFiles() {
+		if file == target {
+			continue
+		}
+		removed, errRemove := mergeExports(file, export, true)
+		if errRemove != nil {
+			log.Debugln("mergeExports Failed:", errRemove)
+			log.Debugln("Nfs::EnsureExport LEAVE")
+			return false, errRemove
+		}
+		changed = changed || removed
+	}
+
+	log.Debugln("EnsureExport changed:", changed)
+	log.Debugln("Nfs::EnsureExport LEAVE")
+	return changed, nil
+}
+
+//RemoveExport removes the export of path from /etc/exports and
+///etc/exports.d. Call Reexport to apply it. Returns true if a file changed.
+func (n *Nfs) RemoveExport(path string) (bool, error) {
+	log.Debugln("Nfs::RemoveExport ENTER")
+	log.Debugln("path:", path)
+
+	lock, err := n.fs.Lock("exports", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("Nfs::RemoveExport LEAVE")
+		return false, err
+	}
+	defer lock.Unlock()
+
+	changed := false
+	for _, file := range n.exportsFiles() {
+		removed, err := mergeExports(file, &Export{Path: path}, true)
+		if err != nil {
+			log.Debugln("mergeExports Failed:", err)
+			log.Debugln("Nfs::RemoveExport LEAVE")
+			return false, err
+		}
+		changed = changed || removed
+	}
+
+	log.Debugln("RemoveExport changed:", changed)
+	log.Debugln("Nfs::RemoveExport LEAVE")
+	return changed, nil
+}
+
+//Reexport synchronizes the kernel export table with the exports files
+func (n *Nfs) Reexport() error {
+	log.Debugln("Nfs::Reexport ENTER")
+
+	output, status, err := n.run.CommandOutputStatus("exportfs -ra")
+	if err == nil && status != 0 {
+		log.Errorln("exportfs failed:", output)
+		err = ErrExportfsFailed
+	}
+	if err != nil {
+		log.Debugln("exportfs Failed:", err)
+		log.Debugln("Nfs::Reexport LEAVE")
+		return err
+	}
+
+	log.Debugln("Nfs::Reexport LEAVE")
+	return nil
+}
@@ -0,0 +1,285 @@
+package nfs
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	run "github.com/dvonthenen/goxplatform/run"
+	common "github.com/dvonthenen/goxplatform/run/common"
+	filesystem "github.com/dvonthenen/goxplatform/storage/filesystem"
+)
+
+const (
+	defaultExportsFile = "/etc/exports"
+	defaultExportsDir  = "/etc/exports.d"
+)
+
+var (
+	//ErrInvalidServer the server is not a hostname or IP address
+	ErrInvalidServer = errors.New("Invalid NFS server")
+
+	//ErrInvalidExportPath the export path is invalid
+	ErrInvalidExportPath = errors.New("Invalid NFS export path")
+
+	//ErrInvalidVersion the NFS version is not supported
+	ErrInvalidVersion = errors.New("Invalid NFS version")
+
+	//ErrInvalidMountOption the mount option is invalid
+	ErrInvalidMountOption = errors.New("Invalid NFS mount option")
+
+	//ErrClientNotInstalled mount.nfs is not installed
+	ErrClientNotInstalled = errors.New("NFS client utilities are not installed")
+
+	//ErrExportfsFailed the exportfs command failed
+	ErrExportfsFailed = errors.New("exportfs failed")
+
+	serverRegex      = regexp.MustCompile("^([a-zA-Z0-9]([a-zA-Z0-9.\\-]*[a-zA-Z0-9])?|\\[[0-9a-fA-F:.]+\\])$")
+	exportPathRegex  = regexp.MustCompile("^/[a-zA-Z0-9/_.:+@,=\\-]*$")
+	mountOptionRegex = regexp.MustCompile("^[a-z_]+(=[a-zA-Z0-9_.:/\\-]+)?$")
+
+	versions = map[string]bool{
+		"3":   true,
+		"4":   true,
+		"4.0": true,
+		"4.1": true,
+		"4.2": true,
+	}
+)
+
+//MountOptions configures an NFS client mount
+type MountOptions struct {
+	//Version is the NFS protocol version: 3, 4, 4.0, 4.1 or 4.2. Empty lets
+	//the client negotiate.
+	Version string
+
+	//Options are extra mount options like hard, timeo=600 or sec=krb5
+	Options []string
+
+	//Persist adds the mount to fstab
+	Persist bool
+}
+
+//Mount is a mounted NFS share
+type Mount struct {
+	Server     string
+	Export     string
+	MountPoint string
+	FsType     string
+	Version    string
+	Options    string
+}
+
+//Nfs manages NFS client mounts and server exports
+type Nfs struct {
+	run         common.IExecutor
+	filesystem  *filesystem.Filesystem
+	exportsFile string
+	exportsDir  string
+	fs          *fs.Fs
+
+	getMounts        func() ([]*fs.MountInfo, error)
+	ensureFstabEntry func(entry *fs.FstabEntry) (bool, error)
+	removeFstabEntry func(entry *fs.FstabEntry) (bool, error)
+}
+
+//NewNfs generates a Nfs object
+func NewNfs() *Nfs {
+	return NewNfsWithExecutor(run.NewRun())
+}
+
+//NewNfsWithExecutor generates a Nfs object that runs mount and exportfs
+//through the given executor
+func NewNfsWithExecutor(executor common.IExecutor) *Nfs {
+	myFs := fs.NewFs()
+	myNfs := &Nfs{
+		run:              executor,
+		filesystem:       filesystem.NewFilesystemWithExecutor(executor),
+		exportsFile:      defaultExportsFile,
+		exportsDir:       defaultExportsDir,
+		fs:               myFs,
+		getMounts:        myFs.GetMounts,
+		ensureFstabEntry: myFs.EnsureFstabEntry,
+		removeFstabEntry: myFs.RemoveFstabEntry,
+	}
+	return myNfs
+}
+
+//Source returns the server:/export form used by mount
+func Source(server string, export string) string {
+	return server + ":" + export
+}
+
+//splitSource splits server:/export, handling bracketed IPv6 servers
+func splitSource(source string) (string, string) {
+	idx := strings.Index(source, ":/")
+	if strings.HasPrefix(source, "[") {
+		end := strings.Index(source, "]:")
+		if end == -1 {
+			return "", source
+		}
+		idx = end + 1
+	}
+	if idx == -1 {
+		return "", source
+	}
+	return source[:idx], source[idx+1:]
+}
+
+func optionValue(options string, name string) string {
+	for _, opt := range strings.Split(options, ",") {
+		if strings.HasPrefix(opt, name+"=") {
+			return strings.TrimPrefix(opt, name+"=")
+		}
+	}
+	return ""
+}
+
+//mountOptions validates opts and returns the comma separated mount options
+func mountOptions(opts *MountOptions) (string, error) {
+	list := []string{}
+	if len(opts.Version) > 0 {
+		if !versions[opts.Version] {
+			return "", ErrInvalidVersion
+		}
+		list = append(list, "vers="+opts.Version)
+	}
+	for _, opt := range opts.Options {
+		if !mountOptionRegex.MatchString(opt) {
+			return "", ErrInvalidMountOption
+		}
+		if strings.HasPrefix(opt, "vers=") || strings.HasPrefix(opt, "nfsvers=") {
+			return "", ErrInvalidMountOption
+		}
+		list = append(list, opt)
+	}
+	return strings.Join(list, ","), nil
+}
+
+//Mount mounts server:/export on mountPoint. Returns true if it was mounted
+//and false if the share is already mounted there.
+func (n *Nfs) Mount(server string, export string, mountPoint string, opts *MountOptions) (bool, error) {
+	log.Debugln("Nfs::Mount ENTER")
+	log.Debugln("server:", server)
+	log.Debugln("export:", export)
+	log.Debugln("mountPoint:", mountPoint)
+
+	if opts == nil {
+		opts = &MountOptions{}
+	}
+	if !serverRegex.MatchString(server) {
+		log.Debugln("Invalid server")
+		log.Debugln("Nfs::Mount LEAVE")
+		return false, ErrInvalidServer
+	}
+	if !exportPathRegex.MatchString(export) {
+		log.Debugln("Invalid export")
+		log.Debugln("Nfs::Mount LEAVE")
+		return false, ErrInvalidExportPath
+	}
+	options, err := mountOptions(opts)
+	if err != nil {
+		log.Debugln("mountOptions Failed:", err)
+		log.Debugln("Nfs::Mount LEAVE")
+		return false, err
+	}
+	if !n.run.ExecExistsInPath("mount.nfs") {
+		log.Debugln("mount.nfs not found")
+		log.Debugln("Nfs::Mount LEAVE")
+		return false, ErrClientNotInstalled
+	}
+
+	source := Source(server, export)
+	mounted, err := n.filesystem.Mount(source, mountPoint, "nfs", options)
+	if err != nil {
+		log.Debugln("Mount Failed:", err)
+		log.Debugln("Nfs::Mount LEAVE")
+		return false, err
+	}
+
+	if opts.Persist {
+		fstabOptions := "_netdev"
+		if len(options) > 0 {
+			fstabOptions = options + ",_netdev"
+		}
+		_, err = n.ensureFstabEntry(&fs.FstabEntry{
+			Source:     source,
+			MountPoint: mountPoint,
+			FsType:     "nfs",
+			Options:    fstabOptions,
+		})
+		if err != nil {
+			log.Debugln("EnsureFstabEntry Failed:", err)
+			log.Debugln("Nfs::Mount LEAVE")
+			return false, err
+		}
+	}
+
+	log.Debugln("Nfs::Mount LEAVE")
+	return mounted, nil
+}
+
+//Unmount unmounts the share on mountPoint and, if removeFstab is true,
+//removes its fstab entry. Returns true if it was unmounted.
+func (n *Nfs) Unmount(mountPoint string, removeFstab bool) (bool, error) {
+	log.Debugln("Nfs::Unmount ENTER")
+	log.Debugln("mountPoint:", mountPoint)
+
+	unmounted, err := n.filesystem.Unmount(mountPoint)
+	if err != nil {
+		log.Debugln("Unmount Failed:", err)
+		log.Debugln("Nfs::Unmount LEAVE")
+		return false, err
+	}
+
+	if removeFstab {
+		_, err = n.removeFstabEntry(&fs.FstabEntry{MountPoint: mountPoint, FsType: "nfs"})
+		if err != nil {
+			log.Debugln("RemoveFstabEntry Failed:", err)
+			log.Debugln("Nfs::Unmount LEAVE")
+			return false, err
+		}
+	}
+
+	log.Debugln("Nfs::Unmount LEAVE")
+	return unmounted, nil
+}
+
+//GetMounts returns the mounted NFS shares
+func (n *Nfs) GetMounts() ([]*Mount, error) {
+	log.Debugln("Nfs::GetMounts ENTER")
+
+	mounts, err := n.getMounts()
+	if err != nil {
+		log.Debugln("GetMounts Failed:", err)
+		log.Debugln("Nfs::GetMounts LEAVE")
+		return nil, err
+	}
+
+	list := []*Mount{}
+	for _, mi := range mounts {
+		if mi.FsType != "nfs" && mi.FsType != "nfs4" {
+			continue
+		}
+		server, export := splitSource(mi.Source)
+		version := optionValue(mi.SuperOptions, "vers")
+		if len(version) == 0 {
+			version = optionValue(mi.Options, "vers")
+		}
+		list = append(list, &Mount{
+			Server:     server,
+			Export:     export,
+			MountPoint: mi.MountPoint,
+			FsType:     mi.FsType,
+			Version:    version,
+			Options:    mi.SuperOptions,
+		})
+	}
+
+	log.Debugln("GetMounts Count:", len(list))
+	log.Debugln("Nfs::GetMounts LEAVE")
+	return list, nil
+}
@@ -0,0 +1,154 @@
+package nfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	assert "github.com/stretchr/testify/assert"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+	fake "github.com/dvonthenen/goxplatform/run/fake"
+)
+
+const testExports = `# /etc/exports
+/srv/data    10.0.0.0/24(rw,sync,no_subtree_check) *.example.com(ro)
+"/srv/my share" -ro,sync \
+    host1 host2(rw)
+`
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.InfoLevel)
+	log.Debugln("Start tests")
+	m.Run()
+}
+
+func newTestNfs(t *testing.T) (*Nfs, *fake.Executor, string) {
+	dir, err := ioutil.TempDir("", "nfs")
+	assert.Equal(t, nil, err)
+
+	executor := fake.NewExecutor()
+	nfs := NewNfsWithExecutor(executor)
+	nfs.exportsFile = filepath.Join(dir, "exports")
+	nfs.exportsDir = filepath.Join(dir, "exports.d")
+	nfs.fs.SetLockDir(dir)
+	return nfs, executor, dir
+}
+
+func TestMountAndGetMounts(t *testing.T) {
+	nfs, executor, dir := newTestNfs(t)
+	defer os.RemoveAll(dir)
+
+	var fstab []*fs.FstabEntry
+	nfs.ensureFstabEntry = func(entry *fs.FstabEntry) (bool, error) {
+		fstab = append(fstab, entry)
+		return true, nil
+	}
+	mounts := []*fs.MountInfo{
+		{MountPoint: "/", Source: "/dev/sda1", FsType: "ext4"},
+		{MountPoint: "/mnt/data", Source: "nas01:/export/data", FsType: "nfs4", SuperOptions: "rw,vers=4.2,rsize=1048576"},
+		{MountPoint: "/mnt/v6", Source: "[fd00::10]:/export/v6", FsType: "nfs", SuperOptions: "rw,vers=3"},
+	}
+	nfs.getMounts = func() ([]*fs.MountInfo, error) {
+		return mounts, nil
+	}
+
+	list, err := nfs.GetMounts()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "nas01", list[0].Server)
+	assert.Equal(t, "/export/data", list[0].Export)
+	assert.Equal(t, "4.2", list[0].Version)
+	assert.Equal(t, "[fd00::10]", list[1].Server)
+	assert.Equal(t, "/export/v6", list[1].Export)
+
+	target := filepath.Join(dir, "mnt", "scratch")
+	_, err = nfs.Mount("nas01", "/export/scratch", target, nil)
+	assert.Equal(t, ErrClientNotInstalled, err)
+
+	executor.SetInPath("mount.nfs", true)
+	executor.On("^mount ", "", 0)
+	mounted, err := nfs.Mount("nas01", "/export/scratch", target, &MountOptions{
+		Version: "4.1",
+		Options: []string{"hard", "timeo=600"},
+		Persist: true,
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, mounted)
+	assert.True(t, executor.Ran("^mount -t nfs -o vers=4.1,hard,timeo=600 nas01:/export/scratch "+target+"$"))
+	assert.Equal(t, 1, len(fstab))
+	assert.Equal(t, "vers=4.1,hard,timeo=600,_netdev", fstab[0].Options)
+
+	_, err = nfs.Mount("nas01", "/export/scratch", target, &MountOptions{Version: "5"})
+	assert.Equal(t, ErrInvalidVersion, err)
+	_, err = nfs.Mount("nas01", "/export/scratch", target, &MountOptions{Options: []string{"hard;reboot"}})
+	assert.Equal(t, ErrInvalidMountOption, err)
+	_, err = nfs.Mount("nas01 && reboot", "/export/scratch", target, nil)
+	assert.Equal(t, ErrInvalidServer, err)
+}
+
+func TestParseExports(t *testing.T) {
+	nfs, _, dir := newTestNfs(t)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(nfs.exportsFile, []byte(testExports), 0644)
+	os.MkdirAll(nfs.exportsDir, 0755)
+	ioutil.WriteFile(filepath.Join(nfs.exportsDir, "backup.exports"), []byte("/srv/backup backup01(rw,no_root_squash)\n"), 0644)
+
+	exports, err := nfs.GetExports()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(exports))
+	assert.Equal(t, "/srv/data", exports[0].Path)
+	assert.Equal(t, "10.0.0.0/24", exports[0].Clients[0].Host)
+	assert.Equal(t, []string{"rw", "sync", "no_subtree_check"}, exports[0].Clients[0].Options)
+	assert.Equal(t, "/srv/my share", exports[1].Path)
+	assert.Equal(t, []string{"ro", "sync"}, exports[1].Clients[0].Options)
+	assert.Equal(t, []string{"ro", "sync", "rw"}, exports[1].Clients[1].Options)
+	assert.Equal(t, "/srv/backup", exports[2].Path)
+	assert.Equal(t, filepath.Join(nfs.exportsDir, "backup.exports"), exports[2].File)
+}
+
+func TestEnsureAndRemoveExport(t *testing.T) {
+	nfs, executor, dir := newTestNfs(t)
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(nfs.exportsFile, []byte(testExports), 0644)
+
+	export := &Export{
+		Path:    "/srv/data",
+		Clients: []*ExportClient{{Host: "10.0.0.0/24", Options: []string{"rw", "sync", "no_subtree_check"}}},
+	}
+	changed, err := nfs.EnsureExport(export, "data")
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	changed, err = nfs.EnsureExport(export, "data")
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	data, _ := ioutil.ReadFile(nfs.exportsFile)
+	assert.Equal(t, `# /etc/exports
+"/srv/my share" -ro,sync \
+    host1 host2(rw)
+`, string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(nfs.exportsDir, "data.exports"))
+	assert.Equal(t, "/srv/data 10.0.0.0/24(rw,sync,no_subtree_check)\n", string(data))
+
+	changed, err = nfs.RemoveExport("/srv/my share")
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	export.Clients[0].Options = []string{"rw", "ro"}
+	_, err = nfs.EnsureExport(export, "")
+	assert.Equal(t, ErrInvalidExportOption, err)
+	export.Clients[0].Options = []string{"rw", "anonuid=65534", "bogus"}
+	_, err = nfs.EnsureExport(export, "")
+	assert.Equal(t, ErrInvalidExportOption, err)
+	_, err = nfs.EnsureExport(&Export{Path: "/srv/x", Clients: []*ExportClient{{Host: "*"}}}, "../x")
+	assert.Equal(t, ErrInvalidExportsName, err)
+
+	executor.On("^exportfs -ra$", "", 0)
+	assert.Equal(t, nil, nfs.Reexport())
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	device "github.com/dvonthenen/goxplatform/storage/device"
+	disk "github.com/dvonthenen/goxplatform/storage/disk"
+	filesystem "github.com/dvonthenen/goxplatform/storage/filesystem"
+	iscsi "github.com/dvonthenen/goxplatform/storage/iscsi"
+	loop "github.com/dvonthenen/goxplatform/storage/loop"
+	luks "github.com/dvonthenen/goxplatform/storage/luks"
+	lvm "github.com/dvonthenen/goxplatform/storage/lvm"
+	nfs "github.com/dvonthenen/goxplatform/storage/nfs"
+)
+
+//Storage is a static class that groups the storage related functions
+type Storage struct {
+	Device     *device.Device
+	Disk       *disk.Disk
+	Filesystem *filesystem.Filesystem
+	Iscsi      *iscsi.Iscsi
+	Loop       *loop.Loop
+	Luks       *luks.Luks
+	Lvm        *lvm.Lvm
+	Nfs        *nfs.Nfs
+}
+
+//NewStorage generates a Storage object
+func NewStorage() *Storage {
+	myDevice := device.NewDevice()
+	myDisk := disk.NewDisk()
+	myFilesystem := filesystem.NewFilesystem()
+	myIscsi := iscsi.NewIscsi()
+	myLoop := loop.NewLoop()
+	myLuks := luks.NewLuks()
+	myLvm := lvm.NewLvm()
+	myNfs := nfs.NewNfs()
+
+	myStorage := &Storage{
+		Device:     myDevice,
+		Disk:       myDisk,
+		Filesystem: myFilesystem,
+		Iscsi:      myIscsi,
+		Loop:       myLoop,
+		Luks:       myLuks,
+		Lvm:        myLvm,
+		Nfs:        myNfs,
+	}
+
+	return myStorage
+}
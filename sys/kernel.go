@@ -0,0 +1,346 @@
+package sys
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultBootDir    = "/boot"
+	defaultModulesDir = "/lib/modules"
+)
+
+var (
+	kernelVersionRegex = regexp.MustCompile("^([0-9]+)\\.([0-9]+)(?:\\.([0-9]+))?(.*)$")
+	kernelDistroRegex  = regexp.MustCompile("^(el|fc|amzn|uek|an|ol)[0-9][0-9a-z_]*$")
+	kernelDebianRegex  = regexp.MustCompile("^([0-9]+(?:\\.[0-9]+)*)(?:-(.+))?$")
+
+	kernelArchs = []string{"x86_64", "i386", "i586", "i686", "aarch64", "armv7hl", "ppc64", "ppc64le", "s390x", "noarch"}
+)
+
+//KernelVersion is a parsed kernel release string as reported by uname -r
+type KernelVersion struct {
+	//Release is the original release string
+	Release string
+
+	Major int
+	Minor int
+	Patch int
+
+	//ABI is the distro build/ABI number (21 in 4.4.0-21-generic, 514.10.2 in
+	//3.10.0-514.10.2.el7.x86_64)
+	ABI string
+
+	//Flavor is the kernel flavor (generic, lowlatency, amd64, debug)
+	Flavor string
+
+	//Distro is the distro suffix (el7, fc25)
+	Distro string
+
+	//Arch is the architecture embedded in RHEL-style release strings
+	Arch string
+}
+
+//InstalledKernel describes a kernel found on disk
+type InstalledKernel struct {
+	Version     *KernelVersion
+	ImagePath   string
+	ModulesPath string
+	Running     bool
+}
+
+//ParseKernelVersion parses upstream, Debian/Ubuntu and RHEL-style kernel
+//release strings
+func ParseKernelVersion(release string) (*KernelVersion, error) {
+	release = strings.TrimSpace(release)
+
+	needles := kernelVersionRegex.FindStringSubmatch(release)
+	if needles == nil {
+		return nil, ErrInvalidKernelVersion
+	}
+
+	kv := &KernelVersion{
+		Release: release,
+	}
+	kv.Major, _ = strconv.Atoi(needles[1])
+	kv.Minor, _ = strconv.Atoi(needles[2])
+	if len(needles[3]) > 0 {
+		kv.Patch, _ = strconv.Atoi(needles[3])
+	}
+
+	rest := needles[4]
+	if len(rest) == 0 {
+		return kv, nil
+	}
+
+	//upstream local version (4.9.0+ or 4.9.0+debug)
+	if rest[0] == '+' {
+		kv.Flavor = rest[1:]
+		return kv, nil
+	}
+	if rest[0] != '-' {
+		return nil, ErrInvalidKernelVersion
+	}
+	rest = rest[1:]
+
+	//RHEL 8 style debug kernels (4.18.0-80.el8.x86_64+debug)
+	if idx := strings.Index(rest, "+"); idx != -1 {
+		kv.Flavor = rest[idx+1:]
+		rest = rest[:idx]
+	}
+
+	//RHEL/Fedora: <abi>.<distro>[.<arch>][.<flavor>]
+	tokens := strings.Split(rest, ".")
+	for i, token := range tokens {
+		if !kernelDistroRegex.MatchString(token) {
+			continue
+		}
+		kv.ABI = strings.Join(tokens[:i], ".")
+		kv.Distro = token
+		for _, extra := range tokens[i+1:] {
+			if isKernelArch(extra) {
+				kv.Arch = extra
+			} else if len(kv.Flavor) == 0 {
+				kv.Flavor = extra
+			}
+		}
+		return kv, nil
+	}
+
+	//Debian/Ubuntu: <abi>-<flavor>
+	needles = kernelDebianRegex.FindStringSubmatch(rest)
+	if needles != nil {
+		kv.ABI = needles[1]
+		if len(needles[2]) > 0 {
+			kv.Flavor = needles[2]
+		}
+		return kv, nil
+	}
+
+	//upstream with an unknown suffix (4.9.0-rc1)
+	kv.Flavor = rest
+	return kv, nil
+}
+
+func isKernelArch(token string) bool {
+	for _, arch := range kernelArchs {
+		if token == arch {
+			return true
+		}
+	}
+	return false
+}
+
+func compareInt(a int, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareABI(a string, b string) int {
+	arr1 := strings.Split(a, ".")
+	arr2 := strings.Split(b, ".")
+	for i := 0; i < len(arr1) && i < len(arr2); i++ {
+		tok1, err1 := strconv.Atoi(arr1[i])
+		tok2, err2 := strconv.Atoi(arr2[i])
+		if err1 != nil || err2 != nil {
+			if cmp := strings.Compare(arr1[i], arr2[i]); cmp != 0 {
+				return cmp
+			}
+			continue
+		}
+		if cmp := compareInt(tok1, tok2); cmp != 0 {
+			return cmp
+		}
+	}
+	return compareInt(len(arr1), len(arr2))
+}
+
+//Compare returns -1, 0 or 1 if kv is lower, equal or higher than other. The
+//flavor, distro and arch are not taken into account.
+func (kv *KernelVersion) Compare(other *KernelVersion) int {
+	if cmp := compareInt(kv.Major, other.Major); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareInt(kv.Minor, other.Minor); cmp != 0 {
+		return cmp
+	}
+	if cmp := compareInt(kv.Patch, other.Patch); cmp != 0 {
+		return cmp
+	}
+	if len(kv.ABI) == 0 || len(other.ABI) == 0 {
+		return compareInt(len(kv.ABI), len(other.ABI))
+	}
+	return compareABI(kv.ABI, other.ABI)
+}
+
+//AtLeast returns true if the kernel is at least major.minor.patch
+func (kv *KernelVersion) AtLeast(major int, minor int, patch int) bool {
+	return kv.Compare(&KernelVersion{Major: major, Minor: minor, Patch: patch}) >= 0
+}
+
+//String returns the original release string
+func (kv *KernelVersion) String() string {
+	return kv.Release
+}
+
+type installedKernels []*InstalledKernel
+
+func (ik installedKernels) Len() int           { return len(ik) }
+func (ik installedKernels) Swap(i, j int)      { ik[i], ik[j] = ik[j], ik[i] }
+func (ik installedKernels) Less(i, j int) bool { return ik[i].Version.Compare(ik[j].Version) < 0 }
+
+//GetRunningKernel returns the parsed running kernel version
+func (sys *Sys) GetRunningKernel() (*KernelVersion, error) {
+	log.Debugln("GetRunningKernel ENTER")
+
+	release, err := sys.GetRunningKernelVersion()
+	if err != nil {
+		log.Debugln("GetRunningKernelVersion Failed:", err)
+		log.Debugln("GetRunningKernel LEAVE")
+		return nil, err
+	}
+
+	kv, err := ParseKernelVersion(release)
+	if err != nil {
+		log.Debugln("ParseKernelVersion Failed:", err)
+		log.Debugln("GetRunningKernel LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetRunningKernel LEAVE")
+	return kv, nil
+}
+
+func listInstalledKernels(bootDir string, modulesDir string, running string) ([]*InstalledKernel, error) {
+	found := make(map[string]*InstalledKernel)
+
+	images, err := filepath.Glob(filepath.Join(bootDir, "vmlinuz-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		release := strings.TrimPrefix(filepath.Base(image), "vmlinuz-")
+		kv, errParse := ParseKernelVersion(release)
+		if errParse != nil {
+			log.Debugln("Skipping image:", image)
+			continue
+		}
+		found[release] = &InstalledKernel{
+			Version:   kv,
+			ImagePath: image,
+		}
+	}
+
+	entries, err := ioutil.ReadDir(modulesDir)
+	if err != nil {
+		log.Debugln("ReadDir Failed:", err)
+		entries = nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		release := entry.Name()
+		kernel, ok := found[release]
+		if !ok {
+			kv, errParse := ParseKernelVersion(release)
+			if errParse != nil {
+				log.Debugln("Skipping modules:", release)
+				continue
+			}
+			kernel = &InstalledKernel{
+				Version: kv,
+			}
+			found[release] = kernel
+		}
+		kernel.ModulesPath = filepath.Join(modulesDir, release)
+	}
+
+	list := make(installedKernels, 0, len(found))
+	for release, kernel := range found {
+		kernel.Running = release == running
+		list = append(list, kernel)
+	}
+	sort.Sort(list)
+
+	return list, nil
+}
+
+//GetInstalledKernels returns the kernels found in /boot and /lib/modules
+//sorted from lowest to highest version
+func (sys *Sys) GetInstalledKernels() ([]*InstalledKernel, error) {
+	log.Debugln("GetInstalledKernels ENTER")
+
+	running, err := sys.GetRunningKernelVersion()
+	if err != nil {
+		log.Debugln("GetRunningKernelVersion Failed:", err)
+		log.Debugln("GetInstalledKernels LEAVE")
+		return nil, err
+	}
+
+	list, err := listInstalledKernels(defaultBootDir, defaultModulesDir, running)
+	if err != nil {
+		log.Debugln("listInstalledKernels Failed:", err)
+		log.Debugln("GetInstalledKernels LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetInstalledKernels Count:", len(list))
+	log.Debugln("GetInstalledKernels LEAVE")
+	return list, nil
+}
+
+func newestBootableKernel(list []*InstalledKernel) *InstalledKernel {
+	var newest *InstalledKernel
+	for _, kernel := range list {
+		if len(kernel.ImagePath) == 0 {
+			continue
+		}
+		if newest == nil || kernel.Version.Compare(newest.Version) > 0 {
+			newest = kernel
+		}
+	}
+	return newest
+}
+
+//IsKernelRebootPending returns true and the newer kernel if a kernel newer
+//than the running one is installed but not booted
+func (sys *Sys) IsKernelRebootPending() (bool, *KernelVersion, error) {
+	log.Debugln("IsKernelRebootPending ENTER")
+
+	running, err := sys.GetRunningKernel()
+	if err != nil {
+		log.Debugln("GetRunningKernel Failed:", err)
+		log.Debugln("IsKernelRebootPending LEAVE")
+		return false, nil, err
+	}
+
+	list, err := listInstalledKernels(defaultBootDir, defaultModulesDir, running.Release)
+	if err != nil {
+		log.Debugln("listInstalledKernels Failed:", err)
+		log.Debugln("IsKernelRebootPending LEAVE")
+		return false, nil, err
+	}
+
+	newest := newestBootableKernel(list)
+	if newest == nil || newest.Version.Compare(running) <= 0 {
+		log.Debugln("IsKernelRebootPending = FALSE")
+		log.Debugln("IsKernelRebootPending LEAVE")
+		return false, nil, nil
+	}
+
+	log.Debugln("IsKernelRebootPending = TRUE. Newer:", newest.Version)
+	log.Debugln("IsKernelRebootPending LEAVE")
+	return true, newest.Version, nil
+}
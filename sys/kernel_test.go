@@ -0,0 +1,93 @@
+package sys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestParseKernelVersionUpstream(t *testing.T) {
+	kv, err := ParseKernelVersion("4.9.0")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, kv.Major)
+	assert.Equal(t, 9, kv.Minor)
+	assert.Equal(t, 0, kv.Patch)
+	assert.Equal(t, "", kv.ABI)
+}
+
+func TestParseKernelVersionUbuntu(t *testing.T) {
+	kv, err := ParseKernelVersion("4.4.0-21-generic")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, kv.Major)
+	assert.Equal(t, 4, kv.Minor)
+	assert.Equal(t, "21", kv.ABI)
+	assert.Equal(t, "generic", kv.Flavor)
+}
+
+func TestParseKernelVersionDebian(t *testing.T) {
+	kv, err := ParseKernelVersion("3.16.0-4-rt-amd64")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 16, kv.Minor)
+	assert.Equal(t, "4", kv.ABI)
+	assert.Equal(t, "rt-amd64", kv.Flavor)
+}
+
+func TestParseKernelVersionRhel(t *testing.T) {
+	kv, err := ParseKernelVersion("3.10.0-514.10.2.el7.x86_64")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, kv.Major)
+	assert.Equal(t, 10, kv.Minor)
+	assert.Equal(t, "514.10.2", kv.ABI)
+	assert.Equal(t, "el7", kv.Distro)
+	assert.Equal(t, "x86_64", kv.Arch)
+
+	kv, err = ParseKernelVersion("4.18.0-80.el8.x86_64+debug")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "80", kv.ABI)
+	assert.Equal(t, "el8", kv.Distro)
+	assert.Equal(t, "debug", kv.Flavor)
+}
+
+func TestParseKernelVersionInvalid(t *testing.T) {
+	_, err := ParseKernelVersion("linux")
+	assert.Equal(t, ErrInvalidKernelVersion, err)
+}
+
+func TestCompareKernelVersion(t *testing.T) {
+	kv1, _ := ParseKernelVersion("3.10.0-514.el7.x86_64")
+	kv2, _ := ParseKernelVersion("3.10.0-514.10.2.el7.x86_64")
+	kv3, _ := ParseKernelVersion("4.4.0-21-generic")
+	assert.Equal(t, -1, kv1.Compare(kv2))
+	assert.Equal(t, 1, kv3.Compare(kv2))
+	assert.Equal(t, 0, kv3.Compare(kv3))
+	assert.True(t, kv3.AtLeast(4, 4, 0))
+	assert.False(t, kv1.AtLeast(4, 9, 0))
+}
+
+func TestListInstalledKernels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kernels")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	bootDir := filepath.Join(dir, "boot")
+	modulesDir := filepath.Join(dir, "modules")
+	os.MkdirAll(bootDir, 0755)
+	os.MkdirAll(filepath.Join(modulesDir, "4.4.0-21-generic"), 0755)
+	os.MkdirAll(filepath.Join(modulesDir, "4.4.0-31-generic"), 0755)
+	ioutil.WriteFile(filepath.Join(bootDir, "vmlinuz-4.4.0-21-generic"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(bootDir, "vmlinuz-4.4.0-31-generic"), nil, 0644)
+
+	list, err := listInstalledKernels(bootDir, modulesDir, "4.4.0-21-generic")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "21", list[0].Version.ABI)
+	assert.True(t, list[0].Running)
+	assert.False(t, list[1].Running)
+	assert.Equal(t, filepath.Join(modulesDir, "4.4.0-31-generic"), list[1].ModulesPath)
+
+	newest := newestBootableKernel(list)
+	assert.Equal(t, "4.4.0-31-generic", newest.Version.Release)
+}
@@ -0,0 +1,166 @@
+package sys
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+)
+
+var (
+	machineIDFiles   = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+	productUUIDFiles = []string{"/sys/class/dmi/id/product_uuid"}
+)
+
+//normalizeMachineID returns the 32 lowercase hex character form of id or an
+//empty string if id is not usable
+func normalizeMachineID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	id = strings.Replace(id, "-", "", -1)
+	if len(id) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return ""
+	}
+	if id == strings.Repeat("0", 32) || id == strings.Repeat("f", 32) {
+		return ""
+	}
+	return id
+}
+
+func readMachineID(paths []string) (string, string) {
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Debugln("Unable to read", path, "Err:", err)
+			continue
+		}
+		id := normalizeMachineID(string(data))
+		if len(id) == 0 {
+			log.Debugln("Invalid machine ID in", path)
+			continue
+		}
+		return id, path
+	}
+	return "", ""
+}
+
+func generateMachineID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	//mark as a v4 UUID like systemd does
+	buf[6] = (buf[6] & 0x0f) | 0x40
+	buf[8] = (buf[8] & 0x3f) | 0x80
+	return hex.EncodeToString(buf), nil
+}
+
+func persistMachineID(paths []string, id string) (string, error) {
+	var lastErr error
+	for _, path := range paths {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = fs.NewFs().WriteFileAtomic(path, []byte(id+"\n"), 0444)
+		}
+		if err != nil {
+			log.Debugln("Unable to persist machine ID to", path, "Err:", err)
+			lastErr = err
+			continue
+		}
+		return path, nil
+	}
+	return "", lastErr
+}
+
+func formatUUID(id []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+//deriveAppMachineID hashes the machine ID with the application ID so the raw
+//machine ID cannot be recovered from the result
+func deriveAppMachineID(machineID string, appID string) (string, error) {
+	key, err := hex.DecodeString(machineID)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(appID))
+	sum := mac.Sum(nil)[:16]
+
+	sum[6] = (sum[6] & 0x0f) | 0x40
+	sum[8] = (sum[8] & 0x3f) | 0x80
+
+	return formatUUID(sum), nil
+}
+
+//MachineID returns a stable identifier for this host as 32 hex characters.
+//It is read from /etc/machine-id, /var/lib/dbus/machine-id or the DMI product
+//UUID. If none are available, one is generated and persisted.
+func (sys *Sys) MachineID() (string, error) {
+	log.Debugln("MachineID ENTER")
+
+	id, path := readMachineID(machineIDFiles)
+	if len(id) == 0 {
+		id, path = readMachineID(productUUIDFiles)
+	}
+	if len(id) > 0 {
+		log.Debugln("MachineID found in", path)
+		log.Debugln("MachineID LEAVE")
+		return id, nil
+	}
+
+	id, err := generateMachineID()
+	if err != nil {
+		log.Errorln("generateMachineID Failed:", err)
+		log.Debugln("MachineID LEAVE")
+		return "", ErrMachineIDNotFound
+	}
+
+	path, err = persistMachineID(machineIDFiles, id)
+	if err != nil {
+		log.Errorln("persistMachineID Failed:", err)
+		log.Debugln("MachineID LEAVE")
+		return "", ErrMachineIDNotFound
+	}
+
+	log.Infoln("Generated machine ID persisted to", path)
+	log.Debugln("MachineID LEAVE")
+	return id, nil
+}
+
+//AppMachineID returns a UUID that is stable for this host and application
+//but does not leak the raw machine ID
+func (sys *Sys) AppMachineID(appID string) (string, error) {
+	log.Debugln("AppMachineID ENTER")
+	log.Debugln("appID:", appID)
+
+	machineID, err := sys.MachineID()
+	if err != nil {
+		log.Debugln("MachineID Failed:", err)
+		log.Debugln("AppMachineID LEAVE")
+		return "", err
+	}
+
+	id, err := deriveAppMachineID(machineID, appID)
+	if err != nil {
+		log.Debugln("deriveAppMachineID Failed:", err)
+		log.Debugln("AppMachineID LEAVE")
+		return "", err
+	}
+
+	log.Debugln("AppMachineID =", id)
+	log.Debugln("AppMachineID LEAVE")
+	return id, nil
+}
@@ -0,0 +1,56 @@
+package sys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeMachineID(t *testing.T) {
+	assert.Equal(t, "4c4c4544004b3610804bb4c04f4e3232", normalizeMachineID("4C4C4544-004B-3610-804B-B4C04F4E3232\n"))
+	assert.Equal(t, "", normalizeMachineID("00000000-0000-0000-0000-000000000000"))
+	assert.Equal(t, "", normalizeMachineID("uninitialized"))
+}
+
+func TestReadPersistMachineID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machineid")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	paths := []string{filepath.Join(dir, "etc", "machine-id"), filepath.Join(dir, "dbus", "machine-id")}
+	assert.Equal(t, nil, os.MkdirAll(filepath.Dir(paths[1]), 0755))
+	assert.Equal(t, nil, ioutil.WriteFile(paths[1], []byte("\n"), 0444))
+
+	id, _ := readMachineID(paths)
+	assert.Equal(t, "", id)
+
+	generated, err := generateMachineID()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, generated, normalizeMachineID(generated))
+
+	path, err := persistMachineID(paths, generated)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, paths[0], path)
+
+	id, path = readMachineID(paths)
+	assert.Equal(t, generated, id)
+	assert.Equal(t, paths[0], path)
+}
+
+func TestDeriveAppMachineID(t *testing.T) {
+	machineID := "4c4c4544004b3610804bb4c04f4e3232"
+
+	id1, err := deriveAppMachineID(machineID, "app1")
+	assert.Equal(t, nil, err)
+	id2, _ := deriveAppMachineID(machineID, "app1")
+	id3, _ := deriveAppMachineID(machineID, "app2")
+
+	assert.Equal(t, id1, id2)
+	assert.NotEqual(t, id1, id3)
+	assert.Equal(t, 36, len(id1))
+	assert.False(t, strings.Contains(strings.Replace(id1, "-", "", -1), machineID))
+}
@@ -0,0 +1,333 @@
+package sys
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	defaultCPUInfoFile = "/proc/cpuinfo"
+	defaultMemInfoFile = "/proc/meminfo"
+	defaultLoadAvgFile = "/proc/loadavg"
+	defaultUptimeFile  = "/proc/uptime"
+	defaultBootIDFile  = "/proc/sys/kernel/random/boot_id"
+)
+
+//CPUInfo summarizes /proc/cpuinfo
+type CPUInfo struct {
+	//Count is the number of logical processors
+	Count int
+
+	//Sockets is the number of physical packages
+	Sockets int
+
+	Vendor string
+	Model  string
+	Flags  []string
+}
+
+//HasFlag returns true if the processor reports the given flag (vmx, avx2)
+func (ci *CPUInfo) HasFlag(flag string) bool {
+	for _, f := range ci.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+//MemInfo summarizes /proc/meminfo. All values are in bytes.
+type MemInfo struct {
+	TotalBytes     uint64
+	FreeBytes      uint64
+	AvailableBytes uint64
+	BuffersBytes   uint64
+	CachedBytes    uint64
+	SwapTotalBytes uint64
+	SwapFreeBytes  uint64
+}
+
+//LoadAvg is the content of /proc/loadavg
+type LoadAvg struct {
+	Load1  float64
+	Load5  float64
+	Load15 float64
+
+	RunningProcs int
+	TotalProcs   int
+}
+
+func splitProcLine(line string) (string, string, bool) {
+	idx := strings.Index(line, ":")
+	if idx == -1 {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:]), true
+}
+
+func readCPUInfo(path string) (*CPUInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ci := &CPUInfo{}
+	sockets := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := splitProcLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "processor":
+			if _, err := strconv.Atoi(value); err == nil {
+				ci.Count++
+			}
+		case "Processor":
+			//older ARM kernels put the model in "Processor"
+			if len(ci.Model) == 0 {
+				ci.Model = value
+			}
+		case "physical id":
+			sockets[value] = true
+		case "vendor_id":
+			if len(ci.Vendor) == 0 {
+				ci.Vendor = value
+			}
+		case "model name", "cpu model":
+			if len(ci.Model) == 0 {
+				ci.Model = value
+			}
+		case "flags", "Features":
+			if len(ci.Flags) == 0 {
+				ci.Flags = strings.Fields(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	ci.Sockets = len(sockets)
+	if ci.Sockets == 0 && ci.Count > 0 {
+		ci.Sockets = 1
+	}
+
+	return ci, nil
+}
+
+func readMemInfo(path string) (*MemInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := splitProcLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		num, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			log.Debugln("Skipping meminfo key:", key)
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			num *= 1024
+		}
+		values[key] = num
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := values["MemTotal"]; !ok {
+		return nil, ErrInvalidProcFile
+	}
+
+	mi := &MemInfo{
+		TotalBytes:     values["MemTotal"],
+		FreeBytes:      values["MemFree"],
+		BuffersBytes:   values["Buffers"],
+		CachedBytes:    values["Cached"],
+		SwapTotalBytes: values["SwapTotal"],
+		SwapFreeBytes:  values["SwapFree"],
+	}
+
+	//MemAvailable only exists on 3.14+ kernels
+	if available, ok := values["MemAvailable"]; ok {
+		mi.AvailableBytes = available
+	} else {
+		mi.AvailableBytes = mi.FreeBytes + mi.BuffersBytes + mi.CachedBytes
+	}
+
+	return mi, nil
+}
+
+func readLoadAvg(path string) (*LoadAvg, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 {
+		return nil, ErrInvalidProcFile
+	}
+
+	la := &LoadAvg{}
+	loads := []*float64{&la.Load1, &la.Load5, &la.Load15}
+	for i, load := range loads {
+		*load, err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, ErrInvalidProcFile
+		}
+	}
+
+	procs := strings.Split(fields[3], "/")
+	if len(procs) != 2 {
+		return nil, ErrInvalidProcFile
+	}
+	la.RunningProcs, err = strconv.Atoi(procs[0])
+	if err != nil {
+		return nil, ErrInvalidProcFile
+	}
+	la.TotalProcs, err = strconv.Atoi(procs[1])
+	if err != nil {
+		return nil, ErrInvalidProcFile
+	}
+
+	return la, nil
+}
+
+func readUptime(path string) (time.Duration, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 1 {
+		return 0, ErrInvalidProcFile
+	}
+
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, ErrInvalidProcFile
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func readBootID(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	bootID := strings.TrimSpace(string(data))
+	if len(bootID) == 0 {
+		return "", ErrInvalidProcFile
+	}
+
+	return bootID, nil
+}
+
+//GetCPUInfo returns the processor count, model and flags
+func (sys *Sys) GetCPUInfo() (*CPUInfo, error) {
+	log.Debugln("GetCPUInfo ENTER")
+
+	ci, err := readCPUInfo(defaultCPUInfoFile)
+	if err != nil {
+		log.Debugln("readCPUInfo Failed:", err)
+		log.Debugln("GetCPUInfo LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetCPUInfo Count:", ci.Count, "Model:", ci.Model)
+	log.Debugln("GetCPUInfo LEAVE")
+	return ci, nil
+}
+
+//GetMemInfo returns the memory and swap totals
+func (sys *Sys) GetMemInfo() (*MemInfo, error) {
+	log.Debugln("GetMemInfo ENTER")
+
+	mi, err := readMemInfo(defaultMemInfoFile)
+	if err != nil {
+		log.Debugln("readMemInfo Failed:", err)
+		log.Debugln("GetMemInfo LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetMemInfo Total:", mi.TotalBytes, "Available:", mi.AvailableBytes)
+	log.Debugln("GetMemInfo LEAVE")
+	return mi, nil
+}
+
+//GetLoadAvg returns the 1, 5 and 15 minute load averages
+func (sys *Sys) GetLoadAvg() (*LoadAvg, error) {
+	log.Debugln("GetLoadAvg ENTER")
+
+	la, err := readLoadAvg(defaultLoadAvgFile)
+	if err != nil {
+		log.Debugln("readLoadAvg Failed:", err)
+		log.Debugln("GetLoadAvg LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetLoadAvg:", la.Load1, la.Load5, la.Load15)
+	log.Debugln("GetLoadAvg LEAVE")
+	return la, nil
+}
+
+//GetUptime returns how long the system has been up
+func (sys *Sys) GetUptime() (time.Duration, error) {
+	log.Debugln("GetUptime ENTER")
+
+	uptime, err := readUptime(defaultUptimeFile)
+	if err != nil {
+		log.Debugln("readUptime Failed:", err)
+		log.Debugln("GetUptime LEAVE")
+		return 0, err
+	}
+
+	log.Debugln("GetUptime =", uptime)
+	log.Debugln("GetUptime LEAVE")
+	return uptime, nil
+}
+
+//GetBootID returns the random ID the kernel generated for the current boot
+func (sys *Sys) GetBootID() (string, error) {
+	log.Debugln("GetBootID ENTER")
+
+	bootID, err := readBootID(defaultBootIDFile)
+	if err != nil {
+		log.Debugln("readBootID Failed:", err)
+		log.Debugln("GetBootID LEAVE")
+		return "", err
+	}
+
+	log.Debugln("GetBootID =", bootID)
+	log.Debugln("GetBootID LEAVE")
+	return bootID, nil
+}
@@ -0,0 +1,59 @@
+package sys
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestReadCPUInfo(t *testing.T) {
+	ci, err := readCPUInfo("testdata/proc/cpuinfo")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, ci.Count)
+	assert.Equal(t, 1, ci.Sockets)
+	assert.Equal(t, "GenuineIntel", ci.Vendor)
+	assert.Equal(t, "Intel(R) Xeon(R) CPU E5-2676 v3 @ 2.40GHz", ci.Model)
+	assert.True(t, ci.HasFlag("avx2"))
+	assert.False(t, ci.HasFlag("vmx"))
+
+	ci, err = readCPUInfo("testdata/proc/cpuinfo-arm")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, ci.Count)
+	assert.Equal(t, "ARMv7 Processor rev 10 (v7l)", ci.Model)
+	assert.True(t, ci.HasFlag("neon"))
+}
+
+func TestReadMemInfo(t *testing.T) {
+	mi, err := readMemInfo("testdata/proc/meminfo")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(8175444*1024), mi.TotalBytes)
+	assert.Equal(t, uint64(6552636*1024), mi.AvailableBytes)
+	assert.Equal(t, uint64(2097148*1024), mi.SwapTotalBytes)
+
+	mi, err = readMemInfo("testdata/proc/meminfo-old")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64((102400+51200+204800)*1024), mi.AvailableBytes)
+	assert.Equal(t, uint64(0), mi.SwapTotalBytes)
+}
+
+func TestReadLoadAvg(t *testing.T) {
+	la, err := readLoadAvg("testdata/proc/loadavg")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0.52, la.Load1)
+	assert.Equal(t, 0.59, la.Load15)
+	assert.Equal(t, 2, la.RunningProcs)
+	assert.Equal(t, 467, la.TotalProcs)
+}
+
+func TestReadUptime(t *testing.T) {
+	uptime, err := readUptime("testdata/proc/uptime")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 350735*time.Second, uptime.Truncate(time.Second))
+}
+
+func TestReadBootID(t *testing.T) {
+	bootID, err := readBootID("testdata/proc/boot_id")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "f8a7c1d2-5b2e-4d36-9a3e-5f0e3d9c1b42", bootID)
+}
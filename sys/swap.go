@@ -0,0 +1,536 @@
+package sys
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+)
+
+const (
+	defaultProcSwapsFile = "/proc/swaps"
+	swapSignature        = "SWAPSPACE2"
+)
+
+var (
+	swapPathRegex = regexp.MustCompile("^/[a-zA-Z0-9/_.:+@,=\\-]*$")
+
+	swapSourceDirs = map[string]string{
+		"UUID=":      "/dev/disk/by-uuid",
+		"LABEL=":     "/dev/disk/by-label",
+		"PARTUUID=":  "/dev/disk/by-partuuid",
+		"PARTLABEL=": "/dev/disk/by-partlabel",
+	}
+)
+
+//SwapDevice is an active swap file or partition from /proc/swaps
+type SwapDevice struct {
+	Filename  string
+	Type      string
+	SizeBytes uint64
+	UsedBytes uint64
+	Priority  int
+}
+
+//SwapPolicy is the swap configuration a host is expected to have
+type SwapPolicy struct {
+	//Enabled requires swap to be active. When false no swap may be active.
+	Enabled bool
+
+	//MinSizeBytes is the minimum total active swap when Enabled is true
+	MinSizeBytes uint64
+
+	//Persistent also checks /etc/fstab so the configuration survives a reboot
+	Persistent bool
+}
+
+//SwapReport describes how the host's swap configuration compares to a
+//SwapPolicy
+type SwapReport struct {
+	Compliant  bool
+	Active     []*SwapDevice
+	TotalBytes uint64
+
+	//Configured are the swap entries in /etc/fstab
+	Configured []*fs.FstabEntry
+
+	//Violations explain why the host is not compliant
+	Violations []string
+}
+
+//unescapeProcPath decodes the octal escapes the kernel uses for whitespace
+//and backslashes in /proc paths
+func unescapeProcPath(path string) string {
+	if !strings.Contains(path, "\\") {
+		return path
+	}
+
+	out := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if val, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				out = append(out, byte(val))
+				i += 3
+				continue
+			}
+		}
+		out = append(out, path[i])
+	}
+	return string(out)
+}
+
+func readSwaps(path string) ([]*SwapDevice, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := []*SwapDevice{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] == "Filename" {
+			continue
+		}
+
+		size, errSize := strconv.ParseUint(fields[2], 10, 64)
+		used, errUsed := strconv.ParseUint(fields[3], 10, 64)
+		priority, errPriority := strconv.Atoi(fields[4])
+		if errSize != nil || errUsed != nil || errPriority != nil {
+			return nil, ErrInvalidProcFile
+		}
+
+		list = append(list, &SwapDevice{
+			Filename:  unescapeProcPath(fields[0]),
+			Type:      fields[1],
+			SizeBytes: size * 1024,
+			UsedBytes: used * 1024,
+			Priority:  priority,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+//hasSwapSignature returns true if mkswap has initialized the file
+func hasSwapSignature(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, len(swapSignature))
+	_, err = file.ReadAt(buf, int64(os.Getpagesize()-len(swapSignature)))
+	return err == nil && string(buf) == swapSignature
+}
+
+//writeZeroFile creates path with sizeBytes of zeros. swapon rejects files
+//with holes so the blocks are written rather than truncated or fallocated.
+func writeZeroFile(path string, sizeBytes uint64) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1024*1024)
+	for remaining := sizeBytes; remaining > 0 && err == nil; {
+		chunk := uint64(len(buf))
+		if remaining < chunk {
+			chunk = remaining
+		}
+		_, err = file.Write(buf[:chunk])
+		remaining -= chunk
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+//resolveSwapSource returns the device or file an fstab swap source refers
+//to with symlinks resolved
+func resolveSwapSource(source string) string {
+	for prefix, dir := range swapSourceDirs {
+		if strings.HasPrefix(source, prefix) {
+			source = filepath.Join(dir, strings.Trim(strings.TrimPrefix(source, prefix), "\""))
+			break
+		}
+	}
+	if real, err := filepath.EvalSymlinks(source); err == nil {
+		return real
+	}
+	return source
+}
+
+func fstabSwapEntries(entries []*fs.FstabEntry) []*fs.FstabEntry {
+	list := []*fs.FstabEntry{}
+	for _, entry := range entries {
+		if entry.IsSwap() {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+func hasOption(options string, name string) bool {
+	for _, opt := range strings.Split(options, ",") {
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
+//evaluateSwapPolicy compares the active and configured swap to the policy
+func evaluateSwapPolicy(policy *SwapPolicy, active []*SwapDevice, configured []*fs.FstabEntry,
+	resolve func(string) string) *SwapReport {
+	report := &SwapReport{
+		Active:     active,
+		Configured: configured,
+		Violations: []string{},
+	}
+	for _, dev := range active {
+		report.TotalBytes += dev.SizeBytes
+	}
+
+	if !policy.Enabled {
+		for _, dev := range active {
+			report.Violations = append(report.Violations, "Swap is active on "+dev.Filename)
+		}
+		if policy.Persistent {
+			for _, entry := range configured {
+				if !hasOption(entry.Options, "noauto") {
+					report.Violations = append(report.Violations, "fstab enables swap on "+entry.Source)
+				}
+			}
+		}
+		report.Compliant = len(report.Violations) == 0
+		return report
+	}
+
+	if len(active) == 0 {
+		report.Violations = append(report.Violations, "No swap is active")
+	}
+	if report.TotalBytes < policy.MinSizeBytes {
+		report.Violations = append(report.Violations,
+			fmt.Sprintf("Active swap is %d bytes but %d are required", report.TotalBytes, policy.MinSizeBytes))
+	}
+	if policy.Persistent {
+		persisted := make(map[string]bool)
+		for _, entry := range configured {
+			if !hasOption(entry.Options, "noauto") {
+				persisted[resolve(entry.Source)] = true
+			}
+		}
+		for _, dev := range active {
+			//zram swap is set up by its own generator rather than fstab
+			if strings.HasPrefix(dev.Filename, "/dev/zram") {
+				continue
+			}
+			if !persisted[resolve(dev.Filename)] {
+				report.Violations = append(report.Violations, dev.Filename+" is not in fstab")
+			}
+		}
+	}
+
+	report.Compliant = len(report.Violations) == 0
+	return report
+}
+
+func (sys *Sys) isSwapActive(path string) (bool, error) {
+	active, err := readSwaps(defaultProcSwapsFile)
+	if err != nil {
+		return false, err
+	}
+	target := resolveSwapSource(path)
+	for _, dev := range active {
+		if resolveSwapSource(dev.Filename) == target {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (sys *Sys) runSwapCommand(cmdLine string) error {
+	output, status, err := sys.run.CommandOutputStatus(cmdLine)
+	if err == nil && status != 0 {
+		log.Errorln("Command failed:", cmdLine, "Output:", output)
+		err = ErrSwapFailed
+	}
+	return err
+}
+
+//GetSwaps returns the active swap files and partitions
+func (sys *Sys) GetSwaps() ([]*SwapDevice, error) {
+	log.Debugln("GetSwaps ENTER")
+
+	list, err := readSwaps(defaultProcSwapsFile)
+	if err != nil {
+		log.Debugln("readSwaps Failed:", err)
+		log.Debugln("GetSwaps LEAVE")
+		return nil, err
+	}
+
+	log.Debugln("GetSwaps Count:", len(list))
+	log.Debugln("GetSwaps LEAVE")
+	return list, nil
+}
+
+//CreateSwapFile creates a swap file of sizeBytes readable only by root and
+//initializes it with mkswap. An existing swap file of the same size is kept
+//and has its permissions corrected. Any other existing file is never
+//overwritten and returns ErrSwapFileExists. Returns true if the file was
+//created.
+func (sys *Sys) CreateSwapFile(path string, sizeBytes uint64) (bool, error) {
+	log.Debugln("CreateSwapFile ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("sizeBytes:", sizeBytes)
+
+	if !swapPathRegex.MatchString(path) {
+		log.Debugln("Invalid path")
+		log.Debugln("CreateSwapFile LEAVE")
+		return false, ErrInvalidSwapPath
+	}
+
+	info, err := os.Stat(path)
+	if err == nil {
+		//only a file made by this call is safe to mkswap, anything else may
+		//hold data
+		if !info.Mode().IsRegular() || uint64(info.Size()) != sizeBytes || !hasSwapSignature(path) {
+			log.Debugln("File exists and is not a swap file of size:", sizeBytes)
+			log.Debugln("CreateSwapFile LEAVE")
+			return false, ErrSwapFileExists
+		}
+		err = sys.fs.JournalSnapshot(path)
+		if err == nil {
+			err = os.Chmod(path, 0600)
+		}
+		if err != nil {
+			log.Debugln("Chmod Failed:", err)
+			log.Debugln("CreateSwapFile LEAVE")
+			return false, err
+		}
+		log.Debugln("Swap file already exists")
+		log.Debugln("CreateSwapFile LEAVE")
+		return false, nil
+	}
+
+	err = sys.fs.JournalSnapshot(path)
+	if err != nil {
+		log.Debugln("JournalSnapshot Failed:", err)
+		log.Debugln("CreateSwapFile LEAVE")
+		return false, err
+	}
+
+	err = writeZeroFile(path, sizeBytes)
+	if err != nil {
+		os.Remove(path)
+		log.Debugln("writeZeroFile Failed:", err)
+		log.Debugln("CreateSwapFile LEAVE")
+		return false, err
+	}
+
+	err = sys.runSwapCommand("mkswap " + path)
+	if err != nil {
+		os.Remove(path)
+		log.Debugln("mkswap Failed:", err)
+		log.Debugln("CreateSwapFile LEAVE")
+		return false, err
+	}
+
+	log.Debugln("CreateSwapFile created")
+	log.Debugln("CreateSwapFile LEAVE")
+	return true, nil
+}
+
+//EnableSwap activates the swap file or partition and, if persist is true,
+//adds it to /etc/fstab. Returns true if anything was changed.
+func (sys *Sys) EnableSwap(path string, persist bool) (bool, error) {
+	log.Debugln("EnableSwap ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("persist:", persist)
+
+	if !swapPathRegex.MatchString(path) {
+		log.Debugln("Invalid path")
+		log.Debugln("EnableSwap LEAVE")
+		return false, ErrInvalidSwapPath
+	}
+
+	active, err := sys.isSwapActive(path)
+	if err != nil {
+		log.Debugln("isSwapActive Failed:", err)
+		log.Debugln("EnableSwap LEAVE")
+		return false, err
+	}
+
+	changed := false
+	if !active {
+		if info, errStat := os.Stat(path); errStat == nil && info.Mode().IsRegular() && info.Mode().Perm() != 0600 {
+			os.Chmod(path, 0600)
+		}
+		err = sys.runSwapCommand("swapon " + path)
+		if err != nil {
+			log.Debugln("swapon Failed:", err)
+			log.Debugln("EnableSwap LEAVE")
+			return false, err
+		}
+		changed = true
+	}
+
+	if persist {
+		persisted, errFstab := sys.fs.EnsureFstabEntry(&fs.FstabEntry{
+			Source:     path,
+			MountPoint: "none",
+			FsType:     "swap",
+			Options:    "defaults",
+		})
+		if errFstab != nil {
+			log.Debugln("EnsureFstabEntry Failed:", errFstab)
+			log.Debugln("EnableSwap LEAVE")
+			return changed, errFstab
+		}
+		changed = changed || persisted
+	}
+
+	log.Debugln("EnableSwap changed:", changed)
+	log.Debugln("EnableSwap LEAVE")
+	return changed, nil
+}
+
+//DisableSwap deactivates the swap file or partition and, if persist is true,
+//removes it from /etc/fstab. Returns true if anything was changed.
+func (sys *Sys) DisableSwap(path string, persist bool) (bool, error) {
+	log.Debugln("DisableSwap ENTER")
+	log.Debugln("path:", path)
+	log.Debugln("persist:", persist)
+
+	if !swapPathRegex.MatchString(path) {
+		log.Debugln("Invalid path")
+		log.Debugln("DisableSwap LEAVE")
+		return false, ErrInvalidSwapPath
+	}
+
+	active, err := sys.isSwapActive(path)
+	if err != nil {
+		log.Debugln("isSwapActive Failed:", err)
+		log.Debugln("DisableSwap LEAVE")
+		return false, err
+	}
+
+	changed := false
+	if active {
+		err = sys.runSwapCommand("swapoff " + path)
+		if err != nil {
+			log.Debugln("swapoff Failed:", err)
+			log.Debugln("DisableSwap LEAVE")
+			return false, err
+		}
+		changed = true
+	}
+
+	if persist {
+		removed, errFstab := sys.fs.RemoveFstabEntry(&fs.FstabEntry{Source: path, FsType: "swap"})
+		if errFstab != nil {
+			log.Debugln("RemoveFstabEntry Failed:", errFstab)
+			log.Debugln("DisableSwap LEAVE")
+			return changed, errFstab
+		}
+		changed = changed || removed
+	}
+
+	log.Debugln("DisableSwap changed:", changed)
+	log.Debugln("DisableSwap LEAVE")
+	return changed, nil
+}
+
+//DisableAllSwap deactivates every swap area and, if persist is true, removes
+//every swap entry from /etc/fstab. Returns true if anything was changed.
+func (sys *Sys) DisableAllSwap(persist bool) (bool, error) {
+	log.Debugln("DisableAllSwap ENTER")
+	log.Debugln("persist:", persist)
+
+	active, err := readSwaps(defaultProcSwapsFile)
+	if err != nil {
+		log.Debugln("readSwaps Failed:", err)
+		log.Debugln("DisableAllSwap LEAVE")
+		return false, err
+	}
+
+	changed := false
+	if len(active) > 0 {
+		err = sys.runSwapCommand("swapoff -a")
+		if err != nil {
+			log.Debugln("swapoff Failed:", err)
+			log.Debugln("DisableAllSwap LEAVE")
+			return false, err
+		}
+		changed = true
+	}
+
+	if persist {
+		entries, errFstab := sys.fs.GetFstabEntries()
+		if errFstab != nil {
+			log.Debugln("GetFstabEntries Failed:", errFstab)
+			log.Debugln("DisableAllSwap LEAVE")
+			return changed, errFstab
+		}
+		for _, entry := range fstabSwapEntries(entries) {
+			removed, errRemove := sys.fs.RemoveFstabEntry(entry)
+			if errRemove != nil {
+				log.Debugln("RemoveFstabEntry Failed:", errRemove)
+				log.Debugln("DisableAllSwap LEAVE")
+				return changed, errRemove
+			}
+			changed = changed || removed
+		}
+	}
+
+	log.Debugln("DisableAllSwap changed:", changed)
+	log.Debugln("DisableAllSwap LEAVE")
+	return changed, nil
+}
+
+//CheckSwapPolicy reports whether the active swap, and the fstab entries when
+//the policy is persistent, match the policy
+func (sys *Sys) CheckSwapPolicy(policy *SwapPolicy) (*SwapReport, error) {
+	log.Debugln("CheckSwapPolicy ENTER")
+	log.Debugln("policy:", *policy)
+
+	active, err := readSwaps(defaultProcSwapsFile)
+	if err != nil {
+		log.Debugln("readSwaps Failed:", err)
+		log.Debugln("CheckSwapPolicy LEAVE")
+		return nil, err
+	}
+
+	entries, err := sys.fs.GetFstabEntries()
+	if err != nil {
+		log.Debugln("GetFstabEntries Failed:", err)
+		log.Debugln("CheckSwapPolicy LEAVE")
+		return nil, err
+	}
+
+	report := evaluateSwapPolicy(policy, active, fstabSwapEntries(entries), resolveSwapSource)
+
+	log.Debugln("CheckSwapPolicy Compliant:", report.Compliant)
+	for _, violation := range report.Violations {
+		log.Debugln("Violation:", violation)
+	}
+	log.Debugln("CheckSwapPolicy LEAVE")
+	return report, nil
+}
@@ -0,0 +1,83 @@
+package sys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+)
+
+func TestReadSwaps(t *testing.T) {
+	swaps, err := readSwaps("testdata/proc/swaps")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(swaps))
+	assert.Equal(t, "/dev/dm-1", swaps[0].Filename)
+	assert.Equal(t, "partition", swaps[0].Type)
+	assert.Equal(t, uint64(2097148*1024), swaps[0].SizeBytes)
+	assert.Equal(t, uint64(10240*1024), swaps[0].UsedBytes)
+	assert.Equal(t, -2, swaps[0].Priority)
+	assert.Equal(t, "/var/lib/swap file", swaps[1].Filename)
+	assert.Equal(t, 100, swaps[2].Priority)
+}
+
+func TestWriteZeroFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "swapfile")
+	err = writeZeroFile(path, 3*1024*1024+512)
+	assert.Equal(t, nil, err)
+
+	info, _ := os.Stat(path)
+	assert.Equal(t, int64(3*1024*1024+512), info.Size())
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	assert.False(t, hasSwapSignature(path))
+
+	assert.NotEqual(t, nil, writeZeroFile(path, 1024))
+
+	//an existing file without a swap signature is left alone
+	os.Chmod(path, 0644)
+	created, err := sys.CreateSwapFile(path, 3*1024*1024+512)
+	assert.Equal(t, ErrSwapFileExists, err)
+	assert.False(t, created)
+	info, _ = os.Stat(path)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestEvaluateSwapPolicy(t *testing.T) {
+	swaps, _ := readSwaps("testdata/proc/swaps")
+	resolve := func(source string) string {
+		if source == "/dev/mapper/vg-swap" {
+			return "/dev/dm-1"
+		}
+		return source
+	}
+	configured := []*fs.FstabEntry{
+		{Source: "/dev/mapper/vg-swap", MountPoint: "none", FsType: "swap", Options: "defaults"},
+		{Source: "/var/lib/swap file", MountPoint: "none", FsType: "swap", Options: "noauto"},
+	}
+
+	report := evaluateSwapPolicy(&SwapPolicy{Enabled: true, MinSizeBytes: 1024 * 1024 * 1024}, swaps, configured, resolve)
+	assert.True(t, report.Compliant)
+	assert.Equal(t, uint64((2097148+1048572+4194300)*1024), report.TotalBytes)
+
+	report = evaluateSwapPolicy(&SwapPolicy{Enabled: true, Persistent: true}, swaps, configured, resolve)
+	assert.False(t, report.Compliant)
+	assert.Equal(t, []string{"/var/lib/swap file is not in fstab"}, report.Violations)
+
+	report = evaluateSwapPolicy(&SwapPolicy{Enabled: true, MinSizeBytes: 1}, []*SwapDevice{}, configured, resolve)
+	assert.Equal(t, 2, len(report.Violations))
+
+	report = evaluateSwapPolicy(&SwapPolicy{Enabled: false, Persistent: true}, swaps, configured, resolve)
+	assert.False(t, report.Compliant)
+	assert.Equal(t, 4, len(report.Violations))
+	assert.Equal(t, "fstab enables swap on /dev/mapper/vg-swap", report.Violations[3])
+
+	report = evaluateSwapPolicy(&SwapPolicy{Enabled: false, Persistent: true}, []*SwapDevice{}, configured[1:], resolve)
+	assert.True(t, report.Compliant)
+}
@@ -18,6 +18,14 @@ import (
 	str "github.com/dvonthenen/goxplatform/str"
 )
 
+const (
+	//UUIDNamespaceDNS is the RFC 4122 namespace for fully qualified domain names
+	UUIDNamespaceDNS = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	//UUIDNamespaceURL is the RFC 4122 namespace for URLs
+	UUIDNamespaceURL = "6ba7b811-9dad-11d1-80b4-00c04fd430c8"
+)
+
 const (
 	//OsUnknown unknown OS
 	OsUnknown = 0
@@ -50,6 +58,40 @@ var (
 
 	//ErrUnknownOsVersion unable to determine OS version
 	ErrUnknownOsVersion = errors.New("Unknown OS version")
+
+	//ErrInvalidKernelVersion unable to parse the kernel version
+	ErrInvalidKernelVersion = errors.New("Invalid kernel version string")
+
+	//ErrInvalidSysctlName the sysctl name is malformed
+	ErrInvalidSysctlName = errors.New("Invalid sysctl name")
+
+	//ErrInvalidSysctlValue the sysctl value is malformed
+	ErrInvalidSysctlValue = errors.New("Invalid sysctl value")
+
+	//ErrSysctlNotExist the sysctl does not exist on the running kernel
+	ErrSysctlNotExist = errors.New("Sysctl does not exist")
+
+	//ErrInvalidSysctlConf the sysctl.d drop-in name is malformed
+	ErrInvalidSysctlConf = errors.New("Invalid sysctl.d configuration name")
+
+	//ErrInvalidProcFile unable to parse the /proc file
+	ErrInvalidProcFile = errors.New("Unable to parse the proc file")
+
+	//ErrInvalidUUIDNamespace the namespace is not a valid UUID
+	ErrInvalidUUIDNamespace = errors.New("Invalid UUID namespace")
+
+	//ErrMachineIDNotFound unable to find or create a machine ID
+	ErrMachineIDNotFound = errors.New("Unable to find or create a machine ID")
+
+	//ErrInvalidSwapPath the swap file or device path is invalid
+	ErrInvalidSwapPath = errors.New("Invalid swap path")
+
+	//ErrSwapFileExists a file that is not a swap file of the requested size
+	//already exists at the path
+	ErrSwapFileExists = errors.New("File already exists and is not a swap file of the requested size")
+
+	//ErrSwapFailed the mkswap, swapon or swapoff command failed
+	ErrSwapFailed = errors.New("Swap command failed")
 )
 
 //Sys is a static class that provides System related functions
@@ -86,6 +128,46 @@ func (sys *Sys) GetUUIDStr() string {
 	return myUUID.String()
 }
 
+//GetUUIDV4 generates a random UUID that does not embed the host MAC
+func (sys *Sys) GetUUIDV4() []byte {
+	myUUID := uuid.NewV4()
+	log.Debugln("UUID Generated:", myUUID.String())
+	return myUUID.Bytes()
+}
+
+//GetUUIDV4Str generates a random UUID that does not embed the host MAC
+func (sys *Sys) GetUUIDV4Str() string {
+	myUUID := uuid.NewV4()
+	log.Debugln("UUID Generated:", myUUID.String())
+	return myUUID.String()
+}
+
+//GetUUIDV5 generates a name based UUID. The same namespace and name always
+//generate the same UUID.
+func (sys *Sys) GetUUIDV5(namespace string, name string) ([]byte, error) {
+	ns, err := uuid.Parse(namespace)
+	if err != nil {
+		log.Debugln("Invalid namespace:", namespace)
+		return nil, ErrInvalidUUIDNamespace
+	}
+	myUUID := uuid.NewV5(ns, name)
+	log.Debugln("UUID Generated:", myUUID.String())
+	return myUUID.Bytes(), nil
+}
+
+//GetUUIDV5Str generates a name based UUID. The same namespace and name always
+//generate the same UUID.
+func (sys *Sys) GetUUIDV5Str(namespace string, name string) (string, error) {
+	ns, err := uuid.Parse(namespace)
+	if err != nil {
+		log.Debugln("Invalid namespace:", namespace)
+		return "", ErrInvalidUUIDNamespace
+	}
+	myUUID := uuid.NewV5(ns, name)
+	log.Debugln("UUID Generated:", myUUID.String())
+	return myUUID.String(), nil
+}
+
 //GetOsType gets the OS type
 func (sys *Sys) GetOsType() int {
 	log.Debugln("GetOsType ENTER")
@@ -25,3 +25,19 @@ func TestGetUUIDStr(t *testing.T) {
 	uuid := sys.GetUUIDStr()
 	assert.NotEqual(t, "", uuid)
 }
+
+func TestGetUUIDV4Str(t *testing.T) {
+	uuid1 := sys.GetUUIDV4Str()
+	uuid2 := sys.GetUUIDV4Str()
+	assert.Equal(t, byte('4'), uuid1[14])
+	assert.NotEqual(t, uuid1, uuid2)
+}
+
+func TestGetUUIDV5Str(t *testing.T) {
+	uuid, err := sys.GetUUIDV5Str(UUIDNamespaceDNS, "www.example.com")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "2ed6657d-e927-568b-95e1-2665a8aea6a2", uuid)
+
+	_, err = sys.GetUUIDV5Str("bogus", "www.example.com")
+	assert.Equal(t, ErrInvalidUUIDNamespace, err)
+}
@@ -0,0 +1,296 @@
+package sys
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	fs "github.com/dvonthenen/goxplatform/fs"
+)
+
+const (
+	defaultProcSysDir    = "/proc/sys"
+	defaultSysctlConfDir = "/etc/sysctl.d"
+)
+
+var (
+	sysctlNameRegex     = regexp.MustCompile("^[a-zA-Z0-9_\\-]+([./][a-zA-Z0-9_\\-]+)*$")
+	sysctlConfNameRegex = regexp.MustCompile("^[a-zA-Z0-9_\\-.]+$")
+)
+
+//swapSysctlSeparators exchanges dots and slashes in name
+func swapSysctlSeparators(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.':
+			return '/'
+		case '/':
+			return '.'
+		}
+		return r
+	}, name)
+}
+
+//sysctlKey returns the dotted form of name. Like sysctl(8), a name whose
+//first separator is a slash is a path and its dots belong to the components,
+//as in net/ipv4/conf/eth0.100/rp_filter.
+func sysctlKey(name string) string {
+	if idx := strings.IndexAny(name, "./"); idx != -1 && name[idx] == '/' {
+		return swapSysctlSeparators(name)
+	}
+	return name
+}
+
+func sysctlPath(procDir string, name string) (string, error) {
+	if !sysctlNameRegex.MatchString(name) {
+		return "", ErrInvalidSysctlName
+	}
+	return filepath.Join(procDir, swapSysctlSeparators(sysctlKey(name))), nil
+}
+
+func normalizeSysctlValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func validateSysctlValue(value string) error {
+	if strings.ContainsAny(value, "\r\n") || len(normalizeSysctlValue(value)) == 0 {
+		return ErrInvalidSysctlValue
+	}
+	return nil
+}
+
+func readSysctl(procDir string, name string) (string, error) {
+	path, err := sysctlPath(procDir, name)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", ErrSysctlNotExist
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return normalizeSysctlValue(string(data)), nil
+}
+
+func writeSysctl(procDir string, name string, value string) error {
+	if err := validateSysctlValue(value); err != nil {
+		return err
+	}
+
+	path, err := sysctlPath(procDir, name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return ErrSysctlNotExist
+	}
+
+	return ioutil.WriteFile(path, []byte(normalizeSysctlValue(value)+"\n"), 0644)
+}
+
+//mergeSysctlConf merges settings into the drop-in at path. Every occurrence
+//of an existing key is updated in place since the last one wins, comments and
+//lines that are not settings are preserved and new keys are appended sorted.
+//Returns true if the file content changed.
+func mergeSysctlConf(path string, settings map[string]string) (bool, error) {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	values := make(map[string]string)
+	pending := make(map[string]string)
+	for name, value := range settings {
+		key := sysctlKey(name)
+		values[key] = normalizeSysctlValue(value)
+		pending[key] = values[key]
+	}
+
+	var buffer bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(existing))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '#' || trimmed[0] == ';' {
+			buffer.WriteString(line + "\n")
+			continue
+		}
+
+		idx := strings.Index(trimmed, "=")
+		if idx == -1 {
+			log.Warnln("Keeping invalid sysctl line:", line)
+			buffer.WriteString(line + "\n")
+			continue
+		}
+
+		name := strings.TrimSpace(trimmed[:idx])
+		key := sysctlKey(strings.TrimPrefix(name, "-"))
+		value, ok := values[key]
+		if !ok {
+			buffer.WriteString(line + "\n")
+			continue
+		}
+
+		buffer.WriteString(name + " = " + value + "\n")
+		delete(pending, key)
+	}
+
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buffer.WriteString(name + " = " + pending[name] + "\n")
+	}
+
+	if bytes.Equal(existing, buffer.Bytes()) {
+		return false, nil
+	}
+
+	err = fs.NewFs().WriteFileAtomic(path, buffer.Bytes(), 0644)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func sysctlConfPath(confDir string, confName string) (string, error) {
+	confName = strings.TrimSuffix(confName, ".conf")
+	if !sysctlConfNameRegex.MatchString(confName) {
+		return "", ErrInvalidSysctlConf
+	}
+	return filepath.Join(confDir, confName+".conf"), nil
+}
+
+//GetSysctl reads the current value of a kernel parameter (vm.max_map_count)
+func (sys *Sys) GetSysctl(name string) (string, error) {
+	log.Debugln("GetSysctl ENTER")
+	log.Debugln("name:", name)
+
+	value, err := readSysctl(defaultProcSysDir, name)
+	if err != nil {
+		log.Debugln("readSysctl Failed:", err)
+		log.Debugln("GetSysctl LEAVE")
+		return "", err
+	}
+
+	log.Debugln("GetSysctl =", value)
+	log.Debugln("GetSysctl LEAVE")
+	return value, nil
+}
+
+//SetSysctl sets the runtime value of a kernel parameter
+func (sys *Sys) SetSysctl(name string, value string) error {
+	log.Debugln("SetSysctl ENTER")
+	log.Debugln("name:", name)
+	log.Debugln("value:", value)
+
+	err := writeSysctl(defaultProcSysDir, name, value)
+	if err != nil {
+		log.Debugln("writeSysctl Failed:", err)
+		log.Debugln("SetSysctl LEAVE")
+		return err
+	}
+
+	log.Debugln("SetSysctl Succeeded")
+	log.Debugln("SetSysctl LEAVE")
+	return nil
+}
+
+//PersistSysctl merges the kernel parameters into the /etc/sysctl.d/<confName>.conf
+//drop-in. Every parameter must exist on the running kernel.
+func (sys *Sys) PersistSysctl(confName string, settings map[string]string) (bool, error) {
+	log.Debugln("PersistSysctl ENTER")
+	log.Debugln("confName:", confName)
+
+	path, err := sysctlConfPath(defaultSysctlConfDir, confName)
+	if err != nil {
+		log.Debugln("sysctlConfPath Failed:", err)
+		log.Debugln("PersistSysctl LEAVE")
+		return false, err
+	}
+
+	for name, value := range settings {
+		if err := validateSysctlValue(value); err != nil {
+			log.Debugln("Invalid value for", name)
+			log.Debugln("PersistSysctl LEAVE")
+			return false, err
+		}
+		if _, err := readSysctl(defaultProcSysDir, name); err != nil {
+			log.Debugln("Invalid sysctl", name, "Err:", err)
+			log.Debugln("PersistSysctl LEAVE")
+			return false, err
+		}
+	}
+
+	lock, err := sys.fs.Lock("sysctl", fs.DefaultLockTimeout)
+	if err != nil {
+		log.Debugln("Lock Failed:", err)
+		log.Debugln("PersistSysctl LEAVE")
+		return false, err
+	}
+	defer lock.Unlock()
+
+	changed, err := mergeSysctlConf(path, settings)
+	if err != nil {
+		log.Debugln("mergeSysctlConf Failed:", err)
+		log.Debugln("PersistSysctl LEAVE")
+		return false, err
+	}
+
+	log.Debugln("PersistSysctl changed:", changed)
+	log.Debugln("PersistSysctl LEAVE")
+	return changed, nil
+}
+
+//EnsureSysctl makes sure the kernel parameter has the given value both at
+//runtime and in the /etc/sysctl.d/<confName>.conf drop-in. Returns true if
+//anything was changed.
+func (sys *Sys) EnsureSysctl(confName string, name string, value string) (bool, error) {
+	log.Debugln("EnsureSysctl ENTER")
+	log.Debugln("confName:", confName)
+	log.Debugln("name:", name)
+	log.Debugln("value:", value)
+
+	current, err := sys.GetSysctl(name)
+	if err != nil {
+		log.Debugln("GetSysctl Failed:", err)
+		log.Debugln("EnsureSysctl LEAVE")
+		return false, err
+	}
+
+	changed := false
+	if current != normalizeSysctlValue(value) {
+		err = sys.SetSysctl(name, value)
+		if err != nil {
+			log.Debugln("SetSysctl Failed:", err)
+			log.Debugln("EnsureSysctl LEAVE")
+			return false, err
+		}
+		changed = true
+	}
+
+	persisted, err := sys.PersistSysctl(confName, map[string]string{name: value})
+	if err != nil {
+		log.Debugln("PersistSysctl Failed:", err)
+		log.Debugln("EnsureSysctl LEAVE")
+		return changed, err
+	}
+
+	log.Debugln("EnsureSysctl changed:", changed || persisted)
+	log.Debugln("EnsureSysctl LEAVE")
+	return changed || persisted, nil
+}
@@ -0,0 +1,87 @@
+package sys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func TestReadWriteSysctl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procsys")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "net", "ipv4"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "net", "ipv4", "ip_local_port_range"), []byte("32768\t60999\n"), 0644)
+
+	value, err := readSysctl(dir, "net.ipv4.ip_local_port_range")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "32768 60999", value)
+
+	err = writeSysctl(dir, "net.ipv4.ip_local_port_range", "1024 65000")
+	assert.Equal(t, nil, err)
+	value, _ = readSysctl(dir, "net/ipv4/ip_local_port_range")
+	assert.Equal(t, "1024 65000", value)
+
+	_, err = readSysctl(dir, "vm.max_map_count")
+	assert.Equal(t, ErrSysctlNotExist, err)
+
+	_, err = readSysctl(dir, "../etc/passwd")
+	assert.Equal(t, ErrInvalidSysctlName, err)
+
+	err = writeSysctl(dir, "net.ipv4.ip_local_port_range", "1\n2")
+	assert.Equal(t, ErrInvalidSysctlValue, err)
+
+	//dots in an interface name stay in the component in either form
+	vlan := filepath.Join(dir, "net", "ipv4", "conf", "eth0.100", "rp_filter")
+	os.MkdirAll(filepath.Dir(vlan), 0755)
+	ioutil.WriteFile(vlan, []byte("1\n"), 0644)
+	value, err = readSysctl(dir, "net.ipv4.conf.eth0/100.rp_filter")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1", value)
+	value, err = readSysctl(dir, "net/ipv4/conf/eth0.100/rp_filter")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1", value)
+}
+
+func TestMergeSysctlConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysctld")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "90-app.conf")
+	ioutil.WriteFile(path, []byte("# tuned\nvm.max_map_count = 65530\nvm.swappiness=10\n"), 0644)
+
+	changed, err := mergeSysctlConf(path, map[string]string{
+		"vm.max_map_count":   "262144",
+		"net.core.somaxconn": "1024",
+	})
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "# tuned\nvm.max_map_count = 262144\nvm.swappiness=10\nnet.core.somaxconn = 1024\n", string(data))
+
+	changed, err = mergeSysctlConf(path, map[string]string{"vm.max_map_count": "262144"})
+	assert.Equal(t, nil, err)
+	assert.False(t, changed)
+
+	//every occurrence of a key is updated and other lines are kept
+	ioutil.WriteFile(path, []byte("vm.swappiness=10\ninclude other\nvm.swappiness = 30\n"), 0644)
+	changed, err = mergeSysctlConf(path, map[string]string{"vm.swappiness": "1"})
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "vm.swappiness = 1\ninclude other\nvm.swappiness = 1\n", string(data))
+
+	//the dotted and slashed forms are the same setting
+	ioutil.WriteFile(path, []byte("net/ipv4/conf/eth0.100/rp_filter = 1\n"), 0644)
+	changed, err = mergeSysctlConf(path, map[string]string{"net.ipv4.conf.eth0/100.rp_filter": "2"})
+	assert.Equal(t, nil, err)
+	assert.True(t, changed)
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "net/ipv4/conf/eth0.100/rp_filter = 2\n", string(data))
+}
@@ -0,0 +1,305 @@
+package sys
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//ContainerNone not running in a container
+	ContainerNone = ""
+
+	//ContainerDocker is Docker
+	ContainerDocker = "docker"
+
+	//ContainerKubernetes is a Kubernetes pod
+	ContainerKubernetes = "kubernetes"
+
+	//ContainerPodman is Podman
+	ContainerPodman = "podman"
+
+	//ContainerLxc is LXC/LXD
+	ContainerLxc = "lxc"
+
+	//ContainerNspawn is systemd-nspawn
+	ContainerNspawn = "systemd-nspawn"
+
+	//ContainerWsl is the Windows Subsystem for Linux
+	ContainerWsl = "wsl"
+)
+
+const (
+	//HypervisorNone running on bare metal
+	HypervisorNone = ""
+
+	//HypervisorUnknown virtualized but the hypervisor is unknown
+	HypervisorUnknown = "unknown"
+
+	//HypervisorKvm is KVM/QEMU
+	HypervisorKvm = "kvm"
+
+	//HypervisorVMware is VMware
+	HypervisorVMware = "vmware"
+
+	//HypervisorVirtualBox is VirtualBox
+	HypervisorVirtualBox = "virtualbox"
+
+	//HypervisorHyperV is Microsoft Hyper-V
+	HypervisorHyperV = "hyperv"
+
+	//HypervisorXen is Xen
+	HypervisorXen = "xen"
+
+	//HypervisorParallels is Parallels
+	HypervisorParallels = "parallels"
+)
+
+const (
+	maxConfidence = 100
+)
+
+var (
+	dmiFiles = []string{"sys_vendor", "product_name", "bios_vendor", "board_vendor"}
+
+	dmiHypervisors = []struct {
+		needle     string
+		hypervisor string
+	}{
+		{"QEMU", HypervisorKvm},
+		{"KVM", HypervisorKvm},
+		{"Amazon EC2", HypervisorKvm},
+		{"Google", HypervisorKvm},
+		{"OpenStack", HypervisorKvm},
+		{"VMware", HypervisorVMware},
+		{"VirtualBox", HypervisorVirtualBox},
+		{"innotek", HypervisorVirtualBox},
+		{"Virtual Machine", HypervisorHyperV},
+		{"Xen", HypervisorXen},
+		{"Parallels", HypervisorParallels},
+	}
+
+	cgroupContainers = []struct {
+		needle    string
+		container string
+	}{
+		{"kubepods", ContainerKubernetes},
+		{"/docker/", ContainerDocker},
+		{"docker-", ContainerDocker},
+		{"libpod", ContainerPodman},
+		{"/lxc/", ContainerLxc},
+		{"lxc.payload", ContainerLxc},
+		{"machine.slice/machine-", ContainerNspawn},
+	}
+)
+
+//Detection is the outcome of an environment probe
+type Detection struct {
+	//Name is the detected runtime or hypervisor. Empty if none was found.
+	Name string
+
+	//Confidence ranges from 0 (nothing found) to 100
+	Confidence int
+
+	//Evidence lists what was found, strongest first
+	Evidence []string
+}
+
+//Environment describes the container and virtualization layers the process
+//is running under
+type Environment struct {
+	Container  Detection
+	Hypervisor Detection
+}
+
+type evidence struct {
+	scores   map[string]int
+	findings map[string][]string
+}
+
+func newEvidence() *evidence {
+	return &evidence{
+		scores:   make(map[string]int),
+		findings: make(map[string][]string),
+	}
+}
+
+func (e *evidence) add(name string, score int, finding string) {
+	log.Debugln("Evidence for", name, ":", finding)
+	e.scores[name] += score
+	e.findings[name] = append(e.findings[name], finding)
+}
+
+func (e *evidence) best() Detection {
+	names := make([]string, 0, len(e.scores))
+	for name := range e.scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	detection := Detection{}
+	for _, name := range names {
+		if e.scores[name] > detection.Confidence {
+			detection.Name = name
+			detection.Confidence = e.scores[name]
+			detection.Evidence = e.findings[name]
+		}
+	}
+	if detection.Confidence > maxConfidence {
+		detection.Confidence = maxConfidence
+	}
+	return detection
+}
+
+func rootPath(root string, path string) string {
+	return filepath.Join(root, path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func readPid1Environ(root string) map[string]string {
+	env := make(map[string]string)
+	data, err := ioutil.ReadFile(rootPath(root, "/proc/1/environ"))
+	if err != nil {
+		return env
+	}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		pair := strings.SplitN(string(entry), "=", 2)
+		if len(pair) == 2 {
+			env[pair[0]] = pair[1]
+		}
+	}
+	return env
+}
+
+func detectContainer(root string, getenv func(string) string) Detection {
+	e := newEvidence()
+
+	if fileExists(rootPath(root, "/.dockerenv")) {
+		e.add(ContainerDocker, 80, "/.dockerenv exists")
+	}
+	if fileExists(rootPath(root, "/run/.containerenv")) {
+		e.add(ContainerPodman, 80, "/run/.containerenv exists")
+	}
+	if fileExists(rootPath(root, "/var/run/secrets/kubernetes.io/serviceaccount")) {
+		e.add(ContainerKubernetes, 60, "kubernetes service account is mounted")
+	}
+
+	if value := getenv("KUBERNETES_SERVICE_HOST"); len(value) > 0 {
+		e.add(ContainerKubernetes, 60, "KUBERNETES_SERVICE_HOST="+value)
+	}
+	if value := getenv("WSL_DISTRO_NAME"); len(value) > 0 {
+		e.add(ContainerWsl, 50, "WSL_DISTRO_NAME="+value)
+	}
+
+	container := getenv("container")
+	if len(container) == 0 {
+		container = readPid1Environ(root)["container"]
+	}
+	switch container {
+	case "":
+	case "docker", "podman", "lxc", "systemd-nspawn":
+		e.add(container, 60, "container="+container)
+	case "oci":
+		e.add(ContainerPodman, 30, "container=oci")
+	default:
+		log.Debugln("Unknown container env:", container)
+	}
+
+	data, err := ioutil.ReadFile(rootPath(root, "/proc/1/cgroup"))
+	if err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		seen := make(map[string]bool)
+		for scanner.Scan() {
+			line := scanner.Text()
+			for _, cc := range cgroupContainers {
+				if seen[cc.container] || !strings.Contains(line, cc.needle) {
+					continue
+				}
+				seen[cc.container] = true
+				e.add(cc.container, 60, "/proc/1/cgroup: "+line)
+			}
+		}
+	}
+
+	data, err = ioutil.ReadFile(rootPath(root, "/proc/sys/kernel/osrelease"))
+	if err == nil && strings.Contains(strings.ToLower(string(data)), "microsoft") {
+		e.add(ContainerWsl, 80, "kernel release: "+strings.TrimSpace(string(data)))
+	}
+
+	return e.best()
+}
+
+func detectHypervisor(root string) Detection {
+	e := newEvidence()
+
+	for _, name := range dmiFiles {
+		data, err := ioutil.ReadFile(rootPath(root, "/sys/class/dmi/id/"+name))
+		if err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(data))
+		for _, dh := range dmiHypervisors {
+			if strings.Contains(value, dh.needle) {
+				e.add(dh.hypervisor, 40, "dmi "+name+": "+value)
+				break
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(rootPath(root, "/sys/hypervisor/type"))
+	if err == nil && strings.TrimSpace(string(data)) == "xen" {
+		e.add(HypervisorXen, 60, "/sys/hypervisor/type: xen")
+	}
+
+	detection := e.best()
+
+	ci, err := readCPUInfo(rootPath(root, "/proc/cpuinfo"))
+	if err == nil && ci.HasFlag("hypervisor") {
+		if len(detection.Name) == 0 {
+			detection.Name = HypervisorUnknown
+		}
+		detection.Confidence += 30
+		if detection.Confidence > maxConfidence {
+			detection.Confidence = maxConfidence
+		}
+		detection.Evidence = append(detection.Evidence, "cpuinfo flag: hypervisor")
+	}
+
+	return detection
+}
+
+//DetectEnvironment reports the container runtime and the hypervisor the
+//process is running under along with the evidence found for each
+func (sys *Sys) DetectEnvironment() *Environment {
+	log.Debugln("DetectEnvironment ENTER")
+
+	env := &Environment{
+		Container:  detectContainer("/", os.Getenv),
+		Hypervisor: detectHypervisor("/"),
+	}
+
+	log.Debugln("DetectEnvironment Container:", env.Container.Name, "Confidence:", env.Container.Confidence)
+	log.Debugln("DetectEnvironment Hypervisor:", env.Hypervisor.Name, "Confidence:", env.Hypervisor.Confidence)
+	log.Debugln("DetectEnvironment LEAVE")
+	return env
+}
+
+//IsContainer returns true if running inside a container
+func (sys *Sys) IsContainer() bool {
+	return len(detectContainer("/", os.Getenv).Name) > 0
+}
+
+//IsVirtualMachine returns true if running on a hypervisor
+func (sys *Sys) IsVirtualMachine() bool {
+	return len(detectHypervisor("/").Name) > 0
+}
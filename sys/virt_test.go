@@ -0,0 +1,92 @@
+package sys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+func makeFakeRoot(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "fakeroot")
+	assert.Equal(t, nil, err)
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(content), 0644)
+	}
+	return root
+}
+
+func noEnv(string) string {
+	return ""
+}
+
+func TestDetectContainerNone(t *testing.T) {
+	root := makeFakeRoot(t, map[string]string{
+		"/proc/1/cgroup": "1:name=systemd:/init.scope\n",
+	})
+	defer os.RemoveAll(root)
+
+	detection := detectContainer(root, noEnv)
+	assert.Equal(t, ContainerNone, detection.Name)
+	assert.Equal(t, 0, detection.Confidence)
+}
+
+func TestDetectContainerDocker(t *testing.T) {
+	root := makeFakeRoot(t, map[string]string{
+		"/.dockerenv":    "",
+		"/proc/1/cgroup": "12:memory:/docker/3f0e5a4c\n11:cpu:/docker/3f0e5a4c\n",
+	})
+	defer os.RemoveAll(root)
+
+	detection := detectContainer(root, noEnv)
+	assert.Equal(t, ContainerDocker, detection.Name)
+	assert.Equal(t, maxConfidence, detection.Confidence)
+	assert.Equal(t, 2, len(detection.Evidence))
+}
+
+func TestDetectContainerKubernetes(t *testing.T) {
+	root := makeFakeRoot(t, map[string]string{
+		"/.dockerenv":    "",
+		"/proc/1/cgroup": "12:memory:/kubepods/burstable/pod1234/3f0e5a4c\n",
+	})
+	defer os.RemoveAll(root)
+
+	getenv := func(key string) string {
+		if key == "KUBERNETES_SERVICE_HOST" {
+			return "10.0.0.1"
+		}
+		return ""
+	}
+
+	detection := detectContainer(root, getenv)
+	assert.Equal(t, ContainerKubernetes, detection.Name)
+}
+
+func TestDetectHypervisor(t *testing.T) {
+	root := makeFakeRoot(t, map[string]string{
+		"/sys/class/dmi/id/sys_vendor":   "QEMU\n",
+		"/sys/class/dmi/id/product_name": "Standard PC (i440FX + PIIX, 1996)\n",
+		"/proc/cpuinfo":                  "processor\t: 0\nflags\t\t: fpu vme hypervisor\n",
+	})
+	defer os.RemoveAll(root)
+
+	detection := detectHypervisor(root)
+	assert.Equal(t, HypervisorKvm, detection.Name)
+	assert.Equal(t, 70, detection.Confidence)
+	assert.Equal(t, 2, len(detection.Evidence))
+}
+
+func TestDetectHypervisorUnknown(t *testing.T) {
+	root := makeFakeRoot(t, map[string]string{
+		"/proc/cpuinfo": "processor\t: 0\nflags\t\t: fpu vme hypervisor\n",
+	})
+	defer os.RemoveAll(root)
+
+	detection := detectHypervisor(root)
+	assert.Equal(t, HypervisorUnknown, detection.Name)
+	assert.Equal(t, 30, detection.Confidence)
+}